@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"vibebox/internal/app"
 	"vibebox/internal/config"
@@ -15,7 +16,8 @@ import (
 )
 
 func main() {
-	exitCode, err := runWithIO(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	sdk.MaybeRunSandboxInit()
+	exitCode, err := runWithIO(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
 		if exitCode == 0 {
@@ -25,9 +27,12 @@ func main() {
 	os.Exit(exitCode)
 }
 
-func runWithIO(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+func runWithIO(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
 	a := app.New(stdout, stderr)
-	svc := sdk.NewService()
+	svc, err := sdk.NewService()
+	if err != nil {
+		return 1, err
+	}
 	if len(args) == 0 {
 		printRootHelp(stdout)
 		return 0, nil
@@ -48,7 +53,7 @@ func runWithIO(ctx context.Context, args []string, stdout io.Writer, stderr io.W
 		var noDefaultMounts bool
 		fs.BoolVar(&nonInteractive, "non-interactive", false, "disable TUI wizard")
 		fs.StringVar(&imageID, "image-id", "", "official image id")
-		fs.StringVar(&provider, "provider", string(config.ProviderAuto), "provider: off|apple-vm|docker|auto")
+		fs.StringVar(&provider, "provider", string(config.ProviderAuto), "provider: off|apple-vm|docker|podman|linux-ns|auto")
 		fs.IntVar(&cpus, "cpus", 2, "vm CPU count")
 		fs.IntVar(&ramMB, "ram-mb", 2048, "vm memory in MiB")
 		fs.IntVar(&diskGB, "disk-gb", 20, "vm disk in GiB")
@@ -77,7 +82,7 @@ func runWithIO(ctx context.Context, args []string, stdout io.Writer, stderr io.W
 		fs := flag.NewFlagSet("up", flag.ContinueOnError)
 		fs.SetOutput(stderr)
 		var provider string
-		fs.StringVar(&provider, "provider", "", "override provider: off|apple-vm|docker|auto")
+		fs.StringVar(&provider, "provider", "", "override provider: off|apple-vm|docker|podman|linux-ns|auto")
 		if err := fs.Parse(args[1:]); err != nil {
 			return 1, err
 		}
@@ -107,7 +112,9 @@ func runWithIO(ctx context.Context, args []string, stdout io.Writer, stderr io.W
 	case "probe":
 		return runProbe(ctx, svc, args[1:], stdout, stderr)
 	case "exec":
-		return runExec(ctx, svc, args[1:], stdout, stderr)
+		return runExec(ctx, svc, args[1:], stdin, stdout, stderr)
+	case "cleanup":
+		return runCleanup(ctx, svc, args[1:], stdout, stderr)
 	case "help", "--help", "-h":
 		printRootHelp(stdout)
 		return 0, nil
@@ -123,17 +130,30 @@ type probeJSONResponse struct {
 	Selected     string                           `json:"selected"`
 	WasFallback  bool                             `json:"wasFallback"`
 	FallbackFrom string                           `json:"fallbackFrom"`
+	Skipped      []sdk.SkippedProvider            `json:"skipped,omitempty"`
 	Diagnostics  map[string]sdk.BackendDiagnostic `json:"diagnostics"`
 }
 
 type execJSONResponse struct {
-	OK          bool                             `json:"ok"`
-	Error       string                           `json:"error,omitempty"`
-	Selected    string                           `json:"selected"`
-	ExitCode    int                              `json:"exitCode"`
-	Stdout      string                           `json:"stdout"`
-	Stderr      string                           `json:"stderr"`
-	Diagnostics map[string]sdk.BackendDiagnostic `json:"diagnostics"`
+	OK              bool                             `json:"ok"`
+	Error           string                           `json:"error,omitempty"`
+	ErrorCode       string                           `json:"errorCode,omitempty"`
+	Selected        string                           `json:"selected"`
+	ExitCode        int                              `json:"exitCode"`
+	TimedOut        bool                             `json:"timedOut"`
+	StartedAt       *time.Time                       `json:"startedAt,omitempty"`
+	DurationMs      int64                            `json:"durationMs"`
+	Signal          string                           `json:"signal,omitempty"`
+	OOMKilled       bool                             `json:"oomKilled"`
+	Stdout          string                           `json:"stdout"`
+	Stderr          string                           `json:"stderr"`
+	StdoutBytes     int64                            `json:"stdoutBytes"`
+	StderrBytes     int64                            `json:"stderrBytes"`
+	StdoutTruncated bool                             `json:"stdoutTruncated"`
+	StderrTruncated bool                             `json:"stderrTruncated"`
+	StdoutLogPath   string                           `json:"stdoutLogPath,omitempty"`
+	StderrLogPath   string                           `json:"stderrLogPath,omitempty"`
+	Diagnostics     map[string]sdk.BackendDiagnostic `json:"diagnostics"`
 }
 
 func runProbe(ctx context.Context, svc *sdk.Service, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
@@ -142,12 +162,15 @@ func runProbe(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wr
 	var provider string
 	var projectRoot string
 	var jsonMode bool
-	fs.StringVar(&provider, "provider", string(sdk.ProviderAuto), "provider: off|apple-vm|docker|auto")
-	fs.StringVar(&projectRoot, "project-root", "", "project root path (optional)")
+	fs.StringVar(&provider, "provider", string(sdk.ProviderAuto), "provider: off|apple-vm|docker|podman|linux-ns|auto")
+	fs.StringVar(&projectRoot, "project-root", "", "project root path (default: the current directory if it has .vibebox/config.yaml)")
 	fs.BoolVar(&jsonMode, "json", false, "output machine-readable JSON")
 	if err := fs.Parse(args); err != nil {
 		return 1, err
 	}
+	if projectRoot == "" {
+		projectRoot = initializedWorkingDir()
+	}
 
 	if projectRoot != "" {
 		if _, err := os.Stat(projectRoot); err != nil {
@@ -159,13 +182,20 @@ func runProbe(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wr
 		}
 	}
 
-	result, err := svc.Probe(ctx, sdk.Provider(provider))
+	var result sdk.ProbeResult
+	var err error
+	if projectRoot != "" {
+		result, err = svc.ProbeProject(ctx, sdk.ProbeRequest{ProjectRoot: projectRoot, Provider: sdk.Provider(provider)})
+	} else {
+		result, err = svc.Probe(ctx, sdk.Provider(provider))
+	}
 	if jsonMode {
 		resp := probeJSONResponse{
 			OK:           err == nil,
 			Selected:     string(result.Selected),
 			WasFallback:  result.WasFallback,
 			FallbackFrom: result.FallbackFrom,
+			Skipped:      result.Skipped,
 			Diagnostics:  normalizeDiagnostics(result.Diagnostics),
 		}
 		if resp.Diagnostics == nil {
@@ -184,12 +214,57 @@ func runProbe(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wr
 		return 0, nil
 	}
 
+	for _, sk := range result.Skipped {
+		_, _ = fmt.Fprintf(stdout, "skipped %s: %s\n", sk.Provider, sk.Reason)
+	}
 	if err != nil {
 		return 1, err
 	}
 	_, _ = fmt.Fprintf(stdout, "selected=%s fallback=%v from=%s\n", result.Selected, result.WasFallback, result.FallbackFrom)
 	for name, d := range result.Diagnostics {
 		_, _ = fmt.Fprintf(stdout, "%s available=%v reason=%q hints=%v\n", name, d.Available, d.Reason, d.FixHints)
+		if d.Runtime != nil && d.Runtime.Version != "" {
+			_, _ = fmt.Fprintf(stdout, "  runtime: %s %s (%s/%s)\n", d.Runtime.Name, d.Runtime.Version, d.Runtime.OS, d.Runtime.Arch)
+		}
+		if d.ConfigError != "" {
+			_, _ = fmt.Fprintf(stdout, "  config: %s\n", d.ConfigError)
+		}
+	}
+	return 0, nil
+}
+
+// initializedWorkingDir returns the current directory when it holds a project
+// config, so probe applies the same settings exec would, and "" otherwise.
+func initializedWorkingDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(config.ProjectConfigPath(wd)); err != nil {
+		return ""
+	}
+	return wd
+}
+
+func runCleanup(ctx context.Context, svc *sdk.Service, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var provider string
+	var all bool
+	fs.StringVar(&provider, "provider", string(sdk.ProviderAuto), "provider: off|apple-vm|docker|podman|linux-ns|auto")
+	fs.BoolVar(&all, "all", false, "also remove sandboxes that are not idle yet")
+	if err := fs.Parse(args); err != nil {
+		return 1, err
+	}
+	result, err := svc.Cleanup(ctx, sdk.CleanupRequest{Provider: sdk.Provider(provider), All: all})
+	for _, name := range result.Removed {
+		_, _ = fmt.Fprintf(stdout, "removed %s\n", name)
+	}
+	if err != nil {
+		return 1, err
+	}
+	if len(result.Removed) == 0 {
+		_, _ = fmt.Fprintln(stdout, "nothing to clean up")
 	}
 	return 0, nil
 }
@@ -260,7 +335,7 @@ func parseMountSpecs(values []string) ([]config.Mount, error) {
 	return out, nil
 }
 
-func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+func runExec(ctx context.Context, svc *sdk.Service, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
 	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
 	fs.SetOutput(stderr)
 	var provider string
@@ -269,13 +344,19 @@ func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wri
 	var cwd string
 	var timeoutSeconds int
 	var jsonMode bool
+	var forwardStdin bool
+	var maxOutputBytes int
+	var spillOutput bool
 	var envs envValues
-	fs.StringVar(&provider, "provider", string(sdk.ProviderAuto), "provider: off|apple-vm|docker|auto")
+	fs.StringVar(&provider, "provider", string(sdk.ProviderAuto), "provider: off|apple-vm|docker|podman|linux-ns|auto")
 	fs.StringVar(&projectRoot, "project-root", "", "project root path (optional)")
-	fs.StringVar(&command, "command", "", "command to execute (required)")
+	fs.StringVar(&command, "command", "", "shell command to execute (or pass argv after --)")
+	fs.BoolVar(&forwardStdin, "stdin", false, "forward standard input to the command")
 	fs.StringVar(&cwd, "cwd", "", "working directory inside sandbox")
 	fs.IntVar(&timeoutSeconds, "timeout-seconds", 0, "timeout in seconds")
 	fs.Var(&envs, "env", "environment variable KEY=VALUE (repeatable)")
+	fs.IntVar(&maxOutputBytes, "max-output-bytes", 0, "bytes of stdout/stderr kept per stream, head and tail (0 = config default, -1 = unlimited)")
+	fs.BoolVar(&spillOutput, "spill-output", false, "write full output of truncated streams to .vibebox/logs/")
 	fs.BoolVar(&jsonMode, "json", false, "output machine-readable JSON")
 	if err := fs.Parse(args); err != nil {
 		return 1, err
@@ -284,29 +365,42 @@ func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wri
 	envMap, err := parseEnv(envs)
 	if err != nil {
 		if jsonMode {
-			_ = writeJSON(stdout, execJSONResponse{OK: false, Error: err.Error(), Selected: "", ExitCode: 1, Stdout: "", Stderr: "", Diagnostics: map[string]sdk.BackendDiagnostic{}})
+			_ = writeJSON(stdout, execJSONResponse{OK: false, Error: err.Error(), ErrorCode: sdk.ErrorCodeInvalidArgument, Selected: "", ExitCode: 1, Stdout: "", Stderr: "", Diagnostics: map[string]sdk.BackendDiagnostic{}})
 			return 1, nil
 		}
 		return 1, err
 	}
 
-	if command == "" {
-		err := fmt.Errorf("--command is required")
+	argv := fs.Args()
+	if command == "" && len(argv) == 0 || command != "" && len(argv) > 0 {
+		err := fmt.Errorf("exactly one of --command or argv after -- is required")
 		if jsonMode {
-			_ = writeJSON(stdout, execJSONResponse{OK: false, Error: err.Error(), Selected: "", ExitCode: 1, Stdout: "", Stderr: "", Diagnostics: map[string]sdk.BackendDiagnostic{}})
+			_ = writeJSON(stdout, execJSONResponse{OK: false, Error: err.Error(), ErrorCode: sdk.ErrorCodeInvalidArgument, Selected: "", ExitCode: 1, Stdout: "", Stderr: "", Diagnostics: map[string]sdk.BackendDiagnostic{}})
 			return 1, nil
 		}
 		return 1, err
 	}
 
-	result, execErr := svc.Exec(ctx, sdk.ExecRequest{
+	execReq := sdk.ExecRequest{
 		ProjectRoot:      projectRoot,
 		ProviderOverride: sdk.Provider(provider),
 		Command:          command,
+		Args:             argv,
 		Cwd:              cwd,
 		Env:              envMap,
 		TimeoutSeconds:   timeoutSeconds,
-	})
+		MaxOutputBytes:   maxOutputBytes,
+		SpillOutput:      spillOutput,
+	}
+	if forwardStdin {
+		execReq.Stdin = stdin
+	}
+	if !jsonMode {
+		// Plain mode streams output live instead of printing it after exit.
+		execReq.Stdout = stdout
+		execReq.Stderr = stderr
+	}
+	result, execErr := svc.Exec(ctx, execReq)
 
 	if jsonMode {
 		diagnostics := normalizeDiagnostics(result.Diagnostics)
@@ -321,6 +415,7 @@ func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wri
 			resp := execJSONResponse{
 				OK:          false,
 				Error:       execErr.Error(),
+				ErrorCode:   sdk.ErrorCode(execErr),
 				Selected:    "",
 				ExitCode:    1,
 				Stdout:      "",
@@ -333,12 +428,25 @@ func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wri
 			return 1, nil
 		}
 		resp := execJSONResponse{
-			OK:          true,
-			Selected:    string(result.Selected),
-			ExitCode:    result.ExitCode,
-			Stdout:      result.Stdout,
-			Stderr:      result.Stderr,
-			Diagnostics: diagnostics,
+			OK:              true,
+			Selected:        string(result.Selected),
+			ExitCode:        result.ExitCode,
+			TimedOut:        result.TimedOut,
+			DurationMs:      result.Duration.Milliseconds(),
+			Signal:          result.Signal,
+			OOMKilled:       result.OOMKilled,
+			Stdout:          result.Stdout,
+			Stderr:          result.Stderr,
+			StdoutBytes:     result.StdoutBytes,
+			StderrBytes:     result.StderrBytes,
+			StdoutTruncated: result.StdoutTruncated,
+			StderrTruncated: result.StderrTruncated,
+			StdoutLogPath:   result.StdoutLogPath,
+			StderrLogPath:   result.StderrLogPath,
+			Diagnostics:     diagnostics,
+		}
+		if !result.StartedAt.IsZero() {
+			resp.StartedAt = &result.StartedAt
 		}
 		if err := writeJSON(stdout, resp); err != nil {
 			return 1, err
@@ -349,12 +457,6 @@ func runExec(ctx context.Context, svc *sdk.Service, args []string, stdout io.Wri
 	if execErr != nil {
 		return 1, execErr
 	}
-	if result.Stdout != "" {
-		_, _ = fmt.Fprint(stdout, result.Stdout)
-	}
-	if result.Stderr != "" {
-		_, _ = fmt.Fprint(stderr, result.Stderr)
-	}
 	return result.ExitCode, nil
 }
 
@@ -385,12 +487,14 @@ Usage:
   vibebox init [flags]           Initialize project sandbox
   vibebox up [--provider ...]    Start sandbox shell
   vibebox probe [--json]         Probe backend availability and selection
-  vibebox exec [--json]          Execute one command non-interactively
+  vibebox exec [--json] [-- argv] Execute one command non-interactively
+                                 (--stdin forwards standard input to the command)
+  vibebox cleanup [--all]        Remove idle sandboxes kept between execs
   vibebox images list            List official VM images
   vibebox images upgrade         Refresh/download an image
 
 Common flags:
-  --provider off|apple-vm|docker|auto
+  --provider off|apple-vm|docker|podman|linux-ns|auto
 
 Init flags:
   --provision-script <path>      Run script once when creating instance disk
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"runtime"
+	"strings"
 	"testing"
+
+	"vibebox/internal/config"
 )
 
 func TestProbeJSON(t *testing.T) {
@@ -12,7 +16,7 @@ func TestProbeJSON(t *testing.T) {
 	var out bytes.Buffer
 	var errBuf bytes.Buffer
 
-	code, err := runWithIO(context.Background(), []string{"probe", "--json", "--provider", "off"}, &out, &errBuf)
+	code, err := runWithIO(context.Background(), []string{"probe", "--json", "--provider", "off"}, nil, &out, &errBuf)
 	if err != nil {
 		t.Fatalf("run: %v", err)
 	}
@@ -30,6 +34,73 @@ func TestProbeJSON(t *testing.T) {
 	if selected, _ := payload["selected"].(string); selected != "off" {
 		t.Fatalf("expected selected=off, got %q", selected)
 	}
+	diagnostics, _ := payload["diagnostics"].(map[string]any)
+	off, _ := diagnostics["off"].(map[string]any)
+	caps, _ := off["capabilities"].(map[string]any)
+	if caps == nil {
+		t.Fatalf("expected off capabilities, got %v", off)
+	}
+	if v, _ := caps["backgroundProcesses"].(bool); !v {
+		t.Fatalf("expected backgroundProcesses=true, got %v", caps)
+	}
+	if v, _ := caps["networkIsolation"].(bool); v {
+		t.Fatalf("expected networkIsolation=false, got %v", caps)
+	}
+	rt, _ := off["runtime"].(map[string]any)
+	if arch, _ := rt["arch"].(string); arch != runtime.GOARCH {
+		t.Fatalf("expected runtime arch %q, got %v", runtime.GOARCH, rt)
+	}
+}
+
+func TestProbeJSONProjectAutoOrder(t *testing.T) {
+	t.Parallel()
+	project := t.TempDir()
+	cfg := config.Default()
+	cfg.Auto = config.AutoConfig{Order: []config.Provider{config.ProviderOff}, AllowOff: true}
+	if err := config.Save(config.ProjectConfigPath(project), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+
+	code, err := runWithIO(context.Background(), []string{"probe", "--json", "--project-root", project}, nil, &out, &errBuf)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected code 0, got %d; output=%q", code, out.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v\noutput=%q", err, out.String())
+	}
+	if selected, _ := payload["selected"].(string); selected != "off" {
+		t.Fatalf("expected selected=off, got %q", selected)
+	}
+}
+
+func TestProbeDefaultsToInitializedWorkingDir(t *testing.T) {
+	project := t.TempDir()
+	cfg := config.Default()
+	cfg.Auto = config.AutoConfig{Order: []config.Provider{config.ProviderOff}, AllowOff: true}
+	if err := config.Save(config.ProjectConfigPath(project), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	t.Chdir(project)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+
+	code, err := runWithIO(context.Background(), []string{"probe", "--json"}, nil, &out, &errBuf)
+	if err != nil || code != 0 {
+		t.Fatalf("probe: code=%d err=%v output=%q", code, err, out.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v\noutput=%q", err, out.String())
+	}
+	if selected, _ := payload["selected"].(string); selected != "off" {
+		t.Fatalf("expected the project auto order to select off, got %q", selected)
+	}
 }
 
 func TestExecJSONOff(t *testing.T) {
@@ -39,7 +110,7 @@ func TestExecJSONOff(t *testing.T) {
 	var errBuf bytes.Buffer
 
 	args := []string{"exec", "--json", "--provider", "off", "--project-root", project, "--command", "echo vibebox"}
-	code, err := runWithIO(context.Background(), args, &out, &errBuf)
+	code, err := runWithIO(context.Background(), args, nil, &out, &errBuf)
 	if err != nil {
 		t.Fatalf("run: %v", err)
 	}
@@ -57,6 +128,59 @@ func TestExecJSONOff(t *testing.T) {
 	if exitCode, _ := payload["exitCode"].(float64); int(exitCode) != 0 {
 		t.Fatalf("expected exitCode=0, got %v", payload["exitCode"])
 	}
+	if _, ok := payload["startedAt"].(string); !ok {
+		t.Fatalf("expected startedAt, got %v", payload["startedAt"])
+	}
+	if _, ok := payload["durationMs"].(float64); !ok {
+		t.Fatalf("expected durationMs, got %v", payload["durationMs"])
+	}
+}
+
+func TestExecJSONArgvOff(t *testing.T) {
+	t.Parallel()
+	project := t.TempDir()
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+
+	args := []string{"exec", "--json", "--provider", "off", "--project-root", project, "--", "echo", "a  b", "$HOME"}
+	code, err := runWithIO(context.Background(), args, nil, &out, &errBuf)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected code 0, got %d; output=%q", code, out.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v\noutput=%q", err, out.String())
+	}
+	if got, _ := payload["stdout"].(string); got != "a  b $HOME\n" {
+		t.Fatalf("unexpected stdout: %q", got)
+	}
+}
+
+func TestExecJSONStdinOff(t *testing.T) {
+	t.Parallel()
+	project := t.TempDir()
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+
+	args := []string{"exec", "--json", "--stdin", "--provider", "off", "--project-root", project, "--command", "tr a-z A-Z"}
+	code, err := runWithIO(context.Background(), args, strings.NewReader("piped input"), &out, &errBuf)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected code 0, got %d; stderr=%q", code, errBuf.String())
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v\noutput=%q", err, out.String())
+	}
+	if stdout, _ := payload["stdout"].(string); stdout != "PIPED INPUT" {
+		t.Fatalf("expected stdin to reach command, got stdout=%q", stdout)
+	}
 }
 
 func TestExecJSONMissingCommand(t *testing.T) {
@@ -64,7 +188,7 @@ func TestExecJSONMissingCommand(t *testing.T) {
 	var out bytes.Buffer
 	var errBuf bytes.Buffer
 
-	code, err := runWithIO(context.Background(), []string{"exec", "--json", "--provider", "off"}, &out, &errBuf)
+	code, err := runWithIO(context.Background(), []string{"exec", "--json", "--provider", "off"}, nil, &out, &errBuf)
 	if err != nil {
 		t.Fatalf("run: %v", err)
 	}
@@ -82,6 +206,49 @@ func TestExecJSONMissingCommand(t *testing.T) {
 	if _, exists := payload["error"]; !exists {
 		t.Fatalf("expected error field")
 	}
+	if payload["errorCode"] != "invalid_argument" {
+		t.Fatalf("expected errorCode=invalid_argument, got %v", payload["errorCode"])
+	}
+}
+
+func TestExecJSONCwdEscapeErrorCode(t *testing.T) {
+	t.Parallel()
+	project := t.TempDir()
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+
+	args := []string{"exec", "--json", "--provider", "off", "--project-root", project, "--cwd", "..", "--command", "true"}
+	code, err := runWithIO(context.Background(), args, nil, &out, &errBuf)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if code == 0 {
+		t.Fatalf("expected non-zero code")
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v\noutput=%q", err, out.String())
+	}
+	if payload["errorCode"] != "cwd_escapes_project" {
+		t.Fatalf("expected errorCode=cwd_escapes_project, got %v (%v)", payload["errorCode"], payload["error"])
+	}
+}
+
+func TestCleanupOff(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	code, err := runWithIO(context.Background(), []string{"cleanup", "--provider", "off"}, nil, &out, &errBuf)
+	if err != nil || code != 0 {
+		t.Fatalf("cleanup: code=%d err=%v stderr=%q", code, err, errBuf.String())
+	}
+	if out.String() != "nothing to clean up\n" {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+	if code, err := runWithIO(context.Background(), []string{"cleanup", "--provider", "nope"}, nil, &out, &errBuf); err == nil || code != 1 {
+		t.Fatalf("expected unknown provider to fail, got code=%d err=%v", code, err)
+	}
 }
 
 func TestParseMountSpecs(t *testing.T) {
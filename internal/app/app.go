@@ -13,9 +13,7 @@ import (
 	"golang.org/x/term"
 
 	"vibebox/internal/backend"
-	dockerbackend "vibebox/internal/backend/docker"
-	macosbackend "vibebox/internal/backend/macos"
-	offbackend "vibebox/internal/backend/off"
+	"vibebox/internal/backend/builtin"
 	"vibebox/internal/config"
 	"vibebox/internal/image"
 	"vibebox/internal/progress"
@@ -154,17 +152,13 @@ func (a *App) Up(ctx context.Context, opts UpOptions) error {
 		}
 	}
 
-	off := offbackend.New()
-	mac := macosbackend.New()
-	docker := dockerbackend.New()
-
-	selection, err := backend.Select(ctx, provider, off, mac, docker)
+	selection, err := backend.Select(ctx, provider, builtin.Registry(), backend.SelectOptions{Auto: cfg.Auto})
 	if err != nil {
 		return err
 	}
 
 	if selection.WasFallback {
-		_, _ = fmt.Fprintf(a.Stderr, "auto fallback: apple-vm backend unavailable, using docker\n")
+		_, _ = fmt.Fprintf(a.Stderr, "auto fallback: %s backend unavailable, using %s\n", selection.FallbackFrom, selection.Provider)
 	}
 
 	spec := backend.RuntimeSpec{
@@ -0,0 +1,10 @@
+package backend
+
+// CommandArgv returns the argv that runs req: req.Args as given, or req.Command
+// wrapped in the project's configured shell.
+func CommandArgv(spec RuntimeSpec, req ExecRequest) []string {
+	if len(req.Args) > 0 {
+		return append([]string(nil), req.Args...)
+	}
+	return spec.Config.ShellCommand(req.Command)
+}
@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"io"
+	"io/fs"
 	"time"
 
 	"vibebox/internal/config"
@@ -27,10 +28,26 @@ type RuntimeSpec struct {
 
 // ExecRequest configures one non-interactive command execution.
 type ExecRequest struct {
+	// ExecID identifies this execution. Backends tag sandbox processes with it so
+	// cancellation can tear down the whole process tree, not just the host client.
+	ExecID string
+	// Command is a shell command line run through the configured shell.
 	Command string
+	// Args, when set, is executed directly as argv instead of Command, with no
+	// shell interpretation. Args[0] is resolved against PATH in the sandbox.
+	Args    []string
 	Cwd     string
 	Env     map[string]string
 	Timeout time.Duration
+	// Stdin optionally feeds the command's standard input. Nil means empty input.
+	Stdin io.Reader
+	// Stdout and Stderr optionally receive output chunks while the command runs.
+	// The complete output is still returned in ExecResult.
+	Stdout io.Writer
+	Stderr io.Writer
+	// MaxOutputBytes bounds the output retained per stream in ExecResult (head
+	// and tail are kept). Zero means unlimited. Live writers still see everything.
+	MaxOutputBytes int
 }
 
 // ExecResult is the deterministic output of one command execution.
@@ -38,6 +55,24 @@ type ExecResult struct {
 	Stdout   string
 	Stderr   string
 	ExitCode int
+	// TimedOut reports that the command was killed because its deadline expired.
+	TimedOut bool
+	// StdoutBytes and StderrBytes count all bytes produced, including truncated ones.
+	StdoutBytes     int64
+	StderrBytes     int64
+	StdoutTruncated bool
+	StderrTruncated bool
+	// StartedAt and Duration measure the command itself, excluding backend preparation.
+	StartedAt time.Time
+	Duration  time.Duration
+	// Signal is the terminating signal name (for example "KILL"), if any.
+	Signal string
+	// OOMKilled reports that the sandbox killed the command for exceeding its memory limit.
+	OOMKilled bool
+	// Cwd and Env are the shell's working directory and exported environment
+	// after the command. Only stateful sessions report them.
+	Cwd string
+	Env map[string]string
 }
 
 // SessionHandle is backend-specific opaque session data.
@@ -48,6 +83,9 @@ type SessionStartRequest struct {
 	SessionID string
 	Cwd       string
 	Env       map[string]string
+	// Stateful asks for one long-lived shell that runs every ExecInSession, so
+	// cd and exported variables persist. Backends without support return an error.
+	Stateful bool
 }
 
 // ProbeResult reports backend availability.
@@ -55,6 +93,41 @@ type ProbeResult struct {
 	Available bool
 	Reason    string
 	FixHints  []string
+	// Capabilities describes what the backend supports, independent of Available.
+	Capabilities Capabilities
+	// Runtime describes the underlying runtime when it could be inspected.
+	Runtime RuntimeInfo
+}
+
+// Capabilities describes the features a backend supports.
+type Capabilities struct {
+	// PersistentSessions means processes and files outside mounts survive
+	// between commands of one session.
+	PersistentSessions bool
+	// Mounts means config mounts are applied inside the sandbox.
+	Mounts bool
+	Env    bool
+	Cwd    bool
+	// NetworkIsolation means commands cannot reach the host network namespace.
+	NetworkIsolation bool
+	Stdin            bool
+	// FileTransfer means session files can be read and written (FileBackend).
+	FileTransfer bool
+	// BackgroundProcesses means ProcessBackend is supported.
+	BackgroundProcesses bool
+	// LiveOutput means output reaches writers while the command runs.
+	LiveOutput bool
+	// StatefulShell means SessionStartRequest.Stateful is supported.
+	StatefulShell bool
+}
+
+// RuntimeInfo identifies the runtime behind a backend, such as the docker
+// server or the host operating system.
+type RuntimeInfo struct {
+	Name    string
+	Version string
+	OS      string
+	Arch    string
 }
 
 // Backend is one sandbox runtime implementation.
@@ -66,9 +139,81 @@ type Backend interface {
 	Exec(ctx context.Context, spec RuntimeSpec, req ExecRequest) (ExecResult, error)
 }
 
+// ConfigChecker is an optional extension for backends that can tell whether a
+// project configuration is usable on this host, beyond what Probe checks.
+type ConfigChecker interface {
+	CheckConfig(ctx context.Context, cfg config.Config) error
+}
+
+// Cleaner is an optional extension for backends that keep sandboxes between
+// calls, like the shared containers of docker execs. Cleanup removes the ones
+// idle past their timeout, or all of them when all is set, and returns their names.
+type Cleaner interface {
+	Cleanup(ctx context.Context, all bool) ([]string, error)
+}
+
 // SessionBackend is an optional extension for stateful session lifecycle support.
 type SessionBackend interface {
 	StartSession(ctx context.Context, spec RuntimeSpec, req SessionStartRequest) (SessionHandle, error)
 	ExecInSession(ctx context.Context, spec RuntimeSpec, handle SessionHandle, req ExecRequest) (ExecResult, error)
 	StopSession(ctx context.Context, spec RuntimeSpec, handle SessionHandle) error
 }
+
+// SessionPersister is an optional SessionBackend extension for sessions that can
+// be reattached by another process after the one that started them exits.
+type SessionPersister interface {
+	// MarshalSession encodes handle for the session registry.
+	MarshalSession(handle SessionHandle) ([]byte, error)
+	// ResumeSession rebuilds a handle from MarshalSession output. It fails when
+	// the underlying session no longer exists.
+	ResumeSession(ctx context.Context, spec RuntimeSpec, data []byte) (SessionHandle, error)
+}
+
+// SessionProber is an optional SessionPersister extension that checks whether a
+// persisted session still exists without attaching to it. Errors wrap
+// ErrSessionGone when the sandbox is known to be gone.
+type SessionProber interface {
+	ProbeSession(ctx context.Context, spec RuntimeSpec, data []byte) error
+}
+
+// ProcessHandle is backend-specific opaque data for a background process.
+type ProcessHandle any
+
+// ProcessExit describes how a background process ended.
+type ProcessExit struct {
+	ExitCode int
+	// Signal is the terminating signal name (for example "KILL"), if any.
+	Signal string
+}
+
+// ProcessBackend is an optional SessionBackend extension for background processes.
+// SpawnInSession returns once the process is running; its output is delivered to
+// req.Stdout/req.Stderr until it exits. Signals are canonical names without the
+// SIG prefix ("TERM", "KILL", ...) and are delivered to the whole process tree.
+type ProcessBackend interface {
+	SpawnInSession(ctx context.Context, spec RuntimeSpec, handle SessionHandle, req ExecRequest) (ProcessHandle, error)
+	WaitProcess(ctx context.Context, spec RuntimeSpec, handle SessionHandle, proc ProcessHandle) (ProcessExit, error)
+	SignalProcess(ctx context.Context, spec RuntimeSpec, handle SessionHandle, proc ProcessHandle, signal string) error
+}
+
+// FileInfo describes one file or directory inside a sandbox.
+type FileInfo struct {
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// FileBackend is an optional SessionBackend extension for direct file access.
+// Paths are guest paths; relative paths resolve against the project root.
+// Missing files are reported with errors wrapping fs.ErrNotExist.
+type FileBackend interface {
+	ReadFile(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string) ([]byte, error)
+	WriteFile(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string, data []byte, perm fs.FileMode) error
+	ListDir(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string) ([]FileInfo, error)
+	Stat(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string) (FileInfo, error)
+	// Remove deletes a file or empty directory, or a whole tree when recursive is set.
+	// Recursive removal of a missing path is not an error.
+	Remove(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string, recursive bool) error
+	MkdirAll(ctx context.Context, spec RuntimeSpec, handle SessionHandle, path string, perm fs.FileMode) error
+}
@@ -0,0 +1,23 @@
+package builtin
+
+import (
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/docker"
+	"vibebox/internal/backend/linuxns"
+	"vibebox/internal/backend/macos"
+	"vibebox/internal/backend/off"
+	"vibebox/internal/backend/podman"
+	"vibebox/internal/config"
+)
+
+// Registry returns a new registry holding the off, apple-vm, docker, podman
+// and linux-ns backends.
+func Registry() *backend.Registry {
+	reg := backend.NewRegistry()
+	_ = reg.Register(string(config.ProviderOff), off.New())
+	_ = reg.Register(string(config.ProviderAppleVM), macos.New())
+	_ = reg.Register(string(config.ProviderDocker), docker.New())
+	_ = reg.Register(string(config.ProviderPodman), podman.New())
+	_ = reg.Register(string(config.ProviderLinuxNS), linuxns.New())
+	return reg
+}
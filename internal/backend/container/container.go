@@ -0,0 +1,179 @@
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"vibebox/internal/backend"
+)
+
+// ExecIDEnv tags every process started for one exec so the whole tree can be
+// found through /proc and killed; neither docker nor podman exec offers a way
+// to signal one.
+const ExecIDEnv = "VIBEBOX_EXEC_ID"
+
+// Container labels let operators find every container vibebox created
+// (`docker ps -a --filter label=vibebox.managed=true`) even after a crash.
+const (
+	LabelManaged = "vibebox.managed"
+	LabelProject = "vibebox.project"
+	LabelKind    = "vibebox.kind"
+	LabelSession = "vibebox.session"
+	LabelExec    = "vibebox.exec"
+
+	KindStart   = "start"
+	KindExec    = "exec"
+	KindSession = "session"
+)
+
+// Labels returns the labels of a container of the given kind for spec, plus extra.
+func Labels(spec backend.RuntimeSpec, kind string, extra map[string]string) map[string]string {
+	labels := map[string]string{
+		LabelManaged: "true",
+		LabelProject: SanitizeName(spec.ProjectName),
+		LabelKind:    kind,
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// ExecToken returns the identifier used to tag sandbox processes for req.
+func ExecToken(req backend.ExecRequest) string {
+	if req.ExecID != "" {
+		return req.ExecID
+	}
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// KillTaggedScript returns a /bin/sh script that signals every process whose
+// environment carries the exec token, which covers children and background
+// jobs as well.
+func KillTaggedScript(token, signal string) string {
+	return fmt.Sprintf(
+		`for p in /proc/[0-9]*; do if tr '\0' '\n' <"$p/environ" 2>/dev/null | grep -qxF %s; then kill -s %s "${p#/proc/}" 2>/dev/null; fi; done; true`,
+		ShellQuote(ExecIDEnv+"="+token),
+		signal,
+	)
+}
+
+// ResolveGuestCwd maps requested, relative to the project root, to the guest
+// path under workspaceGuest. Absolute paths are taken as guest paths.
+func ResolveGuestCwd(projectRoot, requested, workspaceGuest string) (string, error) {
+	if requested == "" {
+		return workspaceGuest, nil
+	}
+	if strings.HasPrefix(requested, "/") {
+		return requested, nil
+	}
+
+	hostPath := filepath.Clean(filepath.Join(projectRoot, requested))
+	rel, err := filepath.Rel(projectRoot, hostPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("cwd %s %w %s", hostPath, backend.ErrEscapesProjectRoot, projectRoot)
+	}
+	return filepath.ToSlash(filepath.Join(workspaceGuest, rel)), nil
+}
+
+// EnvList renders env as KEY=VALUE entries sorted by key.
+func EnvList(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k+"="+env[k])
+	}
+	return out
+}
+
+// SanitizeName reduces in to the characters allowed in container names.
+func SanitizeName(in string) string {
+	if in == "" {
+		return "project"
+	}
+	in = strings.ToLower(in)
+	in = strings.ReplaceAll(in, " ", "-")
+	builder := strings.Builder{}
+	for _, ch := range in {
+		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' {
+			builder.WriteRune(ch)
+		}
+	}
+	out := builder.String()
+	if out == "" {
+		return "project"
+	}
+	return out
+}
+
+// ShellQuote quotes s as a single /bin/sh word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// State is the subset of an inspected container's .State used by the backends.
+type State struct {
+	Running    bool      `json:"Running"`
+	ExitCode   int       `json:"ExitCode"`
+	OOMKilled  bool      `json:"OOMKilled"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+}
+
+// ParseState decodes the JSON of an inspected container's .State.
+func ParseState(data []byte) (State, error) {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("decode container state: %w", err)
+	}
+	return state, nil
+}
+
+// ApplyState fills termination metadata of a one-shot exec from its exited
+// container. Container timestamps replace the host measurement since they
+// exclude image and container setup.
+func ApplyState(result *backend.ExecResult, state State) {
+	result.OOMKilled = state.OOMKilled
+	if !state.StartedAt.IsZero() && state.FinishedAt.After(state.StartedAt) {
+		result.StartedAt = state.StartedAt.UTC()
+		result.Duration = state.FinishedAt.Sub(state.StartedAt)
+	}
+}
+
+// exitCodeSignals maps the n of a 128+n exit code to its linux signal name.
+var exitCodeSignals = map[int]string{
+	1: "HUP", 2: "INT", 3: "QUIT", 9: "KILL", 10: "USR1",
+	12: "USR2", 15: "TERM", 19: "STOP", 18: "CONT",
+}
+
+// SignalFromExitCode guesses the terminating signal from a 128+n exit code.
+// docker and podman report only the exit code of an exec, never its wait
+// status, so a command that runs `exit 137` is reported as killed by SIGKILL
+// too. It returns "" when the code does not denote a known signal.
+func SignalFromExitCode(code int) string {
+	if code <= 128 {
+		return ""
+	}
+	return exitCodeSignals[code-128]
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// credentialHelperTimeout bounds a docker-credential-* helper invocation.
+const credentialHelperTimeout = 10 * time.Second
+
+// dockerHubAuthKey is the key the docker CLI stores Docker Hub credentials under.
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// authConfig is the JSON form of the X-Registry-Auth header.
+type authConfig struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// registryAuth returns the X-Registry-Auth header for pulling image, using the
+// credentials `docker login` stored in the CLI config, either inline or through
+// a credential helper. Without credentials the pull is anonymous.
+func registryAuth(image string) string {
+	dir, err := dockerConfigDir(os.Getenv)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ""
+	}
+
+	registry := registryHost(image)
+	key := registry
+	if registry == "docker.io" {
+		key = dockerHubAuthKey
+	}
+	var auth authConfig
+	if helper := cfg.CredHelpers[registry]; helper != "" {
+		auth = helperCredentials(helper, key)
+	} else if cfg.CredsStore != "" {
+		auth = helperCredentials(cfg.CredsStore, key)
+	} else {
+		for _, k := range []string{key, "https://" + registry, registry} {
+			entry, ok := cfg.Auths[k]
+			if !ok {
+				continue
+			}
+			if raw, err := base64.StdEncoding.DecodeString(entry.Auth); err == nil {
+				auth.Username, auth.Password, _ = strings.Cut(string(raw), ":")
+			}
+			auth.IdentityToken = entry.IdentityToken
+			break
+		}
+	}
+	if auth == (authConfig{}) {
+		return ""
+	}
+	auth.ServerAddress = key
+	encoded, err := json.Marshal(auth)
+	if err != nil {
+		return ""
+	}
+	return base64.URLEncoding.EncodeToString(encoded)
+}
+
+// helperCredentials asks docker-credential-<helper> for the credentials of serverURL.
+func helperCredentials(helper, serverURL string) authConfig {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		return authConfig{}
+	}
+	var cred struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &cred); err != nil {
+		return authConfig{}
+	}
+	// Helpers report identity tokens with this placeholder user name.
+	if cred.Username == "<token>" {
+		return authConfig{IdentityToken: cred.Secret}
+	}
+	return authConfig{Username: cred.Username, Password: cred.Secret}
+}
+
+// registryHost returns the registry of an image reference; references without
+// a registry component live on Docker Hub.
+func registryHost(image string) string {
+	first, _, ok := strings.Cut(image, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "docker.io"
+}
@@ -1,316 +1,667 @@
 package docker
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+	"vibebox/internal/config"
 )
 
-// Backend implements Docker runtime.
-type Backend struct{}
+// Backend implements Docker runtime on the Engine API.
+type Backend struct {
+	api *client
+	// apiErr reports an unusable daemon endpoint; it is surfaced by Probe and every call.
+	apiErr error
+	// warmMu serializes creation and replacement of warm containers and guards lastReap.
+	warmMu sync.Mutex
+	// lastReap is when the backend last looked for idle warm containers.
+	lastReap time.Time
+}
 
 type sessionHandle struct {
 	containerName string
 	defaultCwd    string
 	defaultEnv    map[string]string
+	// shell is the long-lived exec bash of a stateful session, nil otherwise.
+	shell *backend.Shell
 }
 
 func New() *Backend {
-	return &Backend{}
+	api, err := newClientFromEnv()
+	return &Backend{api: api, apiErr: err}
 }
 
 func (b *Backend) Name() string {
 	return "docker"
 }
 
+// docker returns the API client.
+func (b *Backend) docker() (*client, error) {
+	return b.api, b.apiErr
+}
+
+var capabilities = backend.Capabilities{
+	PersistentSessions:  true,
+	Mounts:              true,
+	Env:                 true,
+	Cwd:                 true,
+	Stdin:               true,
+	FileTransfer:        true,
+	BackgroundProcesses: true,
+	LiveOutput:          true,
+	StatefulShell:       true,
+}
+
 func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
-	if _, err := exec.LookPath("docker"); err != nil {
+	c, err := b.docker()
+	if err != nil {
 		return backend.ProbeResult{
-			Available: false,
-			Reason:    "docker command not found",
-			FixHints:  []string{"install Docker Desktop or docker engine", "ensure docker is on PATH"},
+			Available:    false,
+			Reason:       err.Error(),
+			FixHints:     []string{"set DOCKER_HOST to unix:///path/to/docker.sock, tcp://host:port or ssh://user@host", "run `docker context ls` and check the current context", "unset DOCKER_HOST and DOCKER_CONTEXT to use " + defaultSocket},
+			Capabilities: capabilities,
 		}
 	}
-
-	cmd := exec.CommandContext(ctx, "docker", "info")
-	if err := cmd.Run(); err != nil {
+	if err := c.ping(ctx); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return backend.ProbeResult{
+				Available:    false,
+				Reason:       "docker daemon socket not found",
+				FixHints:     []string{"install Docker Desktop or docker engine", "set DOCKER_HOST if the daemon listens elsewhere"},
+				Capabilities: capabilities,
+			}
+		}
+		return backend.ProbeResult{
+			Available:    false,
+			Reason:       "docker daemon not reachable",
+			FixHints:     []string{"start docker daemon", "check access to the daemon socket (docker group membership)", "run `docker info` and fix errors"},
+			Capabilities: capabilities,
+		}
+	}
+	info, err := c.info(ctx)
+	if err != nil {
 		return backend.ProbeResult{
-			Available: false,
-			Reason:    "docker daemon not reachable",
-			FixHints:  []string{"start docker daemon", "run `docker info` and fix errors"},
+			Available:    false,
+			Reason:       "docker daemon not reachable",
+			FixHints:     []string{"run `docker info` and fix errors"},
+			Capabilities: capabilities,
 		}
 	}
+	return backend.ProbeResult{
+		Available:    true,
+		Capabilities: capabilities,
+		Runtime:      backend.RuntimeInfo{Name: "docker", Version: info.ServerVersion, OS: info.OSType, Arch: info.Architecture},
+	}
+}
 
-	return backend.ProbeResult{Available: true}
+// CheckConfig reports whether the OCI runtime named by docker.security.runtime
+// is registered with the daemon.
+func (b *Backend) CheckConfig(ctx context.Context, cfg config.Config) error {
+	runtime := cfg.Docker.Security.Resolved().Runtime
+	if runtime == "" {
+		return nil
+	}
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	info, err := c.info(ctx)
+	if err != nil {
+		return fmt.Errorf("docker info: %w", err)
+	}
+	if _, ok := info.Runtimes[runtime]; ok {
+		return nil
+	}
+	available := make([]string, 0, len(info.Runtimes))
+	for name := range info.Runtimes {
+		available = append(available, name)
+	}
+	sort.Strings(available)
+	return fmt.Errorf("docker runtime %q is not available (daemon has: %s)", runtime, strings.Join(available, ", "))
 }
 
 func (b *Backend) Prepare(ctx context.Context, spec backend.RuntimeSpec) error {
-	inspect := exec.CommandContext(ctx, "docker", "image", "inspect", spec.Config.Docker.Image)
-	if err := inspect.Run(); err == nil {
-		return nil
+	c, err := b.docker()
+	if err != nil {
+		return err
 	}
-	pull := exec.CommandContext(ctx, "docker", "pull", spec.Config.Docker.Image)
-	pullStdout := spec.IO.Stdout
-	pullStderr := spec.IO.Stderr
-	if pullStdout == nil {
-		pullStdout = os.Stderr
+	image := spec.Config.Docker.Image
+	if ok, err := c.imageExists(ctx, image); err != nil {
+		return fmt.Errorf("inspect docker image %s: %w", image, err)
+	} else if ok {
+		return nil
 	}
-	if pullStderr == nil {
-		pullStderr = os.Stderr
+	progress := spec.IO.Stderr
+	if progress == nil {
+		progress = os.Stderr
 	}
-	pull.Stdout = pullStdout
-	pull.Stderr = pullStderr
-	if err := pull.Run(); err != nil {
-		return fmt.Errorf("pull docker image %s: %w", spec.Config.Docker.Image, err)
+	if err := c.pullImage(ctx, image, registryAuth(image), progress); err != nil {
+		return fmt.Errorf("pull docker image %s: %w", image, err)
 	}
 	return nil
 }
 
 func (b *Backend) Start(ctx context.Context, spec backend.RuntimeSpec) error {
-	containerName := "vibebox-" + sanitizeName(spec.ProjectName)
-
-	args := []string{"run", "--rm", "-it", "--name", containerName, "-e", "IS_SANDBOX=1"}
-	for _, m := range spec.Config.Mounts {
-		hostPath := m.Host
-		if !filepath.IsAbs(hostPath) {
-			hostPath = filepath.Join(spec.ProjectRoot, hostPath)
-		}
-		if _, err := os.Stat(hostPath); err != nil {
-			return fmt.Errorf("mount host path does not exist: %s", hostPath)
-		}
-		args = append(args, "-v", fmt.Sprintf("%s:%s:%s", hostPath, m.Guest, m.Mode))
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	cfg, err := newContainerConfig(spec)
+	if err != nil {
+		return err
+	}
+	stdin, stdout, stderr := spec.IO.Stdin, spec.IO.Stdout, spec.IO.Stderr
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
 	}
 
-	args = append(args,
-		"-w", "/workspace",
-		spec.Config.Docker.Image,
-		"/bin/bash",
-	)
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	cmd.Stdin = spec.IO.Stdin
-	cmd.Stdout = spec.IO.Stdout
-	cmd.Stderr = spec.IO.Stderr
-	if cmd.Stdin == nil {
-		cmd.Stdin = os.Stdin
+	// Like `docker run -it`, a TTY is allocated when stdin is a terminal.
+	cfg.Cmd = []string{"/bin/bash"}
+	cfg.WorkingDir = "/workspace"
+	cfg.Labels = container.Labels(spec, container.KindStart, nil)
+	cfg.OpenStdin, cfg.StdinOnce, cfg.AttachStdin = true, true, true
+	cfg.AttachStdout, cfg.AttachStderr = true, true
+	cfg.HostConfig.AutoRemove = true
+	tty, isTTY := terminalOf(stdin)
+	if isTTY {
+		cfg.Tty = true
+		cfg.HostConfig.ConsoleSize = tty.size()
 	}
-	if cmd.Stdout == nil {
-		cmd.Stdout = os.Stdout
+	containerName := "vibebox-" + container.SanitizeName(spec.ProjectName)
+	id, err := c.createContainer(ctx, containerName, cfg)
+	if err != nil {
+		return fmt.Errorf("create docker container: %w", err)
 	}
-	if cmd.Stderr == nil {
-		cmd.Stderr = os.Stderr
+	if isTTY {
+		restore, err := tty.makeRaw()
+		if err != nil {
+			_ = removeContainer(c, id)
+			return err
+		}
+		defer restore()
+		defer tty.watchSize(c, id)()
 	}
 
-	if err := cmd.Run(); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return fmt.Errorf("docker exited with code %d", exitErr.ExitCode())
+	code, err := runContainer(ctx, c, id, stdin, stdout, stderr, isTTY)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 		return err
 	}
+	if code != 0 {
+		return fmt.Errorf("docker exited with code %d", code)
+	}
 	return nil
 }
 
+// Exec runs req in the project's warm container, or in a container of its own
+// when docker.fresh_containers is set.
 func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	c, err := b.docker()
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	if spec.Config.Docker.FreshContainers {
+		return execFresh(ctx, c, spec, req)
+	}
+	return b.execWarm(ctx, c, spec, req)
+}
+
+// execFresh runs req in a new container that is removed afterwards.
+func execFresh(ctx context.Context, c *client, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
 	workspaceGuest := "/workspace"
-	guestCwd, err := resolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuest)
+	guestCwd, err := container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuest)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	cfg, err := newContainerConfig(spec)
 	if err != nil {
 		return backend.ExecResult{}, err
 	}
 
-	args := []string{"run", "--rm", "-i", "-e", "IS_SANDBOX=1"}
-	for _, m := range spec.Config.Mounts {
-		hostPath := m.Host
-		if !filepath.IsAbs(hostPath) {
-			hostPath = filepath.Join(spec.ProjectRoot, hostPath)
-		}
-		if _, err := os.Stat(hostPath); err != nil {
-			return backend.ExecResult{}, fmt.Errorf("mount host path does not exist: %s", hostPath)
+	token := container.ExecToken(req)
+	containerName := "vibebox-x-" + container.SanitizeName(spec.ProjectName) + "-" + container.SanitizeName(token)
+	// The container is removed after exit rather than auto-removed so its final state can be inspected.
+	cfg.Cmd = backend.CommandArgv(spec, req)
+	cfg.Env = append(cfg.Env, container.EnvList(req.Env)...)
+	cfg.WorkingDir = guestCwd
+	cfg.Labels = container.Labels(spec, container.KindExec, map[string]string{container.LabelExec: token})
+	cfg.OpenStdin, cfg.StdinOnce, cfg.AttachStdin = req.Stdin != nil, req.Stdin != nil, req.Stdin != nil
+	cfg.AttachStdout, cfg.AttachStderr = true, true
+	id, err := c.createContainer(ctx, containerName, cfg)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The daemon may have created the container before the call was cut off.
+			_ = removeContainer(c, containerName)
+			return backend.ExecResult{ExitCode: -1, TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded)}, nil
 		}
-		args = append(args, "-v", fmt.Sprintf("%s:%s:%s", hostPath, m.Guest, m.Mode))
-	}
-	for _, e := range envList(req.Env) {
-		args = append(args, "-e", e)
+		return backend.ExecResult{}, fmt.Errorf("create docker container: %w", err)
 	}
-	args = append(args,
-		"-w", guestCwd,
-		spec.Config.Docker.Image,
-		"/bin/bash", "-lc", req.Command,
-	)
+	defer func() { _ = removeContainer(c, id) }()
 
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	startedAt := time.Now()
+	code, err := runContainer(ctx, c, id, req.Stdin, backend.CaptureWriter(stdout, req.Stdout), backend.CaptureWriter(stderr, req.Stderr), false)
 
-	result := backend.ExecResult{
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
-		ExitCode: 0,
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if err != nil {
+		if ctx.Err() != nil {
+			result.ExitCode = -1
+			return result, nil
+		}
+		return result, err
 	}
-	if err == nil {
-		return result, nil
+	if state, stateErr := inspectContainerState(c, id); stateErr == nil {
+		container.ApplyState(&result, state)
 	}
-	var exitErr *exec.ExitError
-	if errors.As(err, &exitErr) {
-		result.ExitCode = exitErr.ExitCode()
-		return result, nil
+	result.ExitCode = code
+	result.Signal = container.SignalFromExitCode(code)
+	return result, nil
+}
+
+// runContainer attaches to a created container, starts it and copies its
+// stdio until it exits, returning the exit code. If ctx ends first the
+// container is removed, which kills it; its exit code is still returned when
+// the daemon reports it in time.
+func runContainer(ctx context.Context, c *client, id string, stdin io.Reader, stdout, stderr io.Writer, tty bool) (int, error) {
+	st, err := c.attachContainer(ctx, id, stdin != nil)
+	if err != nil {
+		return -1, fmt.Errorf("attach docker container: %w", err)
 	}
-	return result, err
+	defer st.Close()
+	waitCtx, cancelWait := context.WithCancel(context.Background())
+	defer cancelWait()
+	wait, err := c.waitContainer(waitCtx, id)
+	if err != nil {
+		return -1, fmt.Errorf("wait for docker container: %w", err)
+	}
+	if err := c.startContainer(ctx, id); err != nil {
+		return -1, fmt.Errorf("start docker container: %w", err)
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(st, stdin)
+			_ = st.CloseWrite()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// With a TTY the stream is raw and stderr is merged into it.
+		if tty {
+			_, _ = io.Copy(stdout, st)
+			return
+		}
+		_ = demux(st, stdout, stderr)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		_ = removeContainer(c, id)
+		select {
+		case <-done:
+		case <-time.After(cancelWaitDelay):
+			_ = st.Close()
+			<-done
+		}
+		time.AfterFunc(cancelWaitDelay, cancelWait)
+	}
+	return wait()
 }
 
 func (b *Backend) StartSession(ctx context.Context, spec backend.RuntimeSpec, req backend.SessionStartRequest) (backend.SessionHandle, error) {
-	workspaceGuest := "/workspace"
-	guestCwd, err := resolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuest)
+	c, err := b.docker()
 	if err != nil {
 		return nil, err
 	}
-	containerName := "vibebox-s-" + sanitizeName(spec.ProjectName) + "-" + sanitizeName(req.SessionID)
-
-	args := []string{"run", "-d", "--rm", "--name", containerName, "-e", "IS_SANDBOX=1"}
-	mountArgs, err := buildMountArgs(spec)
+	workspaceGuest := "/workspace"
+	guestCwd, err := container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuest)
 	if err != nil {
 		return nil, err
 	}
-	args = append(args, mountArgs...)
-	for _, e := range envList(req.Env) {
-		args = append(args, "-e", e)
+	cfg, err := newContainerConfig(spec)
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, "-w", guestCwd, spec.Config.Docker.Image, "sleep", "infinity")
+	cfg.Cmd = []string{"sleep", "infinity"}
+	cfg.Env = append(cfg.Env, container.EnvList(req.Env)...)
+	cfg.WorkingDir = guestCwd
+	cfg.Labels = container.Labels(spec, container.KindSession, map[string]string{container.LabelSession: req.SessionID})
+	cfg.HostConfig.AutoRemove = true
+	containerName := "vibebox-s-" + container.SanitizeName(spec.ProjectName) + "-" + container.SanitizeName(req.SessionID)
 
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	var stderr bytes.Buffer
-	cmd.Stdout = io.Discard
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("start docker session: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	_, err = c.createContainer(ctx, containerName, cfg)
+	if err == nil {
+		err = c.startContainer(ctx, containerName)
+	}
+	if err == nil && cfg.User != "" {
+		err = addUserEntry(ctx, c, containerName, cfg.User)
+	}
+	if err != nil {
+		// The container may already exist when creation succeeded or was cancelled mid-call.
+		_ = removeContainer(c, containerName)
+		return nil, fmt.Errorf("start docker session: %w", err)
 	}
 
-	return sessionHandle{
+	h := sessionHandle{
 		containerName: containerName,
 		defaultCwd:    guestCwd,
 		defaultEnv:    cloneMap(req.Env),
-	}, nil
+	}
+	if req.Stateful {
+		if h.shell, err = startShell(ctx, c, h); err != nil {
+			_ = removeContainer(c, containerName)
+			return nil, err
+		}
+	}
+	return h, nil
 }
 
 func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ExecResult, error) {
+	c, err := b.docker()
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
 	h, ok := handle.(sessionHandle)
 	if !ok {
 		return backend.ExecResult{}, fmt.Errorf("invalid docker session handle")
 	}
-	guestCwd := req.Cwd
-	if guestCwd == "" {
-		guestCwd = h.defaultCwd
-	} else {
-		var err error
-		guestCwd, err = resolveGuestCwd(spec.ProjectRoot, req.Cwd, "/workspace")
-		if err != nil {
-			return backend.ExecResult{}, err
+	if h.shell != nil {
+		return h.execInShell(ctx, c, spec, req)
+	}
+	guestCwd, env, err := h.resolve(spec, req)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	return execInContainer(ctx, c, h.containerName, spec, req, guestCwd, env)
+}
+
+// execInContainer runs req as an exec in a running container.
+func execInContainer(ctx context.Context, c *client, containerName string, spec backend.RuntimeSpec, req backend.ExecRequest, guestCwd string, env map[string]string) (backend.ExecResult, error) {
+	token := container.ExecToken(req)
+	cfg := execConfig{
+		Cmd:        backend.CommandArgv(spec, req),
+		Env:        append(container.EnvList(env), container.ExecIDEnv+"="+token),
+		WorkingDir: guestCwd,
+	}
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	startedAt := time.Now()
+	// Exec processes outlive their stream; cancellation kills the tagged tree.
+	code, err := runExec(ctx, c, containerName, cfg, req.Stdin,
+		backend.CaptureWriter(stdout, req.Stdout), backend.CaptureWriter(stderr, req.Stderr),
+		func() { _ = killTaggedProcesses(c, containerName, token, "KILL") })
+
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if err != nil {
+		if ctx.Err() != nil {
+			result.ExitCode = -1
+			return result, nil
 		}
+		return result, err
 	}
+	result.ExitCode = code
+	// The OOMKilled state of a shared container is not this exec's: it stays
+	// set after any process in the container was OOM killed.
+	result.Signal = container.SignalFromExitCode(code)
+	return result, nil
+}
 
-	env := cloneMap(h.defaultEnv)
-	for k, v := range req.Env {
-		env[k] = v
+func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle) error {
+	_ = spec
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return fmt.Errorf("invalid docker session handle")
+	}
+	if h.shell != nil {
+		_ = h.shell.Close()
 	}
+	if err := c.deleteContainer(ctx, h.containerName); err != nil && !isNotFound(err) {
+		return fmt.Errorf("stop docker session: %w", err)
+	}
+	return nil
+}
+
+// persistedSession is the registry form of sessionHandle.
+type persistedSession struct {
+	ContainerName string            `json:"containerName"`
+	DefaultCwd    string            `json:"defaultCwd"`
+	DefaultEnv    map[string]string `json:"defaultEnv,omitempty"`
+	Stateful      bool              `json:"stateful,omitempty"`
+}
+
+func (b *Backend) MarshalSession(handle backend.SessionHandle) ([]byte, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid docker session handle")
+	}
+	return json.Marshal(persistedSession{
+		ContainerName: h.containerName,
+		DefaultCwd:    h.defaultCwd,
+		DefaultEnv:    h.defaultEnv,
+		Stateful:      h.shell != nil,
+	})
+}
 
-	args := []string{"exec", "-i", "-w", guestCwd}
-	for _, e := range envList(env) {
-		args = append(args, "-e", e)
+func decodeSession(data []byte) (persistedSession, error) {
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("decode docker session: %w", err)
 	}
-	args = append(args, h.containerName, "/bin/bash", "-lc", req.Command)
+	if p.ContainerName == "" {
+		return p, fmt.Errorf("decode docker session: missing container name")
+	}
+	return p, nil
+}
 
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+// ProbeSession reports a session gone when its container no longer runs;
+// session containers are auto-removed once stopped.
+func (b *Backend) ProbeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) error {
+	_ = spec
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	p, err := decodeSession(data)
+	if err != nil {
+		return err
+	}
+	return probeSessionContainer(ctx, c, p.ContainerName)
+}
 
-	result := backend.ExecResult{
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
-		ExitCode: 0,
+func probeSessionContainer(ctx context.Context, c *client, containerName string) error {
+	info, err := c.inspectContainer(ctx, containerName)
+	if isNotFound(err) {
+		return fmt.Errorf("docker session container %s: %w: %w", containerName, backend.ErrSessionGone, err)
 	}
-	if err == nil {
-		return result, nil
+	if err != nil {
+		return fmt.Errorf("inspect docker session container %s: %w", containerName, err)
 	}
-	var exitErr *exec.ExitError
-	if errors.As(err, &exitErr) {
-		result.ExitCode = exitErr.ExitCode()
-		return result, nil
+	if !info.State.Running {
+		return fmt.Errorf("docker session container %s is not running: %w", containerName, backend.ErrSessionGone)
 	}
-	return result, err
+	return nil
 }
 
-func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle) error {
+func (b *Backend) ResumeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) (backend.SessionHandle, error) {
 	_ = spec
-	h, ok := handle.(sessionHandle)
-	if !ok {
-		return fmt.Errorf("invalid docker session handle")
+	c, err := b.docker()
+	if err != nil {
+		return nil, err
 	}
-	cmd := exec.CommandContext(ctx, "docker", "rm", "-f", h.containerName)
-	var stderr bytes.Buffer
-	cmd.Stdout = io.Discard
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		msg := strings.ToLower(stderr.String())
-		if strings.Contains(msg, "no such container") {
-			return nil
+	p, err := decodeSession(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := probeSessionContainer(ctx, c, p.ContainerName); err != nil {
+		return nil, err
+	}
+	h := sessionHandle{
+		containerName: p.ContainerName,
+		defaultCwd:    p.DefaultCwd,
+		defaultEnv:    cloneMap(p.DefaultEnv),
+	}
+	if p.Stateful {
+		// The previous shell's exec stream ended with the process that owned it;
+		// a new shell starts from the session defaults.
+		shell, err := startShell(ctx, c, h)
+		if err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("stop docker session: %w (%s)", err, strings.TrimSpace(stderr.String()))
+		h.shell = shell
 	}
-	return nil
+	return h, nil
 }
 
-func resolveGuestCwd(projectRoot, requested, workspaceGuest string) (string, error) {
-	if requested == "" {
-		return workspaceGuest, nil
+// startShell runs bash in the session container for a stateful session. The
+// shell is tagged so it can be killed even though exec processes outlive their
+// stream; commands carry their own tag and are not hit by that.
+func startShell(ctx context.Context, c *client, h sessionHandle) (*backend.Shell, error) {
+	tag := "shell-" + container.ExecToken(backend.ExecRequest{})
+	id, err := c.createExec(ctx, h.containerName, execConfig{
+		Cmd:          []string{"bash", "-l"},
+		Env:          []string{container.ExecIDEnv + "=" + tag},
+		WorkingDir:   h.defaultCwd,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("docker session shell: %w", err)
 	}
-	if strings.HasPrefix(requested, "/") {
-		return requested, nil
+	st, err := c.startExec(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("docker session shell: %w", err)
+	}
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	streamErr := make(chan error, 1)
+	go func() {
+		err := demux(st, stdoutW, stderrW)
+		_ = stdoutW.Close()
+		_ = stderrW.Close()
+		streamErr <- err
+	}()
+	shell, err := backend.AttachShell(ctx, backend.ShellProcess{
+		Stdin:  halfCloser{st},
+		Stdout: stdoutR,
+		Stderr: stderrR,
+		Wait: func() error {
+			err := <-streamErr
+			_ = st.Close()
+			if err != nil {
+				return err
+			}
+			code, err := c.execExitCode(id)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return fmt.Errorf("exit code %d", code)
+			}
+			return nil
+		},
+		Kill: func() error {
+			_ = killTaggedProcesses(c, h.containerName, tag, "KILL")
+			return st.Close()
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("docker session shell: %w", err)
 	}
+	return shell, nil
+}
 
-	hostPath := filepath.Clean(filepath.Join(projectRoot, requested))
-	rel, err := filepath.Rel(projectRoot, hostPath)
-	if err != nil {
-		return "", err
+// halfCloser ends the stdin of an exec stream on Close while its output keeps flowing.
+type halfCloser struct {
+	st *stream
+}
+
+func (h halfCloser) Write(p []byte) (int, error) {
+	return h.st.Write(p)
+}
+
+func (h halfCloser) Close() error {
+	return h.st.CloseWrite()
+}
+
+// execInShell runs req in the session's stateful shell. The command's processes
+// carry the exec tag, so cancellation kills them without killing the shell.
+func (h sessionHandle) execInShell(ctx context.Context, c *client, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	guestCwd := ""
+	if req.Cwd != "" {
+		var err error
+		if guestCwd, err = container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, "/workspace"); err != nil {
+			return backend.ExecResult{}, err
+		}
 	}
-	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-		return "", fmt.Errorf("cwd %s escapes project root %s", hostPath, projectRoot)
+	token := container.ExecToken(req)
+	req.Env = cloneMap(req.Env)
+	req.Env[container.ExecIDEnv] = token
+	result, err := h.shell.Exec(ctx, req, guestCwd, func() error {
+		return killTaggedProcesses(c, h.containerName, token, "KILL")
+	})
+	if err == nil {
+		result.Signal = container.SignalFromExitCode(result.ExitCode)
 	}
-	return filepath.ToSlash(filepath.Join(workspaceGuest, rel)), nil
+	return result, err
 }
 
-func envList(extra map[string]string) []string {
-	if len(extra) == 0 {
-		return nil
+// resolve applies session defaults and returns the guest cwd and environment for
+// req. Stateful sessions default to the shell's current directory and environment.
+func (h sessionHandle) resolve(spec backend.RuntimeSpec, req backend.ExecRequest) (string, map[string]string, error) {
+	guestCwd, defaultEnv := h.defaultCwd, h.defaultEnv
+	if h.shell != nil {
+		guestCwd, defaultEnv = h.shell.State()
 	}
-	keys := make([]string, 0, len(extra))
-	for k := range extra {
-		keys = append(keys, k)
+	if req.Cwd != "" {
+		var err error
+		guestCwd, err = container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, "/workspace")
+		if err != nil {
+			return "", nil, err
+		}
 	}
-	sort.Strings(keys)
-	out := make([]string, 0, len(keys))
-	for _, k := range keys {
-		out = append(out, k+"="+extra[k])
+	env := cloneMap(defaultEnv)
+	for k, v := range req.Env {
+		env[k] = v
 	}
-	return out
+	return guestCwd, env, nil
 }
 
-func buildMountArgs(spec backend.RuntimeSpec) ([]string, error) {
-	args := make([]string, 0, len(spec.Config.Mounts)*2)
+// buildBinds renders config mounts as host:guest:mode bind specifications.
+func buildBinds(spec backend.RuntimeSpec) ([]string, error) {
+	binds := make([]string, 0, len(spec.Config.Mounts))
 	for _, m := range spec.Config.Mounts {
 		hostPath := m.Host
 		if !filepath.IsAbs(hostPath) {
@@ -319,9 +670,9 @@ func buildMountArgs(spec backend.RuntimeSpec) ([]string, error) {
 		if _, err := os.Stat(hostPath); err != nil {
 			return nil, fmt.Errorf("mount host path does not exist: %s", hostPath)
 		}
-		args = append(args, "-v", fmt.Sprintf("%s:%s:%s", hostPath, m.Guest, m.Mode))
+		binds = append(binds, fmt.Sprintf("%s:%s:%s", hostPath, m.Guest, m.Mode))
 	}
-	return args, nil
+	return binds, nil
 }
 
 func cloneMap(in map[string]string) map[string]string {
@@ -334,22 +685,3 @@ func cloneMap(in map[string]string) map[string]string {
 	}
 	return out
 }
-
-func sanitizeName(in string) string {
-	if in == "" {
-		return "project"
-	}
-	in = strings.ToLower(in)
-	in = strings.ReplaceAll(in, " ", "-")
-	builder := strings.Builder{}
-	for _, ch := range in {
-		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' {
-			builder.WriteRune(ch)
-		}
-	}
-	out := builder.String()
-	if out == "" {
-		return "project"
-	}
-	return out
-}
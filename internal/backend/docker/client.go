@@ -0,0 +1,845 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vibebox/internal/backend/container"
+)
+
+// defaultSocket is the daemon socket used when no other endpoint is configured.
+const defaultSocket = "/var/run/docker.sock"
+
+// maxAPIVersion is the newest Engine API version the client is written
+// against; newer daemons are spoken to at this version.
+const maxAPIVersion = "1.47"
+
+// execPollInterval spaces exec inspections while the daemon records an exit.
+const execPollInterval = 20 * time.Millisecond
+
+// client speaks the Docker Engine HTTP API. The API version is negotiated on
+// the first call, unless DOCKER_API_VERSION pins it. Idle connections are
+// kept, which makes repeated execs cheap.
+type client struct {
+	network string
+	addr    string
+	// tls is set for tcp:// daemons reached over TLS.
+	tls *tls.Config
+	// dialCmd is the command whose stdio is the connection, for hosts only the
+	// docker CLI can reach (ssh://).
+	dialCmd []string
+	http    *http.Client
+
+	versionMu sync.Mutex
+	// prefix is the negotiated version path prefix, like "/v1.47"; it is
+	// empty for daemons that report no API version.
+	prefix     string
+	negotiated bool
+}
+
+// newClientFromEnv connects like the docker CLI; see resolveEndpoint.
+func newClientFromEnv() (*client, error) {
+	ep, err := resolveEndpoint(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newClient(ep.host, ep.tls)
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("DOCKER_API_VERSION"); v != "" {
+		c.prefix, c.negotiated = "/v"+strings.TrimPrefix(v, "v"), true
+	}
+	return c, nil
+}
+
+// newClient returns a client for a unix://, tcp:// or ssh:// daemon address.
+// tcp:// connections use tlsConfig when it is set; ssh:// connections go
+// through `docker system dial-stdio`, so they need the docker CLI.
+func newClient(host string, tlsConfig *tls.Config) (*client, error) {
+	network, addr, ok := strings.Cut(host, "://")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("invalid docker host %q", host)
+	}
+	c := &client{network: network, addr: addr}
+	switch network {
+	case "unix":
+	case "tcp":
+		c.addr = strings.TrimSuffix(addr, "/")
+		if tlsConfig != nil {
+			c.tls = tlsConfig.Clone()
+			if c.tls.ServerName == "" {
+				c.tls.ServerName, _, _ = net.SplitHostPort(c.addr)
+			}
+		}
+	case "ssh":
+		cli, err := exec.LookPath("docker")
+		if err != nil {
+			return nil, fmt.Errorf("docker host %q: ssh connections need the docker CLI: %w", host, err)
+		}
+		c.dialCmd = []string{cli, "--host", host, "system", "dial-stdio"}
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (expected unix://, tcp:// or ssh://)", host)
+	}
+	c.http = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return c.dial(ctx)
+		},
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     90 * time.Second,
+	}}
+	return c, nil
+}
+
+func (c *client) dial(ctx context.Context) (net.Conn, error) {
+	if c.dialCmd != nil {
+		return dialCommand(c.dialCmd)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.addr)
+	if err != nil || c.tls == nil {
+		return conn, err
+	}
+	tlsConn := tls.Client(conn, c.tls)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// cmdConn is a connection over the stdin and stdout of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	once   sync.Once
+}
+
+func dialCommand(argv []string) (net.Conn, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", strings.Join(argv, " "), err)
+	}
+	return &cmdConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *cmdConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *cmdConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// CloseWrite closes stdin, which dial-stdio passes on as a half-close.
+func (c *cmdConn) CloseWrite() error { return c.stdin.Close() }
+
+func (c *cmdConn) Close() error {
+	c.once.Do(func() {
+		_ = c.stdin.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr              { return cmdAddr{} }
+func (c *cmdConn) RemoteAddr() net.Addr             { return cmdAddr{} }
+func (c *cmdConn) SetDeadline(time.Time) error      { return nil }
+func (c *cmdConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *cmdConn) SetWriteDeadline(time.Time) error { return nil }
+
+type cmdAddr struct{}
+
+func (cmdAddr) Network() string { return "cmd" }
+func (cmdAddr) String() string  { return "docker system dial-stdio" }
+
+// apiError is an error response from the daemon.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker api: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isGone reports errors for containers that no longer exist or no longer run,
+// which teardown treats as already done.
+func isGone(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusConflict)
+}
+
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(data))
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		msg = body.Message
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &apiError{StatusCode: resp.StatusCode, Message: msg}
+}
+
+func requestURL(path string, query url.Values) string {
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// apiPrefix returns the version path prefix, negotiating it on first use.
+func (c *client) apiPrefix(ctx context.Context) (string, error) {
+	c.versionMu.Lock()
+	prefix, negotiated := c.prefix, c.negotiated
+	c.versionMu.Unlock()
+	if negotiated {
+		return prefix, nil
+	}
+	if err := c.ping(ctx); err != nil {
+		return "", err
+	}
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	return c.prefix, nil
+}
+
+// request sends a request and returns the response of a successful call; the
+// caller closes its body. Error statuses are returned as *apiError.
+func (c *client) request(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	prefix, err := c.apiPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, prefix, path, query, body, header)
+}
+
+// send is request with an explicit version prefix.
+func (c *client) send(ctx context.Context, method, prefix, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL(prefix+path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+// call sends in as a JSON body, when set, and decodes the response into out, when set.
+func (c *client) call(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	var header http.Header
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header = http.Header{"Content-Type": {"application/json"}}
+	}
+	resp, err := c.request(ctx, method, path, query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode docker api %s response: %w", path, err)
+	}
+	return nil
+}
+
+// stream is a connection taken over by an attach or exec start. Reads return
+// the process output; writes feed its stdin until CloseWrite.
+type stream struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	return s.conn.Write(p)
+}
+
+// CloseWrite half-closes the connection, which the daemon passes on to the
+// process as end of stdin.
+func (s *stream) CloseWrite() error {
+	if cw, ok := s.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (s *stream) Close() error {
+	return s.conn.Close()
+}
+
+// hijack sends a request that upgrades its connection to a raw stream. ctx
+// only bounds the handshake; close the stream to end it.
+func (c *client) hijack(ctx context.Context, path string, query url.Values, in any) (*stream, error) {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	prefix, err := c.apiPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("docker api POST %s: %w", path, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	req, err := http.NewRequest(http.MethodPost, requestURL(prefix+path, query), bytes.NewReader(data))
+	if err != nil {
+		stop()
+		_ = conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	br := bufio.NewReader(conn)
+	err = req.Write(conn)
+	var resp *http.Response
+	if err == nil {
+		resp, err = http.ReadResponse(br, req)
+	}
+	if !stop() {
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("docker api POST %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		err := decodeError(resp)
+		_ = conn.Close()
+		return nil, err
+	}
+	return &stream{conn: conn, r: br}, nil
+}
+
+// Stream types of the multiplexed attach protocol.
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+	streamSystem = 3
+)
+
+// demux splits a multiplexed (non-TTY) stream into stdout and stderr until EOF.
+// Each frame is an 8-byte header, holding the stream type and the big-endian
+// payload length, followed by the payload.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[4:]))
+		switch hdr[0] {
+		case streamStdin, streamStdout:
+			if _, err := io.CopyN(stdout, r, size); err != nil {
+				return err
+			}
+		case streamStderr:
+			if _, err := io.CopyN(stderr, r, size); err != nil {
+				return err
+			}
+		case streamSystem:
+			msg, _ := io.ReadAll(io.LimitReader(r, size))
+			return fmt.Errorf("docker stream error: %s", msg)
+		default:
+			return fmt.Errorf("docker stream: unknown stream type %d", hdr[0])
+		}
+	}
+}
+
+// serverInfo is the subset of GET /info reported by Probe.
+type serverInfo struct {
+	ServerVersion string
+	OSType        string
+	Architecture  string
+	// Runtimes is keyed by the names of the OCI runtimes registered with the daemon.
+	Runtimes map[string]struct{}
+}
+
+// ping checks the daemon and negotiates the API version: the older of the
+// daemon's API-Version and maxAPIVersion.
+func (c *client) ping(ctx context.Context) error {
+	resp, err := c.send(ctx, http.MethodGet, "", "/_ping", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	if !c.negotiated {
+		c.prefix, c.negotiated = versionPrefix(resp.Header.Get("API-Version")), true
+	}
+	return nil
+}
+
+// versionPrefix returns the path prefix for a daemon API version.
+func versionPrefix(server string) string {
+	if server == "" {
+		return ""
+	}
+	if compareVersions(server, maxAPIVersion) > 0 {
+		server = maxAPIVersion
+	}
+	return "/v" + server
+}
+
+// compareVersions compares dotted numeric versions like "1.47".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(as), len(bs)) {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return cmp.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func (c *client) info(ctx context.Context) (serverInfo, error) {
+	var info serverInfo
+	err := c.call(ctx, http.MethodGet, "/info", nil, nil, &info)
+	return info, err
+}
+
+func (c *client) imageExists(ctx context.Context, image string) (bool, error) {
+	err := c.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// imageID returns the ID of a local image.
+func (c *client) imageID(ctx context.Context, image string) (string, error) {
+	var info struct {
+		ID string `json:"Id"`
+	}
+	err := c.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, &info)
+	return info.ID, err
+}
+
+// splitImageRef splits an image reference into the repository and the tag or
+// digest to pull. Untagged references get "latest" like `docker pull`, since
+// the Engine API pulls every tag of a repository given without one.
+func splitImageRef(image string) (name, tag string) {
+	if name, digest, ok := strings.Cut(image, "@"); ok {
+		return name, digest
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// pullImage pulls image and writes one line per progress status to w. The
+// registry credential, when set, is the encoded X-Registry-Auth header.
+func (c *client) pullImage(ctx context.Context, image, registryAuth string, w io.Writer) error {
+	header := http.Header{}
+	if registryAuth != "" {
+		header.Set("X-Registry-Auth", registryAuth)
+	}
+	name, tag := splitImageRef(image)
+	resp, err := c.request(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {name}, "tag": {tag}}, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			ProgressDetail struct {
+				Total int64 `json:"total"`
+			} `json:"progressDetail"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode docker pull progress: %w", err)
+		}
+		if msg.ErrorDetail.Message != "" {
+			return errors.New(msg.ErrorDetail.Message)
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		// Byte counters arrive many times a second; only status changes are shown.
+		if msg.ProgressDetail.Total > 0 || msg.Status == "" {
+			continue
+		}
+		if msg.ID != "" {
+			fmt.Fprintf(w, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(w, msg.Status)
+		}
+	}
+}
+
+// containerConfig is the body of POST /containers/create.
+type containerConfig struct {
+	Image        string
+	Cmd          []string
+	Env          []string          `json:",omitempty"`
+	WorkingDir   string            `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	User         string            `json:",omitempty"`
+	Tty          bool
+	OpenStdin    bool
+	StdinOnce    bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	HostConfig   hostConfig
+}
+
+type hostConfig struct {
+	Binds      []string `json:",omitempty"`
+	AutoRemove bool     `json:",omitempty"`
+	// Init runs an init process as PID 1 that reaps orphaned processes.
+	Init bool `json:",omitempty"`
+	// ConsoleSize is the initial TTY size as [height, width].
+	ConsoleSize *[2]uint `json:",omitempty"`
+
+	NanoCPUs   int64    `json:"NanoCpus,omitempty"`
+	Memory     int64    `json:",omitempty"`
+	MemorySwap int64    `json:",omitempty"`
+	PidsLimit  *int64   `json:",omitempty"`
+	ShmSize    int64    `json:",omitempty"`
+	Ulimits    []ulimit `json:",omitempty"`
+
+	ReadonlyRootfs bool              `json:",omitempty"`
+	Tmpfs          map[string]string `json:",omitempty"`
+	CapAdd         []string          `json:",omitempty"`
+	CapDrop        []string          `json:",omitempty"`
+	SecurityOpt    []string          `json:",omitempty"`
+	Runtime        string            `json:",omitempty"`
+}
+
+type ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+func (c *client) createContainer(ctx context.Context, name string, cfg containerConfig) (string, error) {
+	var out struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/containers/create", url.Values{"name": {name}}, cfg, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// attachContainer attaches to the output, and stdin when requested, of a
+// created container. Attach before start so no output is lost.
+func (c *client) attachContainer(ctx context.Context, id string, stdin bool) (*stream, error) {
+	query := url.Values{"stream": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	if stdin {
+		query.Set("stdin", "1")
+	}
+	return c.hijack(ctx, "/containers/"+id+"/attach", query, nil)
+}
+
+func (c *client) startContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// waitContainer registers for the container's next exit and returns a function
+// that blocks until it happens. The daemon answers once the wait is registered,
+// so calling it before start cannot miss a fast exit.
+func (c *client) waitContainer(ctx context.Context, id string) (func() (int, error), error) {
+	resp, err := c.request(ctx, http.MethodPost, "/containers/"+id+"/wait", url.Values{"condition": {"next-exit"}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func() (int, error) {
+		defer resp.Body.Close()
+		var out struct {
+			StatusCode int
+			Error      *struct {
+				Message string
+			}
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return -1, fmt.Errorf("wait for docker container: %w", err)
+		}
+		if out.Error != nil && out.Error.Message != "" {
+			return -1, fmt.Errorf("wait for docker container: %s", out.Error.Message)
+		}
+		return out.StatusCode, nil
+	}, nil
+}
+
+// containerInfo is the subset of GET /containers/{id}/json used by the backend.
+type containerInfo struct {
+	Config struct {
+		Labels map[string]string
+	}
+	State container.State
+}
+
+func (c *client) inspectContainer(ctx context.Context, id string) (containerInfo, error) {
+	var info containerInfo
+	err := c.call(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &info)
+	return info, err
+}
+
+// containerSummary is the subset of GET /containers/json used by the backend.
+type containerSummary struct {
+	ID     string `json:"Id"`
+	Names  []string
+	Labels map[string]string
+}
+
+// listContainers returns every container, running or not, carrying label (key=value).
+func (c *client) listContainers(ctx context.Context, label string) ([]containerSummary, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	var out []containerSummary
+	err = c.call(ctx, http.MethodGet, "/containers/json", url.Values{"all": {"1"}, "filters": {string(filters)}}, nil, &out)
+	return out, err
+}
+
+// topContainer returns the command lines of the processes running in a container.
+func (c *client) topContainer(ctx context.Context, id string) ([]string, error) {
+	var out struct {
+		Titles    []string
+		Processes [][]string
+	}
+	if err := c.call(ctx, http.MethodGet, "/containers/"+id+"/top", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	column := slices.Index(out.Titles, "CMD")
+	if column < 0 {
+		return nil, fmt.Errorf("docker top %s: no CMD column", id)
+	}
+	cmds := make([]string, 0, len(out.Processes))
+	for _, p := range out.Processes {
+		if column < len(p) {
+			cmds = append(cmds, p[column])
+		}
+	}
+	return cmds, nil
+}
+
+// deleteContainer force-removes a container, killing it if it runs.
+func (c *client) deleteContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": {"1"}, "v": {"1"}}, nil, nil)
+}
+
+func (c *client) resizeContainer(ctx context.Context, id string, height, width int) error {
+	query := url.Values{"h": {fmt.Sprint(height)}, "w": {fmt.Sprint(width)}}
+	return c.call(ctx, http.MethodPost, "/containers/"+id+"/resize", query, nil, nil)
+}
+
+// execConfig is the body of POST /containers/{id}/exec.
+type execConfig struct {
+	Cmd          []string
+	Env          []string `json:",omitempty"`
+	WorkingDir   string   `json:",omitempty"`
+	User         string   `json:",omitempty"`
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+}
+
+// execInfo is the subset of GET /exec/{id}/json used by the backend.
+type execInfo struct {
+	Running  bool
+	ExitCode int
+}
+
+func (c *client) createExec(ctx context.Context, containerName string, cfg execConfig) (string, error) {
+	var out struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/containers/"+containerName+"/exec", nil, cfg, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// startExec starts an exec instance and returns its multiplexed stream.
+func (c *client) startExec(ctx context.Context, id string) (*stream, error) {
+	return c.hijack(ctx, "/exec/"+id+"/start", nil, map[string]bool{"Detach": false, "Tty": false})
+}
+
+// startExecDetached starts an exec instance without attaching to it.
+func (c *client) startExecDetached(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/exec/"+id+"/start", nil, map[string]bool{"Detach": true, "Tty": false}, nil)
+}
+
+func (c *client) inspectExec(ctx context.Context, id string) (execInfo, error) {
+	var info execInfo
+	err := c.call(ctx, http.MethodGet, "/exec/"+id+"/json", nil, nil, &info)
+	return info, err
+}
+
+// execExitCode returns the exit code of an exec whose stream has ended. The
+// daemon may record the exit shortly after closing the stream.
+func (c *client) execExitCode(id string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	for {
+		info, err := c.inspectExec(ctx, id)
+		if err != nil {
+			return -1, err
+		}
+		if !info.Running {
+			return info.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, fmt.Errorf("docker exec %s did not report an exit code", id)
+		case <-time.After(execPollInterval):
+		}
+	}
+}
+
+// getArchive returns a tar stream of path and its stat from the
+// X-Docker-Container-Path-Stat header.
+func (c *client) getArchive(ctx context.Context, containerName, path string) (io.ReadCloser, pathStat, error) {
+	resp, err := c.request(ctx, http.MethodGet, "/containers/"+containerName+"/archive", url.Values{"path": {path}}, nil, nil)
+	if err != nil {
+		return nil, pathStat{}, err
+	}
+	stat, err := decodePathStat(resp.Header.Get("X-Docker-Container-Path-Stat"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, pathStat{}, err
+	}
+	return resp.Body, stat, nil
+}
+
+// statPath returns the stat of path in a container without transferring it.
+func (c *client) statPath(ctx context.Context, containerName, path string) (pathStat, error) {
+	resp, err := c.request(ctx, http.MethodHead, "/containers/"+containerName+"/archive", url.Values{"path": {path}}, nil, nil)
+	if err != nil {
+		return pathStat{}, err
+	}
+	resp.Body.Close()
+	return decodePathStat(resp.Header.Get("X-Docker-Container-Path-Stat"))
+}
+
+// putArchive extracts a tar stream into the existing directory dir.
+func (c *client) putArchive(ctx context.Context, containerName, dir string, archive io.Reader) error {
+	resp, err := c.request(ctx, http.MethodPut, "/containers/"+containerName+"/archive", url.Values{"path": {dir}}, archive,
+		http.Header{"Content-Type": {"application/x-tar"}})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// pathStat is the X-Docker-Container-Path-Stat header of archive responses.
+type pathStat struct {
+	Name       string      `json:"name"`
+	Size       int64       `json:"size"`
+	Mode       fs.FileMode `json:"mode"`
+	Mtime      time.Time   `json:"mtime"`
+	LinkTarget string      `json:"linkTarget"`
+}
+
+func decodePathStat(header string) (pathStat, error) {
+	var stat pathStat
+	if header == "" {
+		return stat, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return stat, fmt.Errorf("decode docker path stat: %w", err)
+	}
+	if err := json.Unmarshal(data, &stat); err != nil {
+		return stat, fmt.Errorf("decode docker path stat: %w", err)
+	}
+	return stat, nil
+}
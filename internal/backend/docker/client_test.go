@@ -0,0 +1,928 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+	"vibebox/internal/config"
+)
+
+// fakeEngine serves the subset of the Engine API used by the backend. Every
+// container and exec behaves like `cat; echo <stdout>; echo <stderr> >&2; exit <exitCode>`,
+// unless local is set, in which case execs run their command on the host.
+type fakeEngine struct {
+	stdout   string
+	stderr   string
+	exitCode int
+	files    map[string]string
+	local    bool
+
+	mu         sync.Mutex
+	created    map[string]containerConfig
+	containers map[string]containerConfig
+	execs      map[string]execConfig
+	execCodes  map[string]int
+	waiting    map[string]chan struct{}
+	deleted    []string
+	// used holds the warm container use markers, top extra processes, by container.
+	used map[string]time.Time
+	top  map[string][]string
+	// pulls holds the query of every image pull.
+	pulls []url.Values
+	// images maps image references to IDs; others get an ID derived from the reference.
+	images map[string]string
+}
+
+func startFakeEngine(t *testing.T, f *fakeEngine) *client {
+	t.Helper()
+	f.created = map[string]containerConfig{}
+	f.containers = map[string]containerConfig{}
+	f.execs = map[string]execConfig{}
+	f.execCodes = map[string]int{}
+	f.waiting = map[string]chan struct{}{}
+	if f.used == nil {
+		f.used = map[string]time.Time{}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_ping", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "OK") })
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, serverInfo{ServerVersion: "28.0.1", OSType: "linux", Architecture: "x86_64", Runtimes: map[string]struct{}{"runc": {}}})
+	})
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		var cfg containerConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		f.mu.Lock()
+		f.created[name] = cfg
+		f.containers[name] = cfg
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]string{"Id": name})
+	})
+	mux.HandleFunc("POST /containers/{id}/attach", func(w http.ResponseWriter, r *http.Request) {
+		f.serveStream(w, r.URL.Query().Get("stdin") == "1")
+	})
+	mux.HandleFunc("POST /containers/{id}/wait", func(w http.ResponseWriter, r *http.Request) {
+		started := make(chan struct{})
+		f.mu.Lock()
+		f.waiting[r.PathValue("id")] = started
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-started
+		writeJSON(w, map[string]int{"StatusCode": f.exitCode})
+	})
+	mux.HandleFunc("POST /containers/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		started, ok := f.waiting[r.PathValue("id")]
+		kind := f.containers[r.PathValue("id")].Labels[container.LabelKind]
+		detached := kind == kindWarm || kind == container.KindSession
+		f.mu.Unlock()
+		if detached {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !ok {
+			http.Error(w, `{"message":"started before wait was registered"}`, http.StatusConflict)
+			return
+		}
+		close(started)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		cfg, ok := f.containers[r.PathValue("id")]
+		f.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"message":"No such container: `+r.PathValue("id")+`"}`, http.StatusNotFound)
+			return
+		}
+		info := containerInfo{State: container.State{Running: true, OOMKilled: true}}
+		info.Config.Labels = cfg.Labels
+		writeJSON(w, info)
+	})
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		out := []containerSummary{}
+		for name, cfg := range f.containers {
+			match := true
+			for _, label := range filters["label"] {
+				k, v, _ := strings.Cut(label, "=")
+				match = match && cfg.Labels[k] == v
+			}
+			if match {
+				out = append(out, containerSummary{ID: name, Names: []string{"/" + name}, Labels: cfg.Labels})
+			}
+		}
+		writeJSON(w, out)
+	})
+	mux.HandleFunc("GET /containers/{id}/top", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		procs := [][]string{{"1", "/sbin/docker-init -- sleep infinity"}, {"7", "sleep infinity"}}
+		for _, cmd := range f.top[r.PathValue("id")] {
+			procs = append(procs, []string{"9", cmd})
+		}
+		f.mu.Unlock()
+		writeJSON(w, map[string]any{"Titles": []string{"PID", "CMD"}, "Processes": procs})
+	})
+	mux.HandleFunc("GET /images/", func(w http.ResponseWriter, r *http.Request) {
+		image := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")
+		f.mu.Lock()
+		id, ok := f.images[image]
+		f.mu.Unlock()
+		if !ok {
+			sum := sha256.Sum256([]byte(image))
+			id = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		writeJSON(w, map[string]string{"Id": id})
+	})
+	mux.HandleFunc("POST /images/create", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.pulls = append(f.pulls, r.URL.Query())
+		f.mu.Unlock()
+		writeJSON(w, map[string]string{"status": "Pull complete", "id": r.URL.Query().Get("tag")})
+	})
+	mux.HandleFunc("DELETE /containers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := r.PathValue("id")
+		if _, ok := f.containers[id]; !ok {
+			http.Error(w, `{"message":"No such container: `+id+`"}`, http.StatusNotFound)
+			return
+		}
+		delete(f.containers, id)
+		f.deleted = append(f.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /containers/{id}/exec", func(w http.ResponseWriter, r *http.Request) {
+		var cfg execConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		id := fmt.Sprintf("exec%d", len(f.execs))
+		f.execs[id] = cfg
+		if strings.Contains(strings.Join(cfg.Cmd, " "), "touch "+warmUsedMarker) {
+			f.used[r.PathValue("id")] = time.Now()
+		}
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]string{"Id": id})
+	})
+	mux.HandleFunc("POST /exec/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		cfg := f.execs[r.PathValue("id")]
+		f.mu.Unlock()
+		// Like the daemon, consume the start options before taking over the connection.
+		_, _ = io.Copy(io.Discard, r.Body)
+		if f.local {
+			f.serveLocal(w, r.PathValue("id"), cfg)
+			return
+		}
+		f.serveStream(w, cfg.AttachStdin)
+	})
+	mux.HandleFunc("GET /exec/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		code, ok := f.execCodes[r.PathValue("id")]
+		f.mu.Unlock()
+		if !ok {
+			code = f.exitCode
+		}
+		writeJSON(w, execInfo{ExitCode: code})
+	})
+	mux.HandleFunc("GET /containers/{id}/archive", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("path")
+		if name == warmUsedMarker {
+			f.mu.Lock()
+			used, ok := f.used[r.PathValue("id")]
+			f.mu.Unlock()
+			if !ok {
+				http.Error(w, `{"message":"Could not find the file `+name+` in container"}`, http.StatusNotFound)
+				return
+			}
+			stat, _ := json.Marshal(pathStat{Name: filepath.Base(name), Mtime: used})
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+			return
+		}
+		content, ok := f.files[name]
+		if !ok {
+			http.Error(w, `{"message":"Could not find the file `+name+` in container"}`, http.StatusNotFound)
+			return
+		}
+		stat, _ := json.Marshal(pathStat{Name: filepath.Base(name), Size: int64(len(content)), Mode: 0o644})
+		w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+		tw := tar.NewWriter(w)
+		_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: filepath.Base(name), Size: int64(len(content)), Mode: 0o644})
+		_, _ = io.WriteString(tw, content)
+		_ = tw.Close()
+	})
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	c, err := newClient("unix://"+socket, nil)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c
+}
+
+// serveStream upgrades the connection and plays the fake program on it.
+func (f *fakeEngine) serveStream(w http.ResponseWriter, stdin bool) {
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.multiplexed-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	_ = buf.Flush()
+	if stdin {
+		input, _ := io.ReadAll(buf)
+		writeFrame(conn, streamStdout, string(input))
+	}
+	writeFrame(conn, streamStdout, f.stdout)
+	writeFrame(conn, streamStderr, f.stderr)
+}
+
+// serveLocal runs an exec on the host and streams it like the daemon does.
+func (f *fakeEngine) serveLocal(w http.ResponseWriter, id string, cfg execConfig) {
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	_ = buf.Flush()
+	var mu sync.Mutex
+	cmd := exec.Command(cfg.Cmd[0], cfg.Cmd[1:]...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Dir = cfg.WorkingDir
+	cmd.Stdout = frameWriter{conn: conn, kind: streamStdout, mu: &mu}
+	cmd.Stderr = frameWriter{conn: conn, kind: streamStderr, mu: &mu}
+	if cfg.AttachStdin {
+		cmd.Stdin = buf
+	}
+	code := 0
+	if err := cmd.Run(); err != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	f.mu.Lock()
+	f.execCodes[id] = code
+	f.mu.Unlock()
+}
+
+type frameWriter struct {
+	conn net.Conn
+	kind byte
+	mu   *sync.Mutex
+}
+
+func (w frameWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	writeFrame(w.conn, w.kind, string(p))
+	return len(p), nil
+}
+
+func writeFrame(w io.Writer, kind byte, payload string) {
+	if payload == "" {
+		return
+	}
+	hdr := make([]byte, 8)
+	hdr[0] = kind
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(payload)))
+	_, _ = w.Write(append(hdr, payload...))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func freshSpec() backend.RuntimeSpec {
+	spec := testSpec()
+	spec.Config.Docker.FreshContainers = true
+	return spec
+}
+
+func testSpec() backend.RuntimeSpec {
+	return backend.RuntimeSpec{
+		ProjectRoot: "/src/demo",
+		ProjectName: "Demo",
+		Config:      config.Config{Docker: config.DockerConfig{Image: "debian:13"}},
+	}
+}
+
+func TestExecRunsOneShotContainer(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{stdout: "out\n", stderr: "err\n", exitCode: 3}
+	b := &Backend{api: startFakeEngine(t, f)}
+
+	res, err := b.Exec(context.Background(), freshSpec(), backend.ExecRequest{
+		ExecID: "abc",
+		Args:   []string{"cat"},
+		Env:    map[string]string{"FOO": "1"},
+		Cwd:    "sub",
+		Stdin:  strings.NewReader("in\n"),
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if res.ExitCode != 3 || res.Stdout != "in\nout\n" || res.Stderr != "err\n" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if len(f.deleted) != 1 || f.deleted[0] != "vibebox-x-demo-abc" {
+		t.Fatalf("expected the exec container to be removed, got %v", f.deleted)
+	}
+}
+
+func TestExecSendsContainerConfig(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{}
+	b := &Backend{api: startFakeEngine(t, f)}
+
+	if _, err := b.Exec(context.Background(), freshSpec(), backend.ExecRequest{ExecID: "abc", Command: "ls"}); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	cfg, ok := f.created["vibebox-x-demo-abc"]
+	if !ok {
+		t.Fatalf("expected container vibebox-x-demo-abc, got %v", f.created)
+	}
+	if cfg.Image != "debian:13" || strings.Join(cfg.Cmd, " ") != "/bin/bash -lc ls" || cfg.WorkingDir != "/workspace" {
+		t.Fatalf("unexpected container config: %+v", cfg)
+	}
+	if cfg.AttachStdin || cfg.OpenStdin || cfg.HostConfig.AutoRemove {
+		t.Fatalf("exec containers without stdin must not attach it and are removed explicitly: %+v", cfg)
+	}
+	if cfg.Labels[container.LabelExec] != "abc" || cfg.Labels[container.LabelKind] != container.KindExec || cfg.Labels[container.LabelProject] != "demo" {
+		t.Fatalf("unexpected labels: %v", cfg.Labels)
+	}
+}
+
+func TestExecReusesWarmContainer(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{stdout: "out\n"}
+	b := &Backend{api: startFakeEngine(t, f)}
+	spec := testSpec()
+	name := warmContainerName(spec)
+
+	for i := range 2 {
+		res, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: fmt.Sprint(i), Command: "ls"})
+		if err != nil {
+			t.Fatalf("exec %d: %v", i, err)
+		}
+		if res.ExitCode != 0 || res.Stdout != "out\n" {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+	}
+	cfg, ok := f.created[name]
+	if !ok || len(f.created) != 1 || len(f.deleted) != 0 {
+		t.Fatalf("expected one warm container %s, created %v, deleted %v", name, f.created, f.deleted)
+	}
+	if cfg.Labels[container.LabelKind] != kindWarm || cfg.Labels[labelConfigHash] == "" || cfg.Labels[labelIdleTimeout] != "30m0s" || !cfg.HostConfig.Init {
+		t.Fatalf("unexpected warm container config: %+v", cfg)
+	}
+	if exec := f.execs["exec0"]; !slices.Equal(exec.Cmd[3:], []string{"sh", "/bin/bash", "-lc", "ls"}) || exec.WorkingDir != "/workspace" {
+		t.Fatalf("unexpected exec config: %+v", exec)
+	}
+	// Killing leftover jobs and recording the use happen in the command's own exec.
+	if len(f.execs) != 2 || f.used[name].IsZero() {
+		t.Fatalf("expected one exec per command that records the use, got %d execs, used %v", len(f.execs), f.used)
+	}
+
+	spec.Config.Docker.Image = "debian:14"
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "2", Command: "ls"}); err != nil {
+		t.Fatalf("exec after config change: %v", err)
+	}
+	if len(f.deleted) != 1 || f.deleted[0] != name || f.created[name].Image != "debian:14" {
+		t.Fatalf("expected the warm container to be recreated, deleted %v, config %+v", f.deleted, f.created[name])
+	}
+
+	// A pull that moves the tag to a new image replaces the container as well.
+	f.mu.Lock()
+	f.images = map[string]string{"debian:14": "sha256:0123456789abcdef"}
+	f.mu.Unlock()
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "3", Command: "ls"}); err != nil {
+		t.Fatalf("exec after pull: %v", err)
+	}
+	if len(f.deleted) != 2 || f.deleted[1] != name {
+		t.Fatalf("expected the warm container to be recreated after the pull, deleted %v", f.deleted)
+	}
+}
+
+func TestWarmContainerRemovedWhenUserEntryFails(t *testing.T) {
+	t.Parallel()
+	// Every exec exits 1, so adding the passwd entry fails.
+	f := &fakeEngine{exitCode: 1}
+	b := &Backend{api: startFakeEngine(t, f)}
+	spec := testSpec()
+	spec.Config.Docker.User = "1000:100"
+	name := warmContainerName(spec)
+
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "1", Command: "ls"}); err == nil {
+		t.Fatalf("expected the exec to fail")
+	}
+	if _, ok := f.containers[name]; ok || !slices.Contains(f.deleted, name) {
+		t.Fatalf("expected warm container %s to be removed, deleted %v", name, f.deleted)
+	}
+}
+
+func TestWarmContainersExpireWhenIdle(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{top: map[string][]string{"vibebox-w-busy-1": {"python train.py"}}}
+	b := &Backend{api: startFakeEngine(t, f)}
+	spec := testSpec()
+	warm := map[string]string{container.LabelKind: kindWarm, labelIdleTimeout: "30m0s"}
+	for _, name := range []string{"vibebox-w-idle-1", "vibebox-w-recent-1", "vibebox-w-busy-1"} {
+		f.containers[name] = containerConfig{Labels: warm}
+	}
+	f.containers["vibebox-s-demo-1"] = containerConfig{Labels: map[string]string{container.LabelKind: container.KindSession}}
+	f.used["vibebox-w-recent-1"] = time.Now()
+
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "1", Command: "ls"}); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if strings.Join(f.deleted, ",") != "vibebox-w-idle-1" {
+		t.Fatalf("expected the idle warm container to be reaped, deleted %v", f.deleted)
+	}
+
+	removed, err := b.Cleanup(context.Background(), false)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("recent, busy and just used containers are not idle: %v %v", removed, err)
+	}
+	removed, err = b.Cleanup(context.Background(), true)
+	if err != nil {
+		t.Fatalf("cleanup all: %v", err)
+	}
+	slices.Sort(removed)
+	if want := []string{"vibebox-w-busy-1", "vibebox-w-recent-1", warmContainerName(spec)}; !slices.Equal(removed, slices.Sorted(slices.Values(want))) {
+		t.Fatalf("expected %v removed, got %v", want, removed)
+	}
+	if _, ok := f.containers["vibebox-s-demo-1"]; !ok {
+		t.Fatalf("session containers must be left alone")
+	}
+}
+
+func TestContainersCarryResourceLimits(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{}
+	b := &Backend{api: startFakeEngine(t, f)}
+	spec := testSpec()
+	spec.Config.Docker.CPUs = 1.5
+	spec.Config.Docker.MemoryMB = 512
+	spec.Config.Docker.PidsLimit = 100
+	spec.Config.Docker.ShmSizeMB = 64
+	spec.Config.Docker.Ulimits = []config.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}}
+
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "1", Command: "ls"}); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	spec.Config.Docker.FreshContainers = true
+	if _, err := b.Exec(context.Background(), spec, backend.ExecRequest{ExecID: "abc", Command: "ls"}); err != nil {
+		t.Fatalf("fresh exec: %v", err)
+	}
+	if len(f.created) != 2 {
+		t.Fatalf("expected a warm and a fresh container, got %v", f.created)
+	}
+	for name, cfg := range f.created {
+		hc := cfg.HostConfig
+		if hc.NanoCPUs != 1_500_000_000 || hc.Memory != 512<<20 || hc.MemorySwap != hc.Memory || hc.ShmSize != 64<<20 {
+			t.Fatalf("%s: unexpected limits: %+v", name, hc)
+		}
+		if hc.PidsLimit == nil || *hc.PidsLimit != 100 || len(hc.Ulimits) != 1 || hc.Ulimits[0] != (ulimit{Name: "nofile", Soft: 1024, Hard: 2048}) {
+			t.Fatalf("%s: unexpected limits: %+v", name, hc)
+		}
+	}
+}
+
+func TestHardenedSecurityPreset(t *testing.T) {
+	t.Parallel()
+	spec := testSpec()
+	spec.ProjectRoot = t.TempDir()
+	spec.Config.Docker.Security = config.DockerSecurity{
+		Preset:         config.DockerSecurityHardened,
+		CapAdd:         []string{"NET_BIND_SERVICE"},
+		SeccompProfile: "seccomp.json",
+		Runtime:        "runsc",
+	}
+	if err := os.WriteFile(filepath.Join(spec.ProjectRoot, "seccomp.json"), []byte("{\n  \"defaultAction\": \"SCMP_ACT_ERRNO\"\n}\n"), 0o644); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+
+	cfg, err := newContainerConfig(spec)
+	if err != nil {
+		t.Fatalf("container config: %v", err)
+	}
+	hc := cfg.HostConfig
+	if !hc.ReadonlyRootfs || len(hc.Tmpfs) != len(config.HardenedTmpfs) || hc.Tmpfs["/tmp"] != "mode=1777,exec" {
+		t.Fatalf("expected a read-only rootfs with tmpfs mounts: %+v", hc)
+	}
+	if strings.Join(hc.CapDrop, ",") != "ALL" || strings.Join(hc.CapAdd, ",") != "NET_BIND_SERVICE" || hc.Runtime != "runsc" {
+		t.Fatalf("unexpected capabilities or runtime: %+v", hc)
+	}
+	want := []string{"no-new-privileges=true", `seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`}
+	if strings.Join(hc.SecurityOpt, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("security options = %q, want %q", hc.SecurityOpt, want)
+	}
+
+	spec.Config.Docker.Security.SeccompProfile = "missing.json"
+	if _, err := newContainerConfig(spec); err == nil {
+		t.Fatalf("expected a missing seccomp profile to fail")
+	}
+}
+
+func TestCheckConfigReportsMissingRuntime(t *testing.T) {
+	t.Parallel()
+	b := &Backend{api: startFakeEngine(t, &fakeEngine{})}
+	cfg := testSpec().Config
+	if err := b.CheckConfig(context.Background(), cfg); err != nil {
+		t.Fatalf("no runtime configured: %v", err)
+	}
+	cfg.Docker.Security.Runtime = "runc"
+	if err := b.CheckConfig(context.Background(), cfg); err != nil {
+		t.Fatalf("runc is registered: %v", err)
+	}
+	cfg.Docker.Security.Runtime = "runsc"
+	if err := b.CheckConfig(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "runsc") {
+		t.Fatalf("expected runsc to be reported missing, got %v", err)
+	}
+}
+
+func TestHostUserSession(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{}
+	b := &Backend{api: startFakeEngine(t, f)}
+	spec := testSpec()
+	spec.ProjectRoot = t.TempDir()
+	spec.Config.Docker.User = "1000:100"
+
+	if _, err := b.StartSession(context.Background(), spec, backend.SessionStartRequest{SessionID: "1", Env: map[string]string{"A": "1"}}); err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	cfg := f.created["vibebox-s-demo-1"]
+	if cfg.User != "1000:100" || cfg.HostConfig.Tmpfs[guestHome] != "uid=1000,gid=100,mode=0755,exec" {
+		t.Fatalf("unexpected container user or HOME tmpfs: %+v", cfg)
+	}
+	if strings.Join(cfg.Env, ",") != "IS_SANDBOX=1,HOME="+guestHome+",A=1" {
+		t.Fatalf("expected HOME before the session env: %v", cfg.Env)
+	}
+	if entry := f.execs["exec0"]; entry.User != "0:0" || !strings.Contains(strings.Join(entry.Cmd, " "), "/etc/passwd") {
+		t.Fatalf("expected a passwd entry to be added as root: %+v", entry)
+	}
+
+	spec.Config.Docker.User = config.DockerUserHost
+	cfg, err := newContainerConfig(spec)
+	if err != nil {
+		t.Fatalf("container config: %v", err)
+	}
+	if want := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()); cfg.User != want {
+		t.Fatalf("container user = %q, want %q", cfg.User, want)
+	}
+	spec.Config.Docker.User = config.DockerUserRoot
+	spec.Config.Docker.Security.Preset = config.DockerSecurityHardened
+	cfg, err = newContainerConfig(spec)
+	if err != nil {
+		t.Fatalf("container config: %v", err)
+	}
+	if cfg.User != "0:0" || cfg.HostConfig.Tmpfs[guestHome] != "uid=0,gid=0,mode=0755,exec" || !slices.Contains(cfg.Env, "HOME="+guestHome) {
+		t.Fatalf("root needs a writable HOME on a read-only rootfs: %+v", cfg)
+	}
+}
+
+func TestExecInSessionUsesExecAPI(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{stdout: "hi\n", exitCode: 137}
+	b := &Backend{api: startFakeEngine(t, f)}
+	f.containers["vibebox-s-demo-1"] = containerConfig{}
+	h := sessionHandle{containerName: "vibebox-s-demo-1", defaultCwd: "/workspace", defaultEnv: map[string]string{"A": "1"}}
+
+	res, err := b.ExecInSession(context.Background(), testSpec(), h, backend.ExecRequest{ExecID: "tok", Command: "echo hi"})
+	if err != nil {
+		t.Fatalf("exec in session: %v", err)
+	}
+	// The container reports OOMKilled, but that may stem from another exec.
+	if res.ExitCode != 137 || res.Signal != "KILL" || res.OOMKilled || res.Stdout != "hi\n" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	cfg := f.execs["exec0"]
+	if cfg.WorkingDir != "/workspace" || strings.Join(cfg.Env, ",") != "A=1,VIBEBOX_EXEC_ID=tok" {
+		t.Fatalf("unexpected exec config: %+v", cfg)
+	}
+}
+
+func TestStatefulShellOverExecStream(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	dir := t.TempDir()
+	f := &fakeEngine{local: true}
+	c := startFakeEngine(t, f)
+	h := sessionHandle{containerName: "vibebox-s-demo-1", defaultCwd: dir}
+	shell, err := startShell(context.Background(), c, h)
+	if err != nil {
+		t.Fatalf("start shell: %v", err)
+	}
+	h.shell = shell
+	defer shell.Close()
+
+	spec := testSpec()
+	if _, err := h.execInShell(context.Background(), c, spec, backend.ExecRequest{Command: "mkdir -p sub && cd sub && export FOO=bar"}); err != nil {
+		t.Fatalf("first command: %v", err)
+	}
+	res, err := h.execInShell(context.Background(), c, spec, backend.ExecRequest{Command: `echo "$FOO"; exit_code=4; (exit 4)`})
+	if err != nil {
+		t.Fatalf("second command: %v", err)
+	}
+	if res.ExitCode != 4 || res.Stdout != "bar\n" || res.Cwd != filepath.Join(dir, "sub") || res.Env["FOO"] != "bar" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestAPIErrorsAreStructured(t *testing.T) {
+	t.Parallel()
+	f := &fakeEngine{files: map[string]string{"/workspace/a.txt": "data"}}
+	b := &Backend{api: startFakeEngine(t, f)}
+	h := sessionHandle{containerName: "gone"}
+
+	if err := b.StopSession(context.Background(), testSpec(), h); err != nil {
+		t.Fatalf("stopping a removed session should succeed, got %v", err)
+	}
+	data, err := b.ReadFile(context.Background(), testSpec(), h, "a.txt")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("read file: %q, %v", data, err)
+	}
+	if _, err := b.ReadFile(context.Background(), testSpec(), h, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	_, err = b.ResumeSession(context.Background(), testSpec(), []byte(`{"containerName":"gone"}`))
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a 404 api error, got %v", err)
+	}
+}
+
+func TestPullImageSendsTag(t *testing.T) {
+	t.Parallel()
+	const digest = "sha256:9b8dec3bf938bc80fbe758d856e96fdfab5f56c39d44b0cff351e847bb1b01ea"
+	tests := []struct {
+		image string
+		name  string
+		tag   string
+	}{
+		{image: "ubuntu", name: "ubuntu", tag: "latest"},
+		{image: "ubuntu:24.04", name: "ubuntu", tag: "24.04"},
+		{image: "localhost:5000/team/tool", name: "localhost:5000/team/tool", tag: "latest"},
+		{image: "localhost:5000/team/tool:v2", name: "localhost:5000/team/tool", tag: "v2"},
+		{image: "ghcr.io/org/app@" + digest, name: "ghcr.io/org/app", tag: digest},
+		{image: "ubuntu:24.04@" + digest, name: "ubuntu:24.04", tag: digest},
+	}
+	f := &fakeEngine{}
+	c := startFakeEngine(t, f)
+	for _, tt := range tests {
+		var progress bytes.Buffer
+		if err := c.pullImage(context.Background(), tt.image, "", &progress); err != nil {
+			t.Fatalf("pull %s: %v", tt.image, err)
+		}
+		f.mu.Lock()
+		query := f.pulls[len(f.pulls)-1]
+		f.mu.Unlock()
+		if query.Get("fromImage") != tt.name || query.Get("tag") != tt.tag {
+			t.Fatalf("pull %s: expected fromImage=%s tag=%s, got %v", tt.image, tt.name, tt.tag, query)
+		}
+		if !strings.Contains(progress.String(), "Pull complete") {
+			t.Fatalf("pull %s: unexpected progress %q", tt.image, progress.String())
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+	b := &Backend{api: startFakeEngine(t, &fakeEngine{})}
+	res := b.Probe(context.Background())
+	if !res.Available || res.Runtime.Version != "28.0.1" || res.Runtime.Arch != "x86_64" {
+		t.Fatalf("unexpected probe result: %+v", res)
+	}
+
+	c, err := newClient("unix://"+filepath.Join(t.TempDir(), "missing.sock"), nil)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	res = (&Backend{api: c}).Probe(context.Background())
+	if res.Available || res.Reason != "docker daemon socket not found" {
+		t.Fatalf("unexpected probe result: %+v", res)
+	}
+}
+
+func TestNewClientRejectsUnsupportedHosts(t *testing.T) {
+	t.Parallel()
+	for _, host := range []string{"npipe:////./pipe/docker_engine", "http://host", "/var/run/docker.sock"} {
+		if _, err := newClient(host, nil); err == nil {
+			t.Fatalf("expected %q to be rejected", host)
+		}
+	}
+}
+
+func TestDemux(t *testing.T) {
+	t.Parallel()
+	var in bytes.Buffer
+	writeFrame(&in, streamStdout, "a")
+	writeFrame(&in, streamStderr, "b")
+	writeFrame(&in, streamStdout, "c")
+	var stdout, stderr bytes.Buffer
+	if err := demux(&in, &stdout, &stderr); err != nil {
+		t.Fatalf("demux: %v", err)
+	}
+	if stdout.String() != "ac" || stderr.String() != "b" {
+		t.Fatalf("unexpected streams: %q %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestClientNegotiatesAPIVersion(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{server: "1.51", want: "/v1.47/info"},
+		{server: "1.41", want: "/v1.41/info"},
+		{server: "", want: "/info"},
+	}
+	for _, tt := range tests {
+		t.Run("server "+tt.server, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var paths []string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				if r.URL.Path == "/_ping" && tt.server != "" {
+					w.Header().Set("API-Version", tt.server)
+				}
+				writeJSON(w, serverInfo{ServerVersion: "28.0.1"})
+			})
+			socket := filepath.Join(t.TempDir(), "docker.sock")
+			ln, err := net.Listen("unix", socket)
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			srv := &http.Server{Handler: handler}
+			go func() { _ = srv.Serve(ln) }()
+			t.Cleanup(func() { _ = srv.Close() })
+
+			c, err := newClient("unix://"+socket, nil)
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			if _, err := c.info(context.Background()); err != nil {
+				t.Fatalf("info: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(paths) != 2 || paths[0] != "/_ping" || paths[1] != tt.want {
+				t.Fatalf("expected ping then %s, got %q", tt.want, paths)
+			}
+		})
+	}
+}
+
+func TestClientDialsThroughCommand(t *testing.T) {
+	t.Parallel()
+	c, err := newClient("unix:///unused.sock", nil)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	// Stands in for `docker system dial-stdio`, answering the ping on its stdout.
+	c.dialCmd = []string{"/bin/sh", "-c", `printf 'HTTP/1.1 200 OK\r\nApi-Version: 1.45\r\nContent-Length: 2\r\n\r\nOK'; exec cat >/dev/null`}
+	if err := c.ping(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if c.prefix != "/v1.45" {
+		t.Fatalf("expected negotiated prefix /v1.45, got %q", c.prefix)
+	}
+	c.http.CloseIdleConnections()
+}
+
+// writeDockerContext stores a CLI context the way `docker context create` does.
+func writeDockerContext(t *testing.T, configDir, name, host string, skipTLSVerify bool) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(name))
+	dir := filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	meta := map[string]any{
+		"Name":      name,
+		"Endpoints": map[string]any{"docker": map[string]any{"Host": host, "SkipTLSVerify": skipTLSVerify}},
+	}
+	data, _ := json.Marshal(meta)
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), data, 0o644); err != nil {
+		t.Fatalf("write meta: %v", err)
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	t.Parallel()
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"currentContext":"colima"}`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	writeDockerContext(t, configDir, "colima", "unix:///home/me/.colima/default/docker.sock", false)
+	writeDockerContext(t, configDir, "remote", "tcp://build.example:2376", true)
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantHost string
+		wantTLS  bool
+		verify   bool
+		wantErr  bool
+	}{
+		{name: "current context", env: map[string]string{}, wantHost: "unix:///home/me/.colima/default/docker.sock"},
+		{name: "DOCKER_CONTEXT", env: map[string]string{"DOCKER_CONTEXT": "remote"}, wantHost: "tcp://build.example:2376", wantTLS: true},
+		{name: "DOCKER_HOST wins", env: map[string]string{"DOCKER_HOST": "tcp://10.0.0.1:2375", "DOCKER_CONTEXT": "remote"}, wantHost: "tcp://10.0.0.1:2375"},
+		{name: "DOCKER_TLS_VERIFY", env: map[string]string{"DOCKER_HOST": "tcp://10.0.0.1:2376", "DOCKER_TLS_VERIFY": "1"}, wantHost: "tcp://10.0.0.1:2376", wantTLS: true, verify: true},
+		{name: "missing context", env: map[string]string{"DOCKER_CONTEXT": "gone"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := map[string]string{"DOCKER_CONFIG": configDir}
+			maps.Copy(env, tt.env)
+			ep, err := resolveEndpoint(func(k string) string { return env[k] })
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", ep)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve endpoint: %v", err)
+			}
+			if ep.host != tt.wantHost {
+				t.Fatalf("expected host %s, got %s", tt.wantHost, ep.host)
+			}
+			if (ep.tls != nil) != tt.wantTLS || (ep.tls != nil && ep.tls.InsecureSkipVerify == tt.verify) {
+				t.Fatalf("unexpected tls config: %+v", ep.tls)
+			}
+		})
+	}
+}
+
+func TestResolveEndpointDefaultsToRootlessSocket(t *testing.T) {
+	t.Parallel()
+	if _, err := os.Stat(defaultSocket); err == nil {
+		t.Skip("system docker socket exists")
+	}
+	runtimeDir := t.TempDir()
+	socket := filepath.Join(runtimeDir, "docker.sock")
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatalf("write socket: %v", err)
+	}
+	env := map[string]string{"DOCKER_CONFIG": t.TempDir(), "DOCKER_CONTEXT": "default", "XDG_RUNTIME_DIR": runtimeDir}
+	ep, err := resolveEndpoint(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("resolve endpoint: %v", err)
+	}
+	if ep.host != "unix://"+socket || ep.tls != nil {
+		t.Fatalf("expected rootless socket, got %+v", ep)
+	}
+}
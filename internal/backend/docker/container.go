@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+const mib = 1 << 20
+
+// newContainerConfig returns the settings shared by every container of spec:
+// image, user, mounts, resource limits and security options.
+func newContainerConfig(spec backend.RuntimeSpec) (containerConfig, error) {
+	binds, err := buildBinds(spec)
+	if err != nil {
+		return containerConfig{}, err
+	}
+	user, err := guestUser(spec.Config.Docker)
+	if err != nil {
+		return containerConfig{}, err
+	}
+	hc, err := withSecurity(withLimits(hostConfig{Binds: binds}, spec.Config.Docker), spec)
+	if err != nil {
+		return containerConfig{}, err
+	}
+	cfg := containerConfig{
+		Image:      spec.Config.Docker.Image,
+		Env:        []string{"IS_SANDBOX=1"},
+		HostConfig: hc,
+	}
+	return withUser(cfg, user), nil
+}
+
+// withLimits applies the configured resource limits to hc.
+func withLimits(hc hostConfig, cfg config.DockerConfig) hostConfig {
+	hc.NanoCPUs = int64(cfg.CPUs * 1e9)
+	hc.Memory = int64(cfg.MemoryMB) * mib
+	// Equal to Memory, so the container cannot use swap beyond its limit.
+	hc.MemorySwap = hc.Memory
+	if cfg.PidsLimit > 0 {
+		limit := int64(cfg.PidsLimit)
+		hc.PidsLimit = &limit
+	}
+	hc.ShmSize = int64(cfg.ShmSizeMB) * mib
+	for _, u := range cfg.Ulimits {
+		hc.Ulimits = append(hc.Ulimits, ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	return hc
+}
+
+// withSecurity applies docker.security, after expanding its preset, to hc.
+func withSecurity(hc hostConfig, spec backend.RuntimeSpec) (hostConfig, error) {
+	sec := spec.Config.Docker.Security.Resolved()
+	hc.ReadonlyRootfs = config.Enabled(sec.ReadOnlyRootfs)
+	for _, t := range sec.Tmpfs {
+		if hc.Tmpfs == nil {
+			hc.Tmpfs = map[string]string{}
+		}
+		path, options, _ := strings.Cut(t, ":")
+		hc.Tmpfs[path] = options
+	}
+	hc.CapDrop = sec.CapDrop
+	hc.CapAdd = sec.CapAdd
+	if config.Enabled(sec.NoNewPrivileges) {
+		hc.SecurityOpt = append(hc.SecurityOpt, "no-new-privileges=true")
+	}
+	if sec.SeccompProfile != "" {
+		// The daemon expects the profile itself rather than a path, like the CLI sends it.
+		path := sec.SeccompProfile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(spec.ProjectRoot, path)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return hostConfig{}, fmt.Errorf("read docker.security.seccomp_profile: %w", err)
+		}
+		var profile bytes.Buffer
+		if err := json.Compact(&profile, raw); err != nil {
+			return hostConfig{}, fmt.Errorf("parse docker.security.seccomp_profile %s: %w", path, err)
+		}
+		hc.SecurityOpt = append(hc.SecurityOpt, "seccomp="+profile.String())
+	}
+	hc.Runtime = sec.Runtime
+	return hc, nil
+}
@@ -0,0 +1,165 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// endpoint is a daemon address with the TLS settings used to reach it.
+type endpoint struct {
+	host string
+	// tls is nil for plain connections.
+	tls *tls.Config
+}
+
+// dockerConfigDir returns the docker CLI config directory: DOCKER_CONFIG or ~/.docker.
+func dockerConfigDir(getenv func(string) string) (string, error) {
+	if dir := getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// resolveEndpoint picks the daemon like the docker CLI: DOCKER_HOST, then the
+// context named by DOCKER_CONTEXT or the currentContext of the CLI config
+// (Colima, OrbStack and Rancher Desktop register one), then the default sockets.
+func resolveEndpoint(getenv func(string) string) (endpoint, error) {
+	configDir, configErr := dockerConfigDir(getenv)
+	if host := getenv("DOCKER_HOST"); host != "" {
+		tlsConfig, err := envTLSConfig(getenv, configDir)
+		if err != nil {
+			return endpoint{}, err
+		}
+		return endpoint{host: host, tls: tlsConfig}, nil
+	}
+	if configErr == nil {
+		name := getenv("DOCKER_CONTEXT")
+		if name == "" {
+			name = currentContext(configDir)
+		}
+		if name != "" && name != "default" {
+			return contextEndpoint(configDir, name)
+		}
+	}
+	return endpoint{host: defaultHost(getenv)}, nil
+}
+
+// envTLSConfig returns the TLS settings of DOCKER_TLS_VERIFY, which verifies
+// the daemon, and DOCKER_TLS, which does not. Client certificates are read
+// from DOCKER_CERT_PATH, by default the CLI config directory.
+func envTLSConfig(getenv func(string) string, configDir string) (*tls.Config, error) {
+	verify := getenv("DOCKER_TLS_VERIFY") != ""
+	if !verify && getenv("DOCKER_TLS") == "" {
+		return nil, nil
+	}
+	dir := getenv("DOCKER_CERT_PATH")
+	if dir == "" {
+		dir = configDir
+	}
+	return loadTLSConfig(dir, verify)
+}
+
+// currentContext returns the currentContext of the CLI config, "" when unset.
+func currentContext(configDir string) string {
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return ""
+	}
+	return cfg.CurrentContext
+}
+
+// contextEndpoint reads the docker endpoint of a CLI context. Contexts are
+// stored under the SHA-256 of their name, with TLS material, if any, beside
+// the metadata.
+func contextEndpoint(configDir, name string) (endpoint, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+	data, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return endpoint{}, fmt.Errorf("docker context %q: %w", name, err)
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host          string
+			SkipTLSVerify bool
+		}
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return endpoint{}, fmt.Errorf("docker context %q: %w", name, err)
+	}
+	ep, ok := meta.Endpoints["docker"]
+	if !ok || ep.Host == "" {
+		return endpoint{}, fmt.Errorf("docker context %q has no docker endpoint", name)
+	}
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	if _, err := os.Stat(tlsDir); err != nil && !ep.SkipTLSVerify {
+		return endpoint{host: ep.Host}, nil
+	}
+	tlsConfig, err := loadTLSConfig(tlsDir, !ep.SkipTLSVerify)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("docker context %q: %w", name, err)
+	}
+	return endpoint{host: ep.Host, tls: tlsConfig}, nil
+}
+
+// defaultHost returns the first existing socket of the system daemon, the
+// rootless daemon and Docker Desktop, or the system socket when none exists.
+func defaultHost(getenv func(string) string) string {
+	candidates := []string{defaultSocket}
+	if dir := getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "docker.sock"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".docker", "run", "docker.sock"))
+	}
+	for _, socket := range candidates {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return "unix://" + defaultSocket
+}
+
+// loadTLSConfig reads ca.pem, cert.pem and key.pem from dir, each optional.
+// Without ca.pem a verified connection trusts the system roots.
+func loadTLSConfig(dir string, verify bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: !verify}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	switch {
+	case err == nil:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", filepath.Join(dir, "ca.pem"))
+		}
+		cfg.RootCAs = pool
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load docker client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
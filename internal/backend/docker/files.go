@@ -0,0 +1,307 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+)
+
+// statFormat prints size, raw mode (hex), mtime and name; understood by GNU and busybox stat.
+const statFormat = "%s %f %Y %n"
+
+// maxSymlinkHops bounds symlink resolution in ReadFile.
+const maxSymlinkHops = 40
+
+func (b *Backend) ReadFile(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string) ([]byte, error) {
+	c, err := b.docker()
+	if err != nil {
+		return nil, err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The daemon archives a symlink itself; follow it like `docker cp -L`.
+	current := target
+	for range maxSymlinkHops {
+		body, stat, err := c.getArchive(ctx, h.containerName, current)
+		if err != nil {
+			return nil, fileError("docker archive", target, err, "")
+		}
+		if stat.Mode&fs.ModeSymlink != 0 && stat.LinkTarget != "" {
+			_ = body.Close()
+			if path.IsAbs(stat.LinkTarget) {
+				current = stat.LinkTarget
+			} else {
+				current = path.Join(path.Dir(current), stat.LinkTarget)
+			}
+			continue
+		}
+		defer body.Close()
+		return readArchivedFile(body, target)
+	}
+	return nil, fmt.Errorf("read %s: too many levels of symbolic links", target)
+}
+
+// readArchivedFile returns the content of the single file in a tar stream.
+func readArchivedFile(r io.Reader, target string) ([]byte, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: invalid archive from docker: %w", target, err)
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		return nil, fmt.Errorf("read %s: is a directory", target)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("read %s: not a regular file", target)
+	}
+	return io.ReadAll(tr)
+}
+
+func (b *Backend) WriteFile(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string, data []byte, perm fs.FileMode) error {
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return err
+	}
+	user, err := guestUser(spec.Config.Docker)
+	if err != nil {
+		return err
+	}
+	// The daemon keeps the archive's ownership, so match the container user.
+	uid, gid := parseUser(user)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Base(target),
+		Size:     int64(len(data)),
+		Mode:     int64(perm.Perm()),
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := c.putArchive(ctx, h.containerName, path.Dir(target), &archive); err != nil {
+		return fileError("docker archive", target, err, "")
+	}
+	return nil
+}
+
+func (b *Backend) ListDir(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string) ([]backend.FileInfo, error) {
+	c, err := b.docker()
+	if err != nil {
+		return nil, err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return nil, err
+	}
+	script := `[ -e "$1" ] || { echo "$1: No such file or directory" >&2; exit 2; }
+cd -- "$1" || exit 1
+for f in .* *; do
+  case "$f" in .|..) continue ;; esac
+  [ -e "$f" ] || [ -L "$f" ] || continue
+  stat -c '` + statFormat + `' -- "$f" || exit 1
+done`
+	out, err := execFileScript(ctx, c, h.containerName, target, script)
+	if err != nil {
+		return nil, err
+	}
+	infos := []backend.FileInfo{}
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		info, err := parseStatLine(line)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (b *Backend) Stat(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string) (backend.FileInfo, error) {
+	c, err := b.docker()
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	out, err := execFileScript(ctx, c, h.containerName, target, `stat -L -c '`+statFormat+`' -- "$1"`)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	info, err := parseStatLine(strings.TrimRight(out, "\n"))
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	info.Name = path.Base(target)
+	return info, nil
+}
+
+func (b *Backend) Remove(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string, recursive bool) error {
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return err
+	}
+	if target == "/" || target == "/workspace" {
+		return fmt.Errorf("refusing to remove %s", target)
+	}
+	script := `if [ -d "$1" ] && [ ! -L "$1" ]; then rmdir -- "$1"; else rm -- "$1"; fi`
+	if recursive {
+		script = `rm -rf -- "$1"`
+	}
+	_, err = execFileScript(ctx, c, h.containerName, target, script)
+	return err
+}
+
+func (b *Backend) MkdirAll(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string, perm fs.FileMode) error {
+	c, err := b.docker()
+	if err != nil {
+		return err
+	}
+	h, target, err := fileTarget(spec, handle, guestPath)
+	if err != nil {
+		return err
+	}
+	_, err = execFileScript(ctx, c, h.containerName, target, fmt.Sprintf(`mkdir -p -m %o -- "$1"`, perm.Perm()))
+	return err
+}
+
+// fileTarget resolves guestPath like a session cwd: relative paths map into the
+// mounted workspace, absolute paths are used as given.
+func fileTarget(spec backend.RuntimeSpec, handle backend.SessionHandle, guestPath string) (sessionHandle, string, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return sessionHandle{}, "", fmt.Errorf("invalid docker session handle")
+	}
+	target, err := container.ResolveGuestCwd(spec.ProjectRoot, guestPath, "/workspace")
+	if err != nil {
+		return sessionHandle{}, "", err
+	}
+	return h, path.Clean(target), nil
+}
+
+// execFileScript runs script in the container with target as $1 and returns stdout.
+func execFileScript(ctx context.Context, c *client, containerName, target, script string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cfg := execConfig{Cmd: []string{"/bin/sh", "-c", script, "sh", target}}
+	code, err := runExec(ctx, c, containerName, cfg, nil, &stdout, &stderr, nil)
+	if err != nil {
+		return "", fileError("docker exec", target, err, "")
+	}
+	if code != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = fmt.Sprintf("exit code %d", code)
+		}
+		return "", fileError("docker exec", target, nil, msg)
+	}
+	return stdout.String(), nil
+}
+
+// fileError converts a failed file operation into an error, wrapping
+// fs.ErrNotExist when the target is missing. err is a failed API call and msg
+// the stderr of a failed script; one of them is set.
+func fileError(op, target string, err error, msg string) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound &&
+		!strings.Contains(strings.ToLower(apiErr.Message), "no such container") {
+		return fmt.Errorf("%s: %w", target, fs.ErrNotExist)
+	}
+	if strings.Contains(strings.ToLower(msg), "no such file or directory") {
+		return fmt.Errorf("%s: %w", target, fs.ErrNotExist)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", op, target, err)
+	}
+	return fmt.Errorf("%s %s: %s", op, target, msg)
+}
+
+func parseStatLine(line string) (backend.FileInfo, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return backend.FileInfo{}, fmt.Errorf("unexpected stat output: %q", line)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return backend.FileInfo{}, fmt.Errorf("unexpected stat size: %q", line)
+	}
+	raw, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return backend.FileInfo{}, fmt.Errorf("unexpected stat mode: %q", line)
+	}
+	mtime, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return backend.FileInfo{}, fmt.Errorf("unexpected stat mtime: %q", line)
+	}
+	return backend.FileInfo{
+		Name:    fields[3],
+		Size:    size,
+		Mode:    unixFileMode(uint32(raw)),
+		ModTime: time.Unix(mtime, 0).UTC(),
+	}, nil
+}
+
+// unixFileMode converts a raw st_mode into an fs.FileMode.
+func unixFileMode(raw uint32) fs.FileMode {
+	mode := fs.FileMode(raw & 0o777)
+	switch raw & 0o170000 {
+	case 0o040000:
+		mode |= fs.ModeDir
+	case 0o120000:
+		mode |= fs.ModeSymlink
+	case 0o010000:
+		mode |= fs.ModeNamedPipe
+	case 0o140000:
+		mode |= fs.ModeSocket
+	case 0o020000:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		mode |= fs.ModeDevice
+	}
+	if raw&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if raw&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if raw&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"vibebox/internal/backend/container"
+)
+
+const (
+	// cleanupTimeout bounds teardown calls issued after the caller's context is done.
+	cleanupTimeout  = 15 * time.Second
+	cancelWaitDelay = 2 * time.Second
+)
+
+// runExec runs cfg in a running container and returns its exit code. stdin,
+// when set, is copied to the process and then closed. When ctx ends, interrupt
+// (if set) is called and the output gets cancelWaitDelay to finish before the
+// stream is dropped; the exec then reports -1 with the context error.
+func runExec(ctx context.Context, c *client, containerName string, cfg execConfig, stdin io.Reader, stdout, stderr io.Writer, interrupt func()) (int, error) {
+	cfg.AttachStdin = stdin != nil
+	cfg.AttachStdout = true
+	cfg.AttachStderr = true
+	id, err := c.createExec(ctx, containerName, cfg)
+	if err != nil {
+		return -1, err
+	}
+	st, err := c.startExec(ctx, id)
+	if err != nil {
+		return -1, err
+	}
+	defer st.Close()
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(st, stdin)
+			_ = st.CloseWrite()
+		}()
+	}
+	done := make(chan error, 1)
+	go func() { done <- demux(st, stdout, stderr) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if interrupt != nil {
+			interrupt()
+		}
+		select {
+		case err = <-done:
+		case <-time.After(cancelWaitDelay):
+			_ = st.Close()
+			<-done
+			return -1, ctx.Err()
+		}
+	}
+	if err != nil {
+		return -1, err
+	}
+	return c.execExitCode(id)
+}
+
+// runCleanup runs argv in the container with a fresh timeout, ignoring
+// containers that are gone or stopped.
+func runCleanup(c *client, containerName string, argv ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	var stderr strings.Builder
+	code, err := runExec(ctx, c, containerName, execConfig{Cmd: argv}, nil, io.Discard, &stderr, nil)
+	if isGone(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("docker exec %s: %w", argv[0], err)
+	}
+	if code != 0 {
+		return fmt.Errorf("docker exec %s: exit code %d (%s)", argv[0], code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// killTaggedProcesses signals every process in container whose environment
+// carries the exec token, which covers children and background jobs as well.
+func killTaggedProcesses(c *client, containerName, token, signal string) error {
+	return runCleanup(c, containerName, "/bin/sh", "-c", container.KillTaggedScript(token, signal))
+}
+
+// removeContainer force-removes a container, ignoring containers that are already gone.
+func removeContainer(c *client, containerName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := c.deleteContainer(ctx, containerName); err != nil && !isGone(err) {
+		return fmt.Errorf("remove docker container %s: %w", containerName, err)
+	}
+	return nil
+}
+
+// Labels of warm containers, besides the common container labels.
+const (
+	// labelConfigHash identifies the configuration a warm container was created with.
+	labelConfigHash = "vibebox.config-hash"
+	// labelIdleTimeout is how long a warm container may go without execs
+	// before it is removed, as a Go duration.
+	labelIdleTimeout = "vibebox.idle-timeout"
+
+	kindWarm = "warm"
+)
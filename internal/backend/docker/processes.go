@@ -0,0 +1,196 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+)
+
+const (
+	// processStateDir holds per-process log and exit files inside session containers.
+	processStateDir = "/tmp/.vibebox-proc"
+	// logsTagSuffix tags the log followers so they can be stopped without
+	// touching the process they are reading from.
+	logsTagSuffix = ".logs"
+)
+
+// process is a command started as a detached exec whose output is written to
+// files in the container and followed from the host.
+type process struct {
+	api           *client
+	containerName string
+	token         string
+	dir           string
+	done          chan struct{}
+	exit          backend.ProcessExit
+	err           error
+}
+
+func (b *Backend) SpawnInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ProcessHandle, error) {
+	c, err := b.docker()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid docker session handle")
+	}
+	if req.Stdin != nil {
+		return nil, fmt.Errorf("stdin is not supported for docker background processes")
+	}
+	guestCwd, env, err := h.resolve(spec, req)
+	if err != nil {
+		return nil, err
+	}
+
+	token := container.ExecToken(req)
+	dir := processStateDir + "/" + container.SanitizeName(token)
+	// Only the command carries the exec tag, so signals never reach the
+	// wrapper and it can always record the exit status.
+	wrapper := fmt.Sprintf(
+		`d=%s; mkdir -p "$d" && : >"$d/stdout" && : >"$d/stderr" || exit 1; %s=%s "$@" >"$d/stdout" 2>"$d/stderr" </dev/null & wait $!; echo $? >"$d/exit.tmp"; mv "$d/exit.tmp" "$d/exit"`,
+		container.ShellQuote(dir), container.ExecIDEnv, container.ShellQuote(token),
+	)
+
+	id, err := c.createExec(ctx, h.containerName, execConfig{
+		Cmd:        append([]string{"/bin/sh", "-c", wrapper, "sh"}, backend.CommandArgv(spec, req)...),
+		Env:        container.EnvList(env),
+		WorkingDir: guestCwd,
+	})
+	if err == nil {
+		err = c.startExecDetached(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("start docker background process: %w", err)
+	}
+
+	p := &process{
+		api:           c,
+		containerName: h.containerName,
+		token:         token,
+		dir:           dir,
+		done:          make(chan struct{}),
+	}
+	go p.follow(req.Stdout, req.Stderr)
+	return p, nil
+}
+
+func (b *Backend) WaitProcess(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, proc backend.ProcessHandle) (backend.ProcessExit, error) {
+	_ = spec
+	_ = handle
+	p, ok := proc.(*process)
+	if !ok {
+		return backend.ProcessExit{}, fmt.Errorf("invalid docker process handle")
+	}
+	select {
+	case <-p.done:
+		return p.exit, p.err
+	case <-ctx.Done():
+		return backend.ProcessExit{}, ctx.Err()
+	}
+}
+
+func (b *Backend) SignalProcess(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, proc backend.ProcessHandle, signal string) error {
+	_ = ctx
+	_ = spec
+	_ = handle
+	p, ok := proc.(*process)
+	if !ok {
+		return fmt.Errorf("invalid docker process handle")
+	}
+	if _, err := backend.NormalizeSignal(signal); err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	return killTaggedProcesses(p.api, p.containerName, p.token, signal)
+}
+
+// follow streams the log files until the exit file appears, then delivers the
+// remaining output and removes the state directory.
+func (p *process) follow(stdout, stderr io.Writer) {
+	defer close(p.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &countingWriter{w: stdout}
+	errOut := &countingWriter{w: stderr}
+	tails := make(chan struct{}, 2)
+	go func() { p.tail(ctx, "stdout", out); tails <- struct{}{} }()
+	go func() { p.tail(ctx, "stderr", errOut); tails <- struct{}{} }()
+
+	code, err := p.waitExitFile()
+	_ = killTaggedProcesses(p.api, p.containerName, p.token+logsTagSuffix, "KILL")
+	cancel()
+	<-tails
+	<-tails
+
+	if err != nil {
+		p.exit, p.err = backend.ProcessExit{ExitCode: -1}, err
+		return
+	}
+	p.drain("stdout", out)
+	p.drain("stderr", errOut)
+	_ = runCleanup(p.api, p.containerName, "rm", "-rf", p.dir)
+
+	p.exit = backend.ProcessExit{ExitCode: code, Signal: container.SignalFromExitCode(code)}
+}
+
+func (p *process) tail(ctx context.Context, stream string, w io.Writer) {
+	cfg := execConfig{
+		Cmd: []string{"tail", "-c", "+1", "-F", p.dir + "/" + stream},
+		Env: []string{container.ExecIDEnv + "=" + p.token + logsTagSuffix},
+	}
+	_, _ = runExec(ctx, p.api, p.containerName, cfg, nil, w, io.Discard, nil)
+}
+
+// drain writes whatever the follower had not delivered before it was stopped.
+func (p *process) drain(stream string, w *countingWriter) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	cfg := execConfig{Cmd: []string{"tail", "-c", fmt.Sprintf("+%d", w.n+1), p.dir + "/" + stream}}
+	_, _ = runExec(ctx, p.api, p.containerName, cfg, nil, w, io.Discard, nil)
+}
+
+func (p *process) waitExitFile() (int, error) {
+	script := fmt.Sprintf(`while [ ! -f %[1]s/exit ]; do sleep 0.2; done; cat %[1]s/exit`, container.ShellQuote(p.dir))
+	cfg := execConfig{
+		Cmd: []string{"/bin/sh", "-c", script},
+		Env: []string{container.ExecIDEnv + "=" + p.token + logsTagSuffix},
+	}
+	var stdout, stderr bytes.Buffer
+	status, err := runExec(context.Background(), p.api, p.containerName, cfg, nil, &stdout, &stderr, nil)
+	if err == nil && status != 0 {
+		err = fmt.Errorf("exit code %d", status)
+	}
+	if err != nil {
+		return -1, fmt.Errorf("docker process watcher failed: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+	if err != nil {
+		return -1, fmt.Errorf("invalid exit status %q", strings.TrimSpace(stdout.String()))
+	}
+	return code, nil
+}
+
+// countingWriter forwards to w (when set) and counts the bytes delivered.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	if c.w != nil {
+		_, _ = c.w.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,17 @@
+package docker
+
+import (
+	"context"
+
+	"vibebox/internal/backend/container"
+)
+
+func inspectContainerState(c *client, containerName string) (container.State, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	info, err := c.inspectContainer(ctx, containerName)
+	if err != nil {
+		return container.State{}, err
+	}
+	return info.State, nil
+}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// terminal is the host terminal an interactive container is attached to.
+type terminal struct {
+	fd int
+}
+
+// terminalOf reports whether r is a terminal.
+func terminalOf(r io.Reader) (terminal, bool) {
+	f, ok := r.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return terminal{}, false
+	}
+	return terminal{fd: int(f.Fd())}, true
+}
+
+// size returns the terminal size as [height, width], or nil if unknown.
+func (t terminal) size() *[2]uint {
+	width, height, err := term.GetSize(t.fd)
+	if err != nil {
+		return nil
+	}
+	return &[2]uint{uint(height), uint(width)}
+}
+
+// makeRaw passes keystrokes through unprocessed, so the container's TTY
+// handles line editing and signals. The returned function restores the mode.
+func (t terminal) makeRaw() (func(), error) {
+	state, err := term.MakeRaw(t.fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = term.Restore(t.fd, state) }, nil
+}
+
+// watchSize resizes the container TTY whenever the terminal is resized, until
+// the returned function is called.
+func (t terminal) watchSize(c *client, id string) func() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-resized:
+				if size := t.size(); size != nil {
+					ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+					_ = c.resizeContainer(ctx, id, int(size[0]), int(size[1]))
+					cancel()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"vibebox/internal/config"
+)
+
+// guestHome is HOME for the configured user, a tmpfs owned by the user so tools
+// can write caches and dotfiles even when the image has no home for them or,
+// for root, when the root filesystem is read-only.
+const guestHome = "/home/vibebox"
+
+// guestUser returns the uid:gid containers run as, or "" for the image default.
+func guestUser(cfg config.DockerConfig) (string, error) {
+	switch cfg.User {
+	case "":
+		return "", nil
+	case config.DockerUserRoot:
+		return "0:0", nil
+	case config.DockerUserHost:
+		uid, gid := os.Getuid(), os.Getgid()
+		if uid < 0 {
+			return "", fmt.Errorf("docker.user %s is not supported on this platform", config.DockerUserHost)
+		}
+		return fmt.Sprintf("%d:%d", uid, gid), nil
+	default:
+		return cfg.User, nil
+	}
+}
+
+// parseUser splits a uid:gid user; anything else reports root.
+func parseUser(user string) (uid, gid int) {
+	u, g, _ := strings.Cut(user, ":")
+	uid, _ = strconv.Atoi(u)
+	gid, _ = strconv.Atoi(g)
+	return uid, gid
+}
+
+// withUser runs cfg as user with a writable HOME. Like HardenedTmpfs, HOME
+// allows exec, so tools installed under it can run.
+func withUser(cfg containerConfig, user string) containerConfig {
+	if user == "" {
+		return cfg
+	}
+	cfg.User = user
+	uid, gid := parseUser(user)
+	if cfg.HostConfig.Tmpfs == nil {
+		cfg.HostConfig.Tmpfs = map[string]string{}
+	}
+	cfg.HostConfig.Tmpfs[guestHome] = fmt.Sprintf("uid=%d,gid=%d,mode=0755,exec", uid, gid)
+	cfg.Env = append(cfg.Env, "HOME="+guestHome)
+	return cfg
+}
+
+// addUserEntry adds user to /etc/passwd and /etc/group of a long-lived
+// container, so whoami, ssh and git can resolve the name. It does nothing for
+// root, for ids the image already knows and for read-only root filesystems.
+func addUserEntry(ctx context.Context, c *client, containerName, user string) error {
+	uid, gid := parseUser(user)
+	if uid == 0 {
+		return nil
+	}
+	script := fmt.Sprintf(`[ -w /etc/passwd ] || exit 0
+cut -d: -f3 /etc/passwd | grep -qx %[1]d || echo "vibebox:x:%[1]d:%[2]d:vibebox:%[3]s:/bin/bash" >>/etc/passwd
+cut -d: -f3 /etc/group | grep -qx %[2]d || echo "vibebox:x:%[2]d:" >>/etc/group
+true`, uid, gid, guestHome)
+	var stderr strings.Builder
+	code, err := runExec(ctx, c, containerName, execConfig{Cmd: []string{"/bin/sh", "-c", script}, User: "0:0"}, nil, io.Discard, &stderr, nil)
+	if err != nil {
+		return fmt.Errorf("add container user: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("add container user: exit code %d (%s)", code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
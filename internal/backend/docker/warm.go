@@ -0,0 +1,262 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+	"vibebox/internal/config"
+)
+
+const (
+	// warmAttempts bounds how often ensureWarmContainer retries after losing a
+	// race with another process creating or replacing the same container.
+	warmAttempts = 3
+	// warmUsedMarker is touched in a warm container around every exec; its
+	// mtime is the container's last use. /dev/shm stays writable with a
+	// read-only rootfs.
+	warmUsedMarker = "/dev/shm/.vibebox-used"
+	// warmReapInterval spaces the scans for idle warm containers of one backend.
+	warmReapInterval = time.Minute
+)
+
+// execWarm runs req in the project's warm container, starting it first if needed.
+func (b *Backend) execWarm(ctx context.Context, c *client, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	guestCwd, err := container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, "/workspace")
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	b.reapIdleWarm(ctx, c, warmContainerName(spec))
+	containerName, err := b.ensureWarmContainer(ctx, c, spec)
+	if err != nil {
+		if ctx.Err() != nil {
+			return backend.ExecResult{ExitCode: -1, TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded)}, nil
+		}
+		return backend.ExecResult{}, fmt.Errorf("docker warm container: %w", err)
+	}
+	req.ExecID = container.ExecToken(req)
+	req.Args = append([]string{"/bin/sh", "-c", warmScript(req.ExecID), "sh"}, backend.CommandArgv(spec, req)...)
+	return execInContainer(ctx, c, containerName, spec, req, guestCwd, req.Env)
+}
+
+// warmScript runs the command of a warm exec, given as its arguments, and
+// exits with its status. It touches warmUsedMarker before and after the
+// command for idle expiry. A fresh container would take background jobs down
+// with it; in the shared container they are killed once the command returns so
+// they cannot leak into later execs. The kill runs in a shell re-executed
+// without the exec token, so it spares itself.
+func warmScript(token string) string {
+	// The command's stderr must not collect the noise of scanning /proc.
+	kill := "exec 2>/dev/null; " + container.KillTaggedScript(token, "KILL") + `; exit "$1"`
+	return fmt.Sprintf(`touch %[1]s 2>/dev/null; "$@"; status=$?; touch %[1]s 2>/dev/null; unset %[2]s; exec /bin/sh -c %[3]s sh "$status"`,
+		warmUsedMarker, container.ExecIDEnv, container.ShellQuote(kill))
+}
+
+// ensureWarmContainer returns the name of the project's running warm
+// container. It is created on first use and replaced when the container
+// configuration (image, user, mounts, limits, security options, ...) no longer matches.
+func (b *Backend) ensureWarmContainer(ctx context.Context, c *client, spec backend.RuntimeSpec) (string, error) {
+	cfg, err := newContainerConfig(spec)
+	if err != nil {
+		return "", err
+	}
+	cfg.Cmd = []string{"sleep", "infinity"}
+	cfg.WorkingDir = "/workspace"
+	cfg.HostConfig.Init = true
+	idle := time.Duration(spec.Config.Docker.WarmIdleMinutes) * time.Minute
+	if idle == 0 {
+		idle = config.DefaultWarmIdleMinutes * time.Minute
+	}
+	// The idle timeout is part of the configuration, so changing it replaces the container.
+	cfg.Labels = map[string]string{labelIdleTimeout: idle.String()}
+	// So is the image ID, so pulling a newer image under the same tag replaces it too.
+	imageID, err := c.imageID(ctx, cfg.Image)
+	if err != nil {
+		return "", err
+	}
+	hash, err := configHash(cfg, imageID)
+	if err != nil {
+		return "", err
+	}
+	cfg.Labels = container.Labels(spec, kindWarm, map[string]string{labelConfigHash: hash, labelIdleTimeout: idle.String()})
+	name := warmContainerName(spec)
+
+	b.warmMu.Lock()
+	defer b.warmMu.Unlock()
+	for range warmAttempts {
+		info, err := c.inspectContainer(ctx, name)
+		switch {
+		case isNotFound(err):
+			if _, err := c.createContainer(ctx, name, cfg); err != nil {
+				if isConflict(err) {
+					continue
+				}
+				return "", err
+			}
+			err := c.startContainer(ctx, name)
+			if err == nil && cfg.User != "" {
+				err = addUserEntry(ctx, c, name, cfg.User)
+			}
+			if err != nil {
+				// Otherwise the next exec would reuse a container that never
+				// started or lacks the user entry.
+				_ = removeContainer(c, name)
+				return "", err
+			}
+			return name, nil
+		case err != nil:
+			return "", err
+		case info.Config.Labels[labelConfigHash] != hash:
+			if err := c.deleteContainer(ctx, name); err != nil && !isNotFound(err) {
+				return "", err
+			}
+		case !info.State.Running:
+			// For example after a daemon restart.
+			if err := c.startContainer(ctx, name); err != nil {
+				return "", err
+			}
+			return name, nil
+		default:
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("container %s was changed concurrently; retry", name)
+}
+
+// reapIdleWarm removes the idle warm containers of other projects. It scans at
+// most once per warmReapInterval and is best effort: errors only delay removal.
+func (b *Backend) reapIdleWarm(ctx context.Context, c *client, keep string) {
+	b.warmMu.Lock()
+	due := time.Since(b.lastReap) >= warmReapInterval
+	if due {
+		b.lastReap = time.Now()
+	}
+	b.warmMu.Unlock()
+	if due {
+		_, _ = removeWarmContainers(ctx, c, false, keep)
+	}
+}
+
+// Cleanup removes the warm containers that have gone without execs for longer
+// than their idle timeout, or every warm container when all is set, and
+// returns their names. Session containers end with their sessions.
+func (b *Backend) Cleanup(ctx context.Context, all bool) ([]string, error) {
+	c, err := b.docker()
+	if err != nil {
+		return nil, err
+	}
+	return removeWarmContainers(ctx, c, all, "")
+}
+
+// removeWarmContainers removes the warm containers other than keep that are
+// idle, or all of them.
+func removeWarmContainers(ctx context.Context, c *client, all bool, keep string) ([]string, error) {
+	list, err := c.listContainers(ctx, container.LabelKind+"="+kindWarm)
+	if err != nil {
+		return nil, fmt.Errorf("list docker warm containers: %w", err)
+	}
+	var removed []string
+	var errs []error
+	now := time.Now()
+	for _, w := range list {
+		name := w.ID
+		if len(w.Names) > 0 {
+			name = strings.TrimPrefix(w.Names[0], "/")
+		}
+		if name == keep {
+			continue
+		}
+		if !all {
+			idle, err := warmIdle(ctx, c, name, w.Labels[labelIdleTimeout], now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("docker warm container %s: %w", name, err))
+				continue
+			}
+			if !idle {
+				continue
+			}
+		}
+		if err := c.deleteContainer(ctx, name); err != nil {
+			if !isGone(err) {
+				errs = append(errs, fmt.Errorf("remove docker container %s: %w", name, err))
+			}
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// warmIdle reports whether a warm container has gone without execs for longer
+// than its idle timeout; containers created before the label existed use the
+// default. The last use is the mtime of warmUsedMarker, or when the container
+// last started or stopped. An exec that is still running shows up as a
+// process besides the container's `sleep infinity`.
+func warmIdle(ctx context.Context, c *client, name, timeoutLabel string, now time.Time) (bool, error) {
+	timeout, err := time.ParseDuration(timeoutLabel)
+	if err != nil || timeout <= 0 {
+		timeout = config.DefaultWarmIdleMinutes * time.Minute
+	}
+	info, err := c.inspectContainer(ctx, name)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	lastUse := info.State.StartedAt
+	if info.State.FinishedAt.After(lastUse) {
+		lastUse = info.State.FinishedAt
+	}
+	if info.State.Running {
+		if stat, err := c.statPath(ctx, name, warmUsedMarker); err == nil && stat.Mtime.After(lastUse) {
+			lastUse = stat.Mtime
+		}
+	}
+	if now.Sub(lastUse) < timeout {
+		return false, nil
+	}
+	if !info.State.Running {
+		return true, nil
+	}
+	cmds, err := c.topContainer(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	for _, cmd := range cmds {
+		if !strings.HasSuffix(cmd, "sleep infinity") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// warmContainerName is unique per project root, so projects that share a
+// name do not replace each other's container.
+func warmContainerName(spec backend.RuntimeSpec) string {
+	sum := sha256.Sum256([]byte(spec.ProjectRoot))
+	return "vibebox-w-" + container.SanitizeName(spec.ProjectName) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// configHash identifies a container configuration and the image it runs.
+func configHash(cfg containerConfig, imageID string) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(data, imageID...))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func isConflict(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
@@ -0,0 +1,29 @@
+package backend
+
+import (
+	"errors"
+
+	"vibebox/internal/config"
+)
+
+// ErrEscapesProjectRoot is wrapped by errors for cwd or file paths that resolve
+// outside the project root.
+var ErrEscapesProjectRoot = errors.New("escapes project root")
+
+// ErrSessionGone is wrapped by SessionProber errors when the sandbox of a
+// persisted session no longer exists, as opposed to being unreachable.
+var ErrSessionGone = errors.New("session sandbox no longer exists")
+
+// UnavailableError reports that the requested provider, or every candidate of
+// auto selection, failed its probe.
+type UnavailableError struct {
+	Provider    config.Provider
+	Diagnostics map[string]ProbeResult
+	// Skipped explains each rejected candidate when Provider is auto.
+	Skipped []SkippedCandidate
+	message string
+}
+
+func (e *UnavailableError) Error() string {
+	return e.message
+}
@@ -0,0 +1,383 @@
+package linuxns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+const (
+	workspaceGuestPath = "/workspace"
+	defaultGuestPath   = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// Backend implements the linux-ns provider: commands run in fresh user, mount,
+// PID, network, IPC and UTS namespaces created by re-executing the current
+// binary, so no daemon or image is needed.
+type Backend struct{}
+
+type sessionHandle struct {
+	defaultCwd string
+	defaultEnv map[string]string
+	// tmpDir is the host directory mounted at /tmp for every command of the
+	// session, so files there survive between commands.
+	tmpDir string
+	// shell is the long-lived sandboxed bash of a stateful session, nil otherwise.
+	shell *backend.Shell
+}
+
+// capabilities of namespace sandboxes: each command gets its own PID namespace,
+// so processes do not outlive it, and only /tmp is shared within a session.
+var capabilities = backend.Capabilities{
+	Mounts:           true,
+	Env:              true,
+	Cwd:              true,
+	NetworkIsolation: true,
+	Stdin:            true,
+	LiveOutput:       true,
+	StatefulShell:    true,
+}
+
+// sandboxSpec is handed to the sandbox init in the re-executed child.
+type sandboxSpec struct {
+	// Root is an empty host directory the child mounts its new root on. Mounts
+	// are private to the child, so concurrent sandboxes share it.
+	Root   string      `json:"root"`
+	Mounts []bindMount `json:"mounts,omitempty"`
+	// TmpDir is bind-mounted at /tmp; empty means a fresh tmpfs.
+	TmpDir   string   `json:"tmpDir,omitempty"`
+	Cwd      string   `json:"cwd"`
+	Env      []string `json:"env,omitempty"`
+	Argv     []string `json:"argv,omitempty"`
+	Loopback bool     `json:"loopback,omitempty"`
+	Seccomp  bool     `json:"seccomp,omitempty"`
+	Landlock bool     `json:"landlock,omitempty"`
+	// Probe exits after setting up the sandbox instead of running Argv.
+	Probe bool `json:"probe,omitempty"`
+}
+
+type bindMount struct {
+	Host     string `json:"host"`
+	Guest    string `json:"guest"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+func New() *Backend {
+	return &Backend{}
+}
+
+func (b *Backend) Name() string {
+	return "linux-ns"
+}
+
+func (b *Backend) Prepare(ctx context.Context, spec backend.RuntimeSpec) error {
+	_ = ctx
+	_, err := sandboxMounts(spec)
+	return err
+}
+
+func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	return b.run(ctx, spec, req, "")
+}
+
+func (b *Backend) StartSession(ctx context.Context, spec backend.RuntimeSpec, req backend.SessionStartRequest) (backend.SessionHandle, error) {
+	guestCwd, err := resolveCwd(spec, req.Cwd)
+	if err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp("", "vibebox-linux-ns-tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("create session tmp dir: %w", err)
+	}
+	h := sessionHandle{
+		defaultCwd: guestCwd,
+		defaultEnv: cloneMap(req.Env),
+		tmpDir:     tmpDir,
+	}
+	if req.Stateful {
+		if h.shell, err = startShell(ctx, spec, h); err != nil {
+			_ = os.RemoveAll(tmpDir)
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ExecResult, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return backend.ExecResult{}, fmt.Errorf("invalid linux-ns session handle")
+	}
+	if h.shell != nil {
+		cwd := ""
+		if req.Cwd != "" {
+			var err error
+			if cwd, err = resolveCwd(spec, req.Cwd); err != nil {
+				return backend.ExecResult{}, err
+			}
+		}
+		return h.shell.Exec(ctx, req, cwd, killShellJobs(h.shell))
+	}
+	if req.Cwd == "" {
+		req.Cwd = h.defaultCwd
+	}
+	env := cloneMap(h.defaultEnv)
+	for k, v := range req.Env {
+		env[k] = v
+	}
+	req.Env = env
+	return b.run(ctx, spec, req, h.tmpDir)
+}
+
+func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle) error {
+	_ = ctx
+	_ = spec
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return fmt.Errorf("invalid linux-ns session handle")
+	}
+	if h.shell != nil {
+		_ = h.shell.Close()
+	}
+	return os.RemoveAll(h.tmpDir)
+}
+
+// killShellJobs returns the interrupt of a stateful session's shell. The shell
+// runs as the only child of the sandbox init, whose pid the Shell knows.
+func killShellJobs(shell *backend.Shell) func() error {
+	return func() error {
+		out, err := exec.Command("pgrep", "-P", strconv.Itoa(shell.Pid())).Output()
+		if err != nil {
+			return fmt.Errorf("find session shell: %w", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			return fmt.Errorf("find session shell: %w", err)
+		}
+		return backend.KillShellJobs(pid)
+	}
+}
+
+// persistedSession is the registry form of sessionHandle.
+type persistedSession struct {
+	DefaultCwd string            `json:"defaultCwd"`
+	DefaultEnv map[string]string `json:"defaultEnv,omitempty"`
+	TmpDir     string            `json:"tmpDir"`
+	Stateful   bool              `json:"stateful,omitempty"`
+	// InitPID is the host pid of the sandbox init running a stateful session's shell.
+	InitPID int `json:"initPid,omitempty"`
+}
+
+func (b *Backend) MarshalSession(handle backend.SessionHandle) ([]byte, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid linux-ns session handle")
+	}
+	p := persistedSession{
+		DefaultCwd: h.defaultCwd,
+		DefaultEnv: h.defaultEnv,
+		TmpDir:     h.tmpDir,
+		Stateful:   h.shell != nil,
+	}
+	if h.shell != nil {
+		p.InitPID = h.shell.Pid()
+	}
+	return json.Marshal(p)
+}
+
+// ProbeSession reports a session gone once its tmp dir is, or once the sandbox
+// init of a stateful session has exited, which it does with the process that
+// owned the session. The tmp dir of such a session is removed, since nothing
+// else refers to it once the record is pruned.
+func (b *Backend) ProbeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) error {
+	_ = ctx
+	_ = spec
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("decode linux-ns session: %w", err)
+	}
+	if _, err := os.Stat(p.TmpDir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("linux-ns session tmp dir %s: %w", p.TmpDir, backend.ErrSessionGone)
+	}
+	if p.Stateful && !initRunning(p.InitPID) {
+		_ = os.RemoveAll(p.TmpDir)
+		return fmt.Errorf("linux-ns session init %d has exited: %w", p.InitPID, backend.ErrSessionGone)
+	}
+	return nil
+}
+
+func (b *Backend) ResumeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) (backend.SessionHandle, error) {
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode linux-ns session: %w", err)
+	}
+	if info, err := os.Stat(p.TmpDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("linux-ns session tmp dir is gone: %s", p.TmpDir)
+	}
+	h := sessionHandle{defaultCwd: p.DefaultCwd, defaultEnv: cloneMap(p.DefaultEnv), tmpDir: p.TmpDir}
+	if p.Stateful {
+		// The previous shell died with the process that owned it; state starts over.
+		var err error
+		if h.shell, err = startShell(ctx, spec, h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// sandboxMounts resolves config mounts to bind mounts, parents before children.
+func sandboxMounts(spec backend.RuntimeSpec) ([]bindMount, error) {
+	mounts := make([]bindMount, 0, len(spec.Config.Mounts))
+	for _, m := range spec.Config.Mounts {
+		hostPath := m.Host
+		if !filepath.IsAbs(hostPath) {
+			hostPath = filepath.Join(spec.ProjectRoot, hostPath)
+		}
+		if _, err := os.Stat(hostPath); err != nil {
+			return nil, fmt.Errorf("mount host path does not exist: %s", hostPath)
+		}
+		if !strings.HasPrefix(m.Guest, "/") {
+			return nil, fmt.Errorf("mount guest path must be absolute: %s", m.Guest)
+		}
+		mounts = append(mounts, bindMount{
+			Host:     filepath.Clean(hostPath),
+			Guest:    path.Clean(m.Guest),
+			ReadOnly: m.Mode == "ro",
+		})
+	}
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return strings.Count(mounts[i].Guest, "/") < strings.Count(mounts[j].Guest, "/")
+	})
+	return mounts, nil
+}
+
+// newSandboxSpec fills the config-derived parts of a sandbox spec.
+func newSandboxSpec(spec backend.RuntimeSpec, cwd string, env map[string]string, argv []string, tmpDir string) (sandboxSpec, error) {
+	mounts, err := sandboxMounts(spec)
+	if err != nil {
+		return sandboxSpec{}, err
+	}
+	return sandboxSpec{
+		Mounts:   mounts,
+		TmpDir:   tmpDir,
+		Cwd:      cwd,
+		Env:      sandboxEnv(env),
+		Argv:     argv,
+		Loopback: !hostNetwork(spec.Config.LinuxNS),
+		Seccomp:  spec.Config.LinuxNS.Seccomp,
+		Landlock: spec.Config.LinuxNS.Landlock,
+	}, nil
+}
+
+func hostNetwork(cfg config.LinuxNSConfig) bool {
+	return cfg.Network == config.LinuxNSNetworkHost
+}
+
+// sandboxEnv builds the command environment. Nothing is inherited from the host.
+func sandboxEnv(extra map[string]string) []string {
+	base := map[string]string{
+		"PATH":       defaultGuestPath,
+		"HOME":       "/root",
+		"IS_SANDBOX": "1",
+	}
+	if term := os.Getenv("TERM"); term != "" {
+		base["TERM"] = term
+	}
+	for k, v := range extra {
+		base[k] = v
+	}
+	keys := make([]string, 0, len(base))
+	for k := range base {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k+"="+base[k])
+	}
+	return out
+}
+
+// resolveCwd maps a requested cwd to a guest path. Relative paths are resolved
+// against the guest path of the project root mount.
+func resolveCwd(spec backend.RuntimeSpec, requested string) (string, error) {
+	workspaceGuest := workspaceGuestFromSpec(spec)
+	if requested != "" && !strings.HasPrefix(requested, "/") {
+		projectGuest, ok := projectRootGuestFromSpec(spec)
+		if !ok {
+			return "", fmt.Errorf("relative cwd requires a mount for project root %s", spec.ProjectRoot)
+		}
+		workspaceGuest = projectGuest
+	}
+	return resolveGuestCwd(spec.ProjectRoot, requested, workspaceGuest)
+}
+
+func resolveGuestCwd(projectRoot, requested, workspaceGuest string) (string, error) {
+	if requested == "" {
+		return workspaceGuest, nil
+	}
+	if strings.HasPrefix(requested, "/") {
+		return requested, nil
+	}
+
+	hostPath := filepath.Clean(filepath.Join(projectRoot, requested))
+	rel, err := filepath.Rel(projectRoot, hostPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("cwd %s %w %s", hostPath, backend.ErrEscapesProjectRoot, projectRoot)
+	}
+	return filepath.ToSlash(filepath.Join(workspaceGuest, rel)), nil
+}
+
+func projectRootGuestFromSpec(spec backend.RuntimeSpec) (string, bool) {
+	projectRootClean := filepath.Clean(spec.ProjectRoot)
+	for _, m := range spec.Config.Mounts {
+		if m.Guest == "" || m.Host == "" {
+			continue
+		}
+		hostPath := m.Host
+		if !filepath.IsAbs(hostPath) {
+			hostPath = filepath.Join(spec.ProjectRoot, hostPath)
+		}
+		if filepath.Clean(hostPath) == projectRootClean {
+			return m.Guest, true
+		}
+	}
+	return "", false
+}
+
+func workspaceGuestFromSpec(spec backend.RuntimeSpec) string {
+	if guest, ok := projectRootGuestFromSpec(spec); ok {
+		return guest
+	}
+	for _, m := range spec.Config.Mounts {
+		if m.Guest != "" {
+			return m.Guest
+		}
+	}
+	return workspaceGuestPath
+}
+
+func cloneMap(in map[string]string) map[string]string {
+	if in == nil {
+		return map[string]string{}
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package linuxns
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+func TestSandboxMounts(t *testing.T) {
+	t.Parallel()
+	project := t.TempDir()
+	cache := t.TempDir()
+	if err := os.Mkdir(filepath.Join(project, "data"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		mounts  []config.Mount
+		want    []bindMount
+		wantErr string
+	}{
+		{
+			name:   "relative host path",
+			mounts: []config.Mount{{Host: ".", Guest: "/workspace", Mode: "rw"}},
+			want:   []bindMount{{Host: project, Guest: "/workspace"}},
+		},
+		{
+			name: "parents before children",
+			mounts: []config.Mount{
+				{Host: "data", Guest: "/workspace/data/", Mode: "ro"},
+				{Host: cache, Guest: "/cache", Mode: "rw"},
+				{Host: ".", Guest: "/workspace", Mode: "rw"},
+			},
+			want: []bindMount{
+				{Host: cache, Guest: "/cache"},
+				{Host: project, Guest: "/workspace"},
+				{Host: filepath.Join(project, "data"), Guest: "/workspace/data", ReadOnly: true},
+			},
+		},
+		{
+			name:    "missing host path",
+			mounts:  []config.Mount{{Host: "missing", Guest: "/missing", Mode: "rw"}},
+			wantErr: "mount host path does not exist",
+		},
+		{
+			name:    "relative guest path",
+			mounts:  []config.Mount{{Host: ".", Guest: "workspace", Mode: "rw"}},
+			wantErr: "mount guest path must be absolute",
+		},
+	}
+	for _, tc := range cases {
+		spec := backend.RuntimeSpec{ProjectRoot: project, Config: config.Config{Mounts: tc.mounts}}
+		got, err := sandboxMounts(spec)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%s: expected error %q, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: mounts %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
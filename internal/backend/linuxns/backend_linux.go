@@ -0,0 +1,284 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"vibebox/internal/backend"
+)
+
+const (
+	// initEnv carries the JSON sandbox spec to the re-executed child.
+	initEnv = "VIBEBOX_LINUXNS_INIT"
+	// initArg0 is the argv[0] of the re-executed child. MaybeRunInit only
+	// takes over a process that has both it and initEnv.
+	initArg0 = "vibebox-linux-ns"
+	// setupFailedExitCode is the exit status of a sandbox init that failed
+	// before running the command.
+	setupFailedExitCode = 125
+	// cancelWaitDelay bounds how long Wait blocks on output pipes held open by
+	// processes that escaped the kill.
+	cancelWaitDelay = 5 * time.Second
+)
+
+func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
+	runtimeInfo := backend.RuntimeInfo{Name: "linux", OS: runtime.GOOS, Arch: runtime.GOARCH}
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err == nil {
+		runtimeInfo.Version = unix.ByteSliceToString(uts.Release[:])
+	}
+
+	if !initEnabled.Load() {
+		return backend.ProbeResult{
+			Available:    false,
+			Reason:       "the program does not run the linux-ns sandbox init",
+			FixHints:     []string{"call vibebox.MaybeRunSandboxInit() at the start of main"},
+			Capabilities: capabilities,
+			Runtime:      runtimeInfo,
+		}
+	}
+	sc, err := newSandboxCmd(ctx, false, sandboxSpec{Cwd: "/", Loopback: true, Probe: true})
+	if err == nil {
+		err = sc.run()
+	}
+	if err != nil {
+		return backend.ProbeResult{
+			Available: false,
+			Reason:    fmt.Sprintf("cannot create linux namespaces: %v", err),
+			FixHints: []string{
+				"enable unprivileged user namespaces (sysctl user.max_user_namespaces > 0)",
+				"on Ubuntu 23.10+, allow them with sysctl kernel.apparmor_restrict_unprivileged_userns=0",
+				"inside containers, run with a seccomp profile that permits unshare",
+			},
+			Capabilities: capabilities,
+			Runtime:      runtimeInfo,
+		}
+	}
+	return backend.ProbeResult{Available: true, Capabilities: capabilities, Runtime: runtimeInfo}
+}
+
+func (b *Backend) Start(ctx context.Context, spec backend.RuntimeSpec) error {
+	cwd, err := resolveCwd(spec, "")
+	if err != nil {
+		return err
+	}
+	sb, err := newSandboxSpec(spec, cwd, nil, []string{"/bin/bash"}, "")
+	if err != nil {
+		return err
+	}
+	sc, err := newSandboxCmd(ctx, hostNetwork(spec.Config.LinuxNS), sb)
+	if err != nil {
+		return err
+	}
+	sc.Stdin = spec.IO.Stdin
+	sc.Stdout = spec.IO.Stdout
+	sc.Stderr = spec.IO.Stderr
+	if sc.Stdin == nil {
+		sc.Stdin = os.Stdin
+	}
+	if sc.Stdout == nil {
+		sc.Stdout = os.Stdout
+	}
+	if sc.Stderr == nil {
+		sc.Stderr = os.Stderr
+	}
+	if err := sc.run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("linux-ns shell exited with code %d", exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+// run executes req in a new sandbox. The sandbox init is PID 1 of its
+// namespace, so killing it on cancellation tears down every process it started.
+func (b *Backend) run(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest, tmpDir string) (backend.ExecResult, error) {
+	guestCwd, err := resolveCwd(spec, req.Cwd)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	sb, err := newSandboxSpec(spec, guestCwd, req.Env, backend.CommandArgv(spec, req), tmpDir)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	sc, err := newSandboxCmd(ctx, hostNetwork(spec.Config.LinuxNS), sb)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	sc.Stdin = req.Stdin
+	sc.Stdout = backend.CaptureWriter(stdout, req.Stdout)
+	sc.Stderr = backend.CaptureWriter(stderr, req.Stderr)
+
+	startedAt := time.Now()
+	err = sc.run()
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	if err == nil {
+		return result, nil
+	}
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		sig := sc.signal
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			sig = status.Signal()
+		}
+		if sig != 0 {
+			// Report signals the way a shell does, as 128+n.
+			result.ExitCode = 128 + int(sig)
+			result.Signal = backend.SignalName(sig)
+		}
+		return result, nil
+	}
+	if result.TimedOut {
+		result.ExitCode = -1
+		return result, nil
+	}
+	return result, err
+}
+
+// startShell starts the sandboxed bash of a stateful session. The shell runs
+// under the sandbox init and outlives ctx; it is stopped with Shell.Close.
+func startShell(ctx context.Context, spec backend.RuntimeSpec, h sessionHandle) (*backend.Shell, error) {
+	sb, err := newSandboxSpec(spec, h.defaultCwd, h.defaultEnv, []string{"/bin/bash", "-l"}, h.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := newSandboxCmd(context.Background(), hostNetwork(spec.Config.LinuxNS), sb)
+	if err != nil {
+		return nil, err
+	}
+	shell, err := backend.StartShell(ctx, sc.Cmd)
+	_ = sc.setupW.Close()
+	_ = sc.statusW.Close()
+	_ = sc.statusR.Close()
+	if setupErr := sc.setupError(); setupErr != nil {
+		if shell != nil {
+			_ = shell.Close()
+		}
+		return nil, setupErr
+	}
+	return shell, err
+}
+
+// initRunning reports whether pid is a running sandbox init. The command line
+// is checked too, so a reused pid does not count.
+func initRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	arg0, _, _ := strings.Cut(string(cmdline), "\x00")
+	return arg0 == initArg0
+}
+
+// sandboxCmd re-executes the current binary as the init of a new sandbox. The
+// init reports setup failures through a pipe that closes when it runs the
+// command, and the signal that killed the command through another.
+type sandboxCmd struct {
+	*exec.Cmd
+	setupR  *os.File
+	setupW  *os.File
+	statusR *os.File
+	statusW *os.File
+	// signal is the signal that killed the command, set by run.
+	signal syscall.Signal
+}
+
+func newSandboxCmd(ctx context.Context, shareNetwork bool, sb sandboxSpec) (*sandboxCmd, error) {
+	sb.Root = filepath.Join(os.TempDir(), "vibebox-linux-ns-root")
+	if err := os.MkdirAll(sb.Root, 0o700); err != nil {
+		return nil, fmt.Errorf("create sandbox root: %w", err)
+	}
+	data, err := json.Marshal(sb)
+	if err != nil {
+		return nil, err
+	}
+	setupR, setupW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		_ = setupR.Close()
+		_ = setupW.Close()
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{initArg0}
+	cmd.Env = []string{initEnv + "=" + string(data)}
+	cmd.ExtraFiles = []*os.File{setupW, statusW}
+	cmd.WaitDelay = cancelWaitDelay
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if !shareNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 flags,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	return &sandboxCmd{Cmd: cmd, setupR: setupR, setupW: setupW, statusR: statusR, statusW: statusW}, nil
+}
+
+// run starts the sandbox and waits for it. Setup failures take precedence over
+// the exit status.
+func (c *sandboxCmd) run() error {
+	err := c.Start()
+	_ = c.setupW.Close()
+	_ = c.statusW.Close()
+	if err != nil {
+		_ = c.setupR.Close()
+		_ = c.statusR.Close()
+		return err
+	}
+	err = c.Wait()
+	status, _ := io.ReadAll(c.statusR)
+	_ = c.statusR.Close()
+	if n, convErr := strconv.Atoi(string(status)); convErr == nil {
+		c.signal = syscall.Signal(n)
+	}
+	if setupErr := c.setupError(); setupErr != nil {
+		return setupErr
+	}
+	return err
+}
+
+// setupError returns the failure reported by the sandbox init, if any. It
+// blocks until the init either runs the command or exits.
+func (c *sandboxCmd) setupError() error {
+	msg, _ := io.ReadAll(c.setupR)
+	_ = c.setupR.Close()
+	if len(msg) == 0 {
+		return nil
+	}
+	return fmt.Errorf("linux-ns sandbox setup: %s", msg)
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"vibebox/internal/backend"
+)
+
+func TestProbeSession(t *testing.T) {
+	t.Parallel()
+	fakeInit := exec.Command("sleep", "30")
+	fakeInit.Args[0] = initArg0
+	if err := fakeInit.Start(); err != nil {
+		t.Fatalf("start fake init: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = fakeInit.Process.Kill()
+		_ = fakeInit.Wait()
+	})
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		session persistedSession
+		gone    bool
+	}{
+		{name: "stateless", session: persistedSession{}},
+		{name: "missing tmp dir", session: persistedSession{TmpDir: "missing"}, gone: true},
+		{name: "running init", session: persistedSession{Stateful: true, InitPID: fakeInit.Process.Pid}},
+		{name: "exited init", session: persistedSession{Stateful: true, InitPID: exited.Process.Pid}, gone: true},
+		{name: "pid of another program", session: persistedSession{Stateful: true, InitPID: os.Getpid()}, gone: true},
+		{name: "no init recorded", session: persistedSession{Stateful: true}, gone: true},
+	}
+	for _, tc := range cases {
+		tmpDir := t.TempDir()
+		if tc.session.TmpDir != "" {
+			tmpDir = filepath.Join(tmpDir, tc.session.TmpDir)
+		}
+		tc.session.TmpDir = tmpDir
+		data, err := json.Marshal(tc.session)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tc.name, err)
+		}
+		err = New().ProbeSession(context.Background(), backend.RuntimeSpec{}, data)
+		if gone := errors.Is(err, backend.ErrSessionGone); gone != tc.gone {
+			t.Fatalf("%s: expected gone %v, got %v", tc.name, tc.gone, err)
+		}
+		if _, statErr := os.Stat(tmpDir); tc.gone == (statErr == nil) {
+			t.Fatalf("%s: tmp dir should be removed only with a gone session: %v", tc.name, statErr)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !linux
+
+package linuxns
+
+import (
+	"context"
+	"fmt"
+
+	"vibebox/internal/backend"
+)
+
+// MaybeRunInit does nothing outside linux, where the backend never re-executes
+// the program.
+func MaybeRunInit() {}
+
+func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
+	_ = ctx
+	return backend.ProbeResult{
+		Available:    false,
+		Reason:       "linux-ns backend is only available on linux",
+		FixHints:     []string{"use provider=docker or provider=off on non-linux hosts"},
+		Capabilities: capabilities,
+	}
+}
+
+func (b *Backend) Start(ctx context.Context, spec backend.RuntimeSpec) error {
+	_ = ctx
+	_ = spec
+	return fmt.Errorf("linux-ns backend is only available on linux")
+}
+
+func (b *Backend) run(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest, tmpDir string) (backend.ExecResult, error) {
+	_ = ctx
+	_ = spec
+	_ = req
+	_ = tmpDir
+	return backend.ExecResult{}, fmt.Errorf("linux-ns backend is only available on linux")
+}
+
+func initRunning(pid int) bool {
+	_ = pid
+	return false
+}
+
+func startShell(ctx context.Context, spec backend.RuntimeSpec, h sessionHandle) (*backend.Shell, error) {
+	_ = ctx
+	_ = spec
+	_ = h
+	return nil, fmt.Errorf("linux-ns backend is only available on linux")
+}
@@ -0,0 +1,363 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// setupFD is the pipe on which the init reports setup failures (ExtraFiles[0]).
+	setupFD = 3
+	// statusFD is the pipe on which the init reports the signal that killed
+	// the command (ExtraFiles[1]).
+	statusFD = 4
+)
+
+// forwardedSignals are passed on from the init to the command.
+var forwardedSignals = []os.Signal{
+	unix.SIGTERM, unix.SIGINT, unix.SIGHUP, unix.SIGQUIT, unix.SIGUSR1, unix.SIGUSR2, unix.SIGWINCH,
+}
+
+// systemDirs are bound read-only from the host when present; host symlinks
+// such as /bin -> usr/bin are recreated instead.
+var systemDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt"}
+
+// devices are bound from the host into the sandbox's /dev.
+var devices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// initEnabled records that the program calls MaybeRunInit, so the backend can
+// re-execute it as a sandbox init.
+var initEnabled atomic.Bool
+
+// MaybeRunInit must be called at the start of main by programs that use the
+// backend. In a process re-executed as a sandbox init it sets up the sandbox
+// and runs the command without returning; otherwise it returns immediately.
+func MaybeRunInit() {
+	initEnabled.Store(true)
+	data, ok := os.LookupEnv(initEnv)
+	if !ok || len(os.Args) == 0 || os.Args[0] != initArg0 {
+		return
+	}
+	runtime.LockOSThread()
+	var sb sandboxSpec
+	err := json.Unmarshal([]byte(data), &sb)
+	if err == nil {
+		err = setupSandbox(sb)
+	}
+	if err != nil {
+		report := os.NewFile(setupFD, "setup")
+		_, _ = report.WriteString(err.Error())
+		os.Exit(setupFailedExitCode)
+	}
+	if sb.Probe {
+		os.Exit(0)
+	}
+	os.Exit(runCommand(sb))
+}
+
+// setupSandbox builds the sandbox filesystem and switches into it. It runs as
+// root of the new user namespace, before the command.
+func setupSandbox(sb sandboxSpec) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	root := sb.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount sandbox root: %w", err)
+	}
+	for _, dir := range systemDirs {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(dir)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, filepath.Join(root, dir)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := bindPath(dir, filepath.Join(root, dir), true); err != nil {
+			return err
+		}
+	}
+	if err := setupProc(root); err != nil {
+		return err
+	}
+	if err := setupDev(root); err != nil {
+		return err
+	}
+	if err := setupTmp(root, sb.TmpDir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(filepath.Join(root, "root"), 0o700); err != nil {
+		return err
+	}
+	for _, m := range sb.Mounts {
+		if err := bindPath(m.Host, filepath.Join(root, m.Guest), m.ReadOnly); err != nil {
+			return err
+		}
+	}
+	if err := pivotRoot(root); err != nil {
+		return err
+	}
+	if err := unix.Sethostname([]byte("vibebox")); err != nil {
+		return fmt.Errorf("set hostname: %w", err)
+	}
+	if sb.Loopback {
+		if err := loopbackUp(); err != nil {
+			return err
+		}
+	}
+	if err := os.Chdir(sb.Cwd); err != nil {
+		return err
+	}
+	if sb.Landlock || sb.Seccomp {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs: %w", err)
+		}
+	}
+	if sb.Landlock {
+		writable := []string{"/tmp", "/dev", "/root"}
+		for _, m := range sb.Mounts {
+			if !m.ReadOnly {
+				writable = append(writable, m.Guest)
+			}
+		}
+		if err := applyLandlock(writable); err != nil {
+			return fmt.Errorf("landlock: %w", err)
+		}
+	}
+	if sb.Seccomp {
+		if err := applySeccomp(); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+	return nil
+}
+
+// bindPath binds source onto target, creating target to match the source type.
+func bindPath(source, target string, readOnly bool) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0o755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644); err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("create mount point %s: %w", target, err)
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", source, err)
+	}
+	if !readOnly {
+		return nil
+	}
+	// A read-only remount must keep the locked flags of the host mount, or the
+	// kernel refuses it inside a user namespace.
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for _, f := range []uintptr{unix.ST_NOSUID, unix.ST_NODEV, unix.ST_NOEXEC, unix.ST_NOATIME, unix.ST_NODIRATIME, unix.ST_RELATIME} {
+		if uintptr(st.Flags)&f != 0 {
+			flags |= statfsToMountFlag[f]
+		}
+	}
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %w", source, err)
+	}
+	return nil
+}
+
+var statfsToMountFlag = map[uintptr]uintptr{
+	unix.ST_NOSUID:     unix.MS_NOSUID,
+	unix.ST_NODEV:      unix.MS_NODEV,
+	unix.ST_NOEXEC:     unix.MS_NOEXEC,
+	unix.ST_NOATIME:    unix.MS_NOATIME,
+	unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+	unix.ST_RELATIME:   unix.MS_RELATIME,
+}
+
+func setupProc(root string) error {
+	target := filepath.Join(root, "proc")
+	if err := os.Mkdir(target, 0o555); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", target, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	return nil
+}
+
+func setupDev(root string) error {
+	dev := filepath.Join(root, "dev")
+	if err := os.Mkdir(dev, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=0755"); err != nil {
+		return fmt.Errorf("mount /dev: %w", err)
+	}
+	for _, name := range devices {
+		if _, err := os.Stat("/dev/" + name); err != nil {
+			continue
+		}
+		if err := bindPath("/dev/"+name, filepath.Join(dev, name), false); err != nil {
+			return err
+		}
+	}
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	shm := filepath.Join(dev, "shm")
+	if err := os.Mkdir(shm, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", shm, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /dev/shm: %w", err)
+	}
+	return nil
+}
+
+// setupTmp mounts a private tmpfs at /tmp, or the session's host directory.
+func setupTmp(root, hostDir string) error {
+	target := filepath.Join(root, "tmp")
+	if hostDir != "" {
+		return bindPath(hostDir, target, false)
+	}
+	if err := os.Mkdir(target, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", target, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %w", err)
+	}
+	return nil
+}
+
+// pivotRoot makes root the filesystem root and detaches the host tree.
+func pivotRoot(root string) error {
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0o700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.oldroot", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+	return os.Remove("/.oldroot")
+}
+
+// loopbackUp brings up lo in the new network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	return nil
+}
+
+// runCommand runs the command as the child of the init, which stays PID 1 of
+// the sandbox: the kernel drops signals to PID 1 that have no handler, and
+// orphans are reparented to it. The init forwards forwardedSignals to the
+// command and reaps every process until the command exits, then exits with
+// its shell-style status, which kills whatever is left in the namespace. It
+// must run on the thread that applied landlock and seccomp, which the command
+// inherits from it.
+func runCommand(sb sandboxSpec) int {
+	unix.CloseOnExec(setupFD)
+	unix.CloseOnExec(statusFD)
+	for _, e := range sb.Env {
+		if k, v, ok := strings.Cut(e, "="); ok && k == "PATH" {
+			_ = os.Setenv("PATH", v)
+		}
+	}
+	path, err := exec.LookPath(sb.Argv[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 127
+	}
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, forwardedSignals...)
+	cmd := &exec.Cmd{Path: path, Args: sb.Argv, Env: sb.Env, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "exec %s: %v\n", sb.Argv[0], err)
+		return 126
+	}
+	// Closing the setup pipe tells the parent the command is running.
+	_ = unix.Close(setupFD)
+	pid := cmd.Process.Pid
+	go func() {
+		for sig := range signals {
+			_ = unix.Kill(pid, sig.(unix.Signal))
+		}
+	}()
+	for {
+		var status unix.WaitStatus
+		reaped, err := unix.Wait4(-1, &status, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wait %s: %v\n", sb.Argv[0], err)
+			return 126
+		}
+		if reaped != pid {
+			continue
+		}
+		if !status.Signaled() {
+			return status.ExitStatus()
+		}
+		// PID 1 cannot die of a signal it sends itself, so the signal is
+		// reported on the status pipe and the exit code mirrors a shell's.
+		report := os.NewFile(statusFD, "status")
+		_, _ = report.WriteString(strconv.Itoa(int(status.Signal())))
+		return 128 + int(status.Signal())
+	}
+}
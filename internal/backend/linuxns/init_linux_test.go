@@ -0,0 +1,41 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+func TestMain(m *testing.M) {
+	MaybeRunInit()
+	os.Exit(m.Run())
+}
+
+func TestInitForwardsSignalsToCommand(t *testing.T) {
+	t.Parallel()
+	b := New()
+	if probe := b.Probe(context.Background()); !probe.Available {
+		t.Skipf("linux-ns unavailable: %s", probe.Reason)
+	}
+	spec := backend.RuntimeSpec{ProjectRoot: t.TempDir(), Config: config.Default()}
+
+	// The background job signals the init, which must pass TERM on to sleep.
+	result, err := b.Exec(context.Background(), spec, backend.ExecRequest{
+		Command: "(sleep 0.2; kill -TERM 1) & exec sleep 30",
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if result.ExitCode != 143 || result.Signal != "TERM" {
+		t.Fatalf("expected sleep to die of TERM, got exit %d signal %q stderr %q", result.ExitCode, result.Signal, result.Stderr)
+	}
+	if result.Duration > 10*time.Second {
+		t.Fatalf("TERM'd sleep took %s to exit", result.Duration)
+	}
+}
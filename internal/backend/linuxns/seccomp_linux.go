@@ -0,0 +1,92 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls fail with EPERM under linux_ns.seccomp. They change mounts or
+// namespaces, inspect other processes, or reach into the kernel.
+var deniedSyscalls = []uint32{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT,
+	unix.SYS_FSOPEN, unix.SYS_FSMOUNT, unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE, unix.SYS_MOUNT_SETATTR,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_KEXEC_LOAD, unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_REBOOT, unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_OPEN_BY_HANDLE_AT,
+}
+
+// namespaceCloneFlags are rejected in clone(2) so commands cannot nest namespaces.
+const namespaceCloneFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC |
+	unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWCGROUP
+
+// Offsets into struct seccomp_data.
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16 // low word on little-endian architectures
+)
+
+// applySeccomp installs the deny-list filter on the calling thread, which must
+// then exec the command. no_new_privs must already be set.
+func applySeccomp() error {
+	var arch uint32
+	switch runtime.GOARCH {
+	case "amd64":
+		arch = unix.AUDIT_ARCH_X86_64
+	case "arm64":
+		arch = unix.AUDIT_ARCH_AARCH64
+	default:
+		return fmt.Errorf("not supported on %s", runtime.GOARCH)
+	}
+	filter := seccompFilter(arch, runtime.GOARCH == "amd64")
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
+
+// seccompFilter builds the BPF program. Each check is a compare followed by a
+// return, so no jump spans more than a few instructions.
+func seccompFilter(arch uint32, x32 bool) []unix.SockFilter {
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	var prog []unix.SockFilter
+	load := func(offset uint32) {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offset})
+	}
+	jump := func(op uint16, k uint32, jt, jf uint8) {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, Jt: jt, Jf: jf, K: k})
+	}
+	ret := func(k uint32) {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: k})
+	}
+
+	// Syscalls of a foreign ABI use different numbers; refuse them outright.
+	load(seccompDataArch)
+	jump(unix.BPF_JEQ, arch, 1, 0)
+	ret(deny)
+	load(seccompDataNr)
+	if x32 {
+		jump(unix.BPF_JGE, 0x40000000, 0, 1)
+		ret(deny)
+	}
+	for _, nr := range deniedSyscalls {
+		jump(unix.BPF_JEQ, nr, 0, 1)
+		ret(deny)
+	}
+	// clone3 passes flags in memory the filter cannot read; ENOSYS makes libc
+	// fall back to clone, whose flags are checked below.
+	jump(unix.BPF_JEQ, unix.SYS_CLONE3, 0, 1)
+	ret(uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)))
+	jump(unix.BPF_JEQ, unix.SYS_CLONE, 0, 3)
+	load(seccompDataArg0)
+	jump(unix.BPF_JSET, namespaceCloneFlags, 0, 1)
+	ret(deny)
+	ret(unix.SECCOMP_RET_ALLOW)
+	return prog
+}
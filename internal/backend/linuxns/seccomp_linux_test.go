@@ -0,0 +1,85 @@
+//go:build linux
+
+package linuxns
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runFilter evaluates the subset of classic BPF emitted by seccompFilter
+// against a syscall and returns the filter's verdict.
+func runFilter(t *testing.T, prog []unix.SockFilter, arch, nr uint32, arg0 uint64) uint32 {
+	t.Helper()
+	data := map[uint32]uint32{seccompDataNr: nr, seccompDataArch: arch, seccompDataArg0: uint32(arg0)}
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = data[ins.K]
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K:
+			var match bool
+			switch ins.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				match = acc == ins.K
+			case unix.BPF_JGE:
+				match = acc >= ins.K
+			case unix.BPF_JSET:
+				match = acc&ins.K != 0
+			}
+			if match {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", ins.Code, pc)
+		}
+	}
+	t.Fatalf("filter fell off its end")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	t.Parallel()
+	const arch = unix.AUDIT_ARCH_X86_64
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	enosys := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS))
+	allow := uint32(unix.SECCOMP_RET_ALLOW)
+
+	cases := []struct {
+		name string
+		arch uint32
+		x32  bool
+		nr   uint32
+		arg0 uint64
+		want uint32
+	}{
+		{name: "read", arch: arch, nr: unix.SYS_READ, want: allow},
+		{name: "foreign arch", arch: unix.AUDIT_ARCH_I386, nr: unix.SYS_READ, want: deny},
+		{name: "mount", arch: arch, nr: unix.SYS_MOUNT, want: deny},
+		{name: "unshare", arch: arch, nr: unix.SYS_UNSHARE, want: deny},
+		{name: "ptrace", arch: arch, nr: unix.SYS_PTRACE, want: deny},
+		{name: "x32 abi", arch: arch, x32: true, nr: 0x40000000 | unix.SYS_READ, want: deny},
+		{name: "x32 check off", arch: arch, nr: 0x40000000 | unix.SYS_READ, want: allow},
+		{name: "clone3", arch: arch, nr: unix.SYS_CLONE3, want: enosys},
+		{name: "clone thread", arch: arch, nr: unix.SYS_CLONE, arg0: unix.CLONE_VM | unix.CLONE_THREAD, want: allow},
+		{name: "clone user namespace", arch: arch, nr: unix.SYS_CLONE, arg0: unix.CLONE_NEWUSER, want: deny},
+		{name: "clone net namespace", arch: arch, nr: unix.SYS_CLONE, arg0: unix.CLONE_NEWNET | uint64(unix.SIGCHLD), want: deny},
+	}
+	for _, tc := range cases {
+		prog := seccompFilter(arch, tc.x32)
+		if got := runFilter(t, prog, tc.arch, tc.nr, tc.arg0); got != tc.want {
+			t.Fatalf("%s: verdict %#x, want %#x", tc.name, got, tc.want)
+		}
+	}
+	for _, nr := range deniedSyscalls {
+		if got := runFilter(t, seccompFilter(arch, true), arch, nr, 0); got != deny {
+			t.Fatalf("syscall %d: verdict %#x, want deny", nr, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package macos
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -23,6 +24,15 @@ type sessionHandle struct {
 	defaultEnv map[string]string
 }
 
+// capabilities of the VM in transitional mode: each exec boots its own VM, output
+// is collected once a command finishes and the guest shares the host network.
+var capabilities = backend.Capabilities{
+	Mounts: true,
+	Env:    true,
+	Cwd:    true,
+	Stdin:  true,
+}
+
 func New() *Backend {
 	return &Backend{}
 }
@@ -57,6 +67,9 @@ func (b *Backend) Prepare(ctx context.Context, spec backend.RuntimeSpec) error {
 
 func (b *Backend) StartSession(ctx context.Context, spec backend.RuntimeSpec, req backend.SessionStartRequest) (backend.SessionHandle, error) {
 	_ = ctx
+	if req.Stateful {
+		return nil, fmt.Errorf("apple-vm backend does not support stateful sessions")
+	}
 	workspaceGuest := workspaceGuestFromSpec(spec)
 	if req.Cwd != "" && !strings.HasPrefix(req.Cwd, "/") {
 		projectGuest, ok := projectRootGuestFromSpec(spec)
@@ -89,10 +102,16 @@ func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, h
 		env[k] = v
 	}
 	return b.Exec(ctx, spec, backend.ExecRequest{
-		Command: req.Command,
-		Cwd:     effectiveCwd,
-		Env:     env,
-		Timeout: req.Timeout,
+		ExecID:         req.ExecID,
+		Command:        req.Command,
+		Args:           req.Args,
+		Cwd:            effectiveCwd,
+		Env:            env,
+		Timeout:        req.Timeout,
+		Stdin:          req.Stdin,
+		Stdout:         req.Stdout,
+		Stderr:         req.Stderr,
+		MaxOutputBytes: req.MaxOutputBytes,
 	})
 }
 
@@ -104,6 +123,31 @@ func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, han
 	return nil
 }
 
+// persistedSession is the registry form of sessionHandle.
+type persistedSession struct {
+	DefaultCwd string            `json:"defaultCwd"`
+	DefaultEnv map[string]string `json:"defaultEnv,omitempty"`
+}
+
+func (b *Backend) MarshalSession(handle backend.SessionHandle) ([]byte, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid apple-vm session handle")
+	}
+	return json.Marshal(persistedSession{DefaultCwd: h.defaultCwd, DefaultEnv: h.defaultEnv})
+}
+
+func (b *Backend) ResumeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) (backend.SessionHandle, error) {
+	_ = ctx
+	_ = spec
+	// Transitional mode: sessions hold no VM, so only the defaults need restoring.
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode apple-vm session: %w", err)
+	}
+	return sessionHandle{defaultCwd: p.DefaultCwd, defaultEnv: cloneMap(p.DefaultEnv)}, nil
+}
+
 func resolveVMGuestCwd(projectRoot, requested, workspaceGuest string) (string, error) {
 	if requested == "" {
 		return workspaceGuest, nil
@@ -118,7 +162,7 @@ func resolveVMGuestCwd(projectRoot, requested, workspaceGuest string) (string, e
 		return "", err
 	}
 	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-		return "", fmt.Errorf("cwd %s escapes project root %s", hostPath, projectRoot)
+		return "", fmt.Errorf("cwd %s %w %s", hostPath, backend.ErrEscapesProjectRoot, projectRoot)
 	}
 	return filepath.ToSlash(filepath.Join(workspaceGuest, rel)), nil
 }
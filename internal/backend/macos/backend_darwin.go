@@ -5,6 +5,7 @@ package macos
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,6 +37,7 @@ const (
 	stdoutEndMarker     = "__VIBEBOX_STDOUT_END__"
 	stderrBeginMarker   = "__VIBEBOX_STDERR_BEGIN__"
 	stderrEndMarker     = "__VIBEBOX_STDERR_END__"
+	stdinDelimiter      = "__VIBEBOX_STDIN_EOF__"
 	virtualizationEntID = "com.apple.security.virtualization"
 )
 
@@ -86,6 +89,16 @@ func shellExports(env map[string]string) string {
 }
 
 func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
+	result := b.probe(ctx)
+	result.Capabilities = capabilities
+	result.Runtime = backend.RuntimeInfo{Name: "macOS", OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if out, err := exec.CommandContext(ctx, "sw_vers", "-productVersion").Output(); err == nil {
+		result.Runtime.Version = strings.TrimSpace(string(out))
+	}
+	return result
+}
+
+func (b *Backend) probe(ctx context.Context) backend.ProbeResult {
 	if _, err := vz.NewEFIBootLoader(); err != nil {
 		switch {
 		case errors.Is(err, vz.ErrUnsupportedOSVersion):
@@ -249,7 +262,20 @@ func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backen
 		return backend.ExecResult{}, err
 	}
 
-	script := buildExecScript(guestCwd, req)
+	var stdinData []byte
+	if req.Stdin != nil {
+		stdinData, err = io.ReadAll(req.Stdin)
+		if err != nil {
+			_ = vm.TryStop(context.Background())
+			return backend.ExecResult{}, fmt.Errorf("read exec stdin: %w", err)
+		}
+	}
+	if err := vm.SendLine(buildStdinScript(stdinData)); err != nil {
+		_ = vm.TryStop(context.Background())
+		return backend.ExecResult{}, err
+	}
+	script := buildExecScript(guestCwd, backend.CommandArgv(spec, req), req.Env)
+	startedAt := time.Now()
 	if err := vm.SendLine(script); err != nil {
 		_ = vm.TryStop(context.Background())
 		return backend.ExecResult{}, err
@@ -263,6 +289,7 @@ func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backen
 		_ = vm.TryStop(context.Background())
 		return backend.ExecResult{}, err
 	}
+	duration := time.Since(startedAt)
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
 	defer cancel()
@@ -273,25 +300,50 @@ func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backen
 	output := vm.Output()
 	stdout, stderr, exitCode, ok := parseStructuredExecOutput(output)
 	if ok {
-		return backend.ExecResult{
-			Stdout:   stdout,
-			Stderr:   stderr,
-			ExitCode: exitCode,
-		}, nil
+		forwardOutput(req, stdout, stderr)
+		return timedResult(capturedResult(req, stdout, stderr, exitCode), startedAt, duration), nil
 	}
 
 	parsedExit, hasExit := parseExitMarker(output, exitCodeMarker)
 	if hasExit {
-		return backend.ExecResult{
-			Stdout:   stripExitMarker(output, exitCodeMarker),
-			Stderr:   "",
-			ExitCode: parsedExit,
-		}, nil
+		stdout := stripExitMarker(output, exitCodeMarker)
+		forwardOutput(req, stdout, "")
+		return timedResult(capturedResult(req, stdout, "", parsedExit), startedAt, duration), nil
 	}
 
 	return backend.ExecResult{}, fmt.Errorf("apple-vm exec did not produce exit marker; last output: %s", tail(output, 512))
 }
 
+// forwardOutput delivers parsed console output to live writers. The VM console
+// is only demultiplexed after the command exits, so chunks arrive in one piece.
+func forwardOutput(req backend.ExecRequest, stdout, stderr string) {
+	if req.Stdout != nil && stdout != "" {
+		_, _ = io.WriteString(req.Stdout, stdout)
+	}
+	if req.Stderr != nil && stderr != "" {
+		_, _ = io.WriteString(req.Stderr, stderr)
+	}
+}
+
+// capturedResult applies req.MaxOutputBytes to output parsed from the VM console.
+func capturedResult(req backend.ExecRequest, stdout, stderr string, exitCode int) backend.ExecResult {
+	outCapture := backend.NewOutputCapture(req.MaxOutputBytes)
+	errCapture := backend.NewOutputCapture(req.MaxOutputBytes)
+	_, _ = io.WriteString(outCapture, stdout)
+	_, _ = io.WriteString(errCapture, stderr)
+	result := backend.CapturedResult(outCapture, errCapture)
+	result.ExitCode = exitCode
+	return result
+}
+
+// timedResult records command timing. The VM console only reports the guest
+// shell's $?, so no terminating signal is derived from it.
+func timedResult(result backend.ExecResult, startedAt time.Time, duration time.Duration) backend.ExecResult {
+	result.StartedAt = startedAt.UTC()
+	result.Duration = duration
+	return result
+}
+
 func (b *Backend) provisionInstance(ctx context.Context, spec backend.RuntimeSpec) error {
 	scriptPath := strings.TrimSpace(spec.Config.VM.ProvisionScript)
 	if scriptPath == "" {
@@ -690,12 +742,16 @@ func (r *vmRuntime) Close() error {
 	return nil
 }
 
-func buildExecScript(guestCwd string, req backend.ExecRequest) string {
+func buildExecScript(guestCwd string, argv []string, env map[string]string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
 	return fmt.Sprintf(
-		"tmp_out=$(mktemp); tmp_err=$(mktemp); (cd %s && %sbash -lc %s) >\"$tmp_out\" 2>\"$tmp_err\"; rc=$?; printf '%s\\n'; cat \"$tmp_out\"; printf '\\n%s\\n'; printf '%s\\n'; cat \"$tmp_err\"; printf '\\n%s\\n'; printf '%s%%s\\n' \"$rc\"; rm -f \"$tmp_out\" \"$tmp_err\"; poweroff",
+		"tmp_out=$(mktemp); tmp_err=$(mktemp); (cd %s && %s%s) <\"$tmp_in\" >\"$tmp_out\" 2>\"$tmp_err\"; rc=$?; printf '%s\\n'; cat \"$tmp_out\"; printf '\\n%s\\n'; printf '%s\\n'; cat \"$tmp_err\"; printf '\\n%s\\n'; printf '%s%%s\\n' \"$rc\"; rm -f \"$tmp_out\" \"$tmp_err\"; poweroff",
 		shellQuote(guestCwd),
-		shellExports(req.Env),
-		shellQuote(req.Command),
+		shellExports(env),
+		strings.Join(quoted, " "),
 		stdoutBeginMarker,
 		stdoutEndMarker,
 		stderrBeginMarker,
@@ -704,6 +760,28 @@ func buildExecScript(guestCwd string, req backend.ExecRequest) string {
 	)
 }
 
+// buildStdinScript stages exec stdin in a guest temp file referenced by $tmp_in.
+// The payload is base64-wrapped so arbitrary bytes survive the serial console.
+func buildStdinScript(data []byte) string {
+	if len(data) == 0 {
+		return "tmp_in=/dev/null"
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	b.WriteString("tmp_in=$(mktemp); base64 -d >\"$tmp_in\" <<'")
+	b.WriteString(stdinDelimiter)
+	b.WriteString("'\n")
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\n")
+	b.WriteString(stdinDelimiter)
+	return b.String()
+}
+
 func buildProvisionCommand(script string) string {
 	delimiter := "__VIBEBOX_PROVISION_EOF__"
 	for strings.Contains(script, delimiter) {
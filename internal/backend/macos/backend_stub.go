@@ -12,9 +12,10 @@ import (
 func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
 	_ = ctx
 	return backend.ProbeResult{
-		Available: false,
-		Reason:    "apple-vm backend is only available on darwin",
-		FixHints:  []string{"use provider=docker or provider=off on non-darwin hosts"},
+		Available:    false,
+		Reason:       "apple-vm backend is only available on darwin",
+		FixHints:     []string{"use provider=docker or provider=off on non-darwin hosts"},
+		Capabilities: capabilities,
 	}
 }
 
@@ -1,14 +1,18 @@
 package off
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"vibebox/internal/backend"
 )
@@ -19,6 +23,8 @@ type Backend struct{}
 type sessionHandle struct {
 	cwd string
 	env map[string]string
+	// shell is the long-lived shell of a stateful session, nil otherwise.
+	shell *backend.Shell
 }
 
 func New() *Backend {
@@ -29,16 +35,33 @@ func (b *Backend) Name() string {
 	return "off"
 }
 
+// capabilities of host execution: no isolation and no mounts, since commands
+// see the host filesystem directly.
+var capabilities = backend.Capabilities{
+	Env:                 true,
+	Cwd:                 true,
+	Stdin:               true,
+	FileTransfer:        true,
+	BackgroundProcesses: true,
+	LiveOutput:          true,
+	StatefulShell:       true,
+}
+
 func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
-	_ = ctx
+	runtimeInfo := backend.RuntimeInfo{Name: "host", OS: runtime.GOOS, Arch: runtime.GOARCH}
 	if _, err := exec.LookPath("/bin/bash"); err != nil {
 		return backend.ProbeResult{
-			Available: false,
-			Reason:    "/bin/bash not found",
-			FixHints:  []string{"install bash or configure shell path"},
+			Available:    false,
+			Reason:       "/bin/bash not found",
+			FixHints:     []string{"install bash or configure shell path"},
+			Capabilities: capabilities,
+			Runtime:      runtimeInfo,
 		}
 	}
-	return backend.ProbeResult{Available: true}
+	if out, err := exec.CommandContext(ctx, "/bin/bash", "-c", "echo $BASH_VERSION").Output(); err == nil {
+		runtimeInfo.Version = "bash " + strings.TrimSpace(string(out))
+	}
+	return backend.ProbeResult{Available: true, Capabilities: capabilities, Runtime: runtimeInfo}
 }
 
 func (b *Backend) Prepare(ctx context.Context, spec backend.RuntimeSpec) error {
@@ -71,26 +94,38 @@ func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backen
 		return backend.ExecResult{}, err
 	}
 
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-lc", req.Command)
+	argv := backend.CommandArgv(spec, req)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Dir = hostCwd
 	cmd.Env = mergeRestrictedEnv(req.Env)
+	killProcessGroupOnCancel(cmd)
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = backend.CaptureWriter(stdout, req.Stdout)
+	cmd.Stderr = backend.CaptureWriter(stderr, req.Stderr)
 
+	startedAt := time.Now()
 	err = cmd.Run()
-	result := backend.ExecResult{
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
-		ExitCode: 0,
-	}
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
 	if err == nil {
 		return result, nil
 	}
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
 	if exitErr, ok := err.(*exec.ExitError); ok {
-		result.ExitCode = exitErr.ExitCode()
+		exit, _ := processExit(exitErr, exitErr.ProcessState)
+		result.ExitCode = exit.ExitCode
+		result.Signal = exit.Signal
+		return result, nil
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		// Report a missing argv executable the way a shell reports a missing command.
+		result.ExitCode = 127
+		result.Stderr = err.Error() + "\n"
+		result.StderrBytes = int64(len(result.Stderr))
 		return result, nil
 	}
 	return result, err
@@ -102,10 +137,16 @@ func (b *Backend) StartSession(ctx context.Context, spec backend.RuntimeSpec, re
 	if err != nil {
 		return nil, err
 	}
-	return sessionHandle{
+	h := sessionHandle{
 		cwd: hostCwd,
 		env: cloneMap(req.Env),
-	}, nil
+	}
+	if req.Stateful {
+		if h.shell, err = startShell(ctx, h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
 }
 
 func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ExecResult, error) {
@@ -113,34 +154,129 @@ func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, h
 	if !ok {
 		return backend.ExecResult{}, fmt.Errorf("invalid off session handle")
 	}
-	effectiveCwd := req.Cwd
-	if effectiveCwd == "" {
-		effectiveCwd = h.cwd
-	}
-	effectiveEnv := cloneMap(h.env)
-	for k, v := range req.Env {
-		effectiveEnv[k] = v
+	if h.shell != nil {
+		cwd := ""
+		if req.Cwd != "" {
+			var err error
+			if cwd, err = resolveHostCwd(spec.ProjectRoot, req.Cwd); err != nil {
+				return backend.ExecResult{}, err
+			}
+		}
+		return h.shell.Exec(ctx, req, cwd, h.shell.KillJobs)
 	}
-	return b.Exec(ctx, spec, backend.ExecRequest{
-		Command: req.Command,
-		Cwd:     effectiveCwd,
-		Env:     effectiveEnv,
-		Timeout: req.Timeout,
-	})
+	return b.Exec(ctx, spec, h.apply(req))
 }
 
 func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle) error {
 	_ = ctx
 	_ = spec
-	_ = handle
+	if h, ok := handle.(sessionHandle); ok && h.shell != nil {
+		return h.shell.Close()
+	}
 	return nil
 }
 
+// persistedSession is the registry form of sessionHandle.
+type persistedSession struct {
+	Cwd      string            `json:"cwd"`
+	Env      map[string]string `json:"env,omitempty"`
+	Stateful bool              `json:"stateful,omitempty"`
+}
+
+func (b *Backend) MarshalSession(handle backend.SessionHandle) ([]byte, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid off session handle")
+	}
+	return json.Marshal(persistedSession{Cwd: h.cwd, Env: h.env, Stateful: h.shell != nil})
+}
+
+// ProbeSession reports a session gone once its working directory is, since a
+// host session holds nothing else.
+func (b *Backend) ProbeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) error {
+	_ = ctx
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("decode off session: %w", err)
+	}
+	dir := p.Cwd
+	if dir == "" {
+		dir = spec.ProjectRoot
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("off session directory %s: %w", dir, backend.ErrSessionGone)
+	}
+	return nil
+}
+
+func (b *Backend) ResumeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) (backend.SessionHandle, error) {
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode off session: %w", err)
+	}
+	hostCwd, err := resolveHostCwd(spec.ProjectRoot, p.Cwd)
+	if err != nil {
+		return nil, err
+	}
+	h := sessionHandle{cwd: hostCwd, env: cloneMap(p.Env)}
+	if p.Stateful {
+		// The previous shell died with the process that owned it; state starts over.
+		if h.shell, err = startShell(ctx, h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// startShell starts the host bash of a stateful session.
+func startShell(ctx context.Context, h sessionHandle) (*backend.Shell, error) {
+	cmd := exec.Command("/bin/bash", "-l")
+	cmd.Dir = h.cwd
+	cmd.Env = mergeRestrictedEnv(h.env)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return backend.StartShell(ctx, cmd)
+}
+
+// apply fills session defaults into a per-command request. Stateful sessions
+// use the shell's current directory and environment.
+func (h sessionHandle) apply(req backend.ExecRequest) backend.ExecRequest {
+	defaultCwd, defaultEnv := h.cwd, h.env
+	if h.shell != nil {
+		defaultCwd, defaultEnv = h.shell.State()
+	}
+	if req.Cwd == "" {
+		req.Cwd = defaultCwd
+	}
+	env := cloneMap(defaultEnv)
+	for k, v := range req.Env {
+		env[k] = v
+	}
+	req.Env = env
+	return req
+}
+
 func resolveHostCwd(projectRoot string, requested string) (string, error) {
 	if requested == "" {
 		return projectRoot, nil
 	}
 
+	host, err := resolveHostPath(projectRoot, requested)
+	if err != nil {
+		return "", fmt.Errorf("cwd %w", err)
+	}
+	info, err := os.Stat(host)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cwd is not a directory: %s", host)
+	}
+	return host, nil
+}
+
+// resolveHostPath maps requested onto the host and rejects paths outside projectRoot.
+// Relative paths resolve against projectRoot.
+func resolveHostPath(projectRoot string, requested string) (string, error) {
 	var host string
 	if filepath.IsAbs(requested) {
 		host = filepath.Clean(requested)
@@ -148,21 +284,22 @@ func resolveHostCwd(projectRoot string, requested string) (string, error) {
 		host = filepath.Clean(filepath.Join(projectRoot, requested))
 	}
 
-	rel, err := filepath.Rel(projectRoot, host)
+	inside, err := withinRoot(projectRoot, host)
 	if err != nil {
 		return "", err
 	}
-	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-		return "", fmt.Errorf("cwd %s escapes project root %s", host, projectRoot)
+	if !inside {
+		return "", fmt.Errorf("%s %w %s", host, backend.ErrEscapesProjectRoot, projectRoot)
 	}
-	info, err := os.Stat(host)
+	return host, nil
+}
+
+func withinRoot(root string, path string) (bool, error) {
+	rel, err := filepath.Rel(root, path)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	if !info.IsDir() {
-		return "", fmt.Errorf("cwd is not a directory: %s", host)
-	}
-	return host, nil
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)), nil
 }
 
 func mergeRestrictedEnv(extra map[string]string) []string {
@@ -0,0 +1,158 @@
+package off
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"vibebox/internal/backend"
+)
+
+func (b *Backend) ReadFile(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string) ([]byte, error) {
+	_ = ctx
+	_ = handle
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(host)
+}
+
+func (b *Backend) WriteFile(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string, data []byte, perm fs.FileMode) error {
+	_ = ctx
+	_ = handle
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, true)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(host, data, perm)
+}
+
+func (b *Backend) ListDir(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string) ([]backend.FileInfo, error) {
+	_ = ctx
+	_ = handle
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(host)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]backend.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, toFileInfo(info))
+	}
+	return out, nil
+}
+
+func (b *Backend) Stat(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string) (backend.FileInfo, error) {
+	_ = ctx
+	_ = handle
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, true)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	info, err := os.Stat(host)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	return toFileInfo(info), nil
+}
+
+func (b *Backend) Remove(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string, recursive bool) error {
+	_ = ctx
+	_ = handle
+	// Remove acts on a symlink itself, so only its parent has to stay inside the project.
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, false)
+	if err != nil {
+		return err
+	}
+	if host == filepath.Clean(spec.ProjectRoot) {
+		return fmt.Errorf("refusing to remove project root %s", host)
+	}
+	if recursive {
+		return os.RemoveAll(host)
+	}
+	return os.Remove(host)
+}
+
+func (b *Backend) MkdirAll(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, path string, perm fs.FileMode) error {
+	_ = ctx
+	_ = handle
+	host, err := resolveHostFilePath(spec.ProjectRoot, path, true)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(host, perm)
+}
+
+// resolveHostFilePath applies the resolveHostPath containment check and also
+// rejects paths that leave the project root through symlinks. When followLast
+// is false the final element is not resolved.
+func resolveHostFilePath(projectRoot string, requested string, followLast bool) (string, error) {
+	host, err := resolveHostPath(projectRoot, requested)
+	if err != nil {
+		return "", err
+	}
+	check := host
+	if !followLast {
+		check = filepath.Dir(host)
+	}
+	realRoot, err := filepath.EvalSymlinks(projectRoot)
+	if err != nil {
+		return "", err
+	}
+	real, err := evalExistingPrefix(check)
+	if err != nil {
+		return "", err
+	}
+	inside, err := withinRoot(realRoot, real)
+	if err != nil {
+		return "", err
+	}
+	if !inside {
+		return "", fmt.Errorf("%s %w %s through a symlink", host, backend.ErrEscapesProjectRoot, projectRoot)
+	}
+	return host, nil
+}
+
+// evalExistingPrefix resolves symlinks in the longest existing prefix of path
+// and appends the missing remainder unchanged.
+func evalExistingPrefix(path string) (string, error) {
+	suffix := ""
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(real, suffix), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, suffix), nil
+		}
+		suffix = filepath.Join(filepath.Base(path), suffix)
+		path = parent
+	}
+}
+
+func toFileInfo(info fs.FileInfo) backend.FileInfo {
+	return backend.FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
@@ -0,0 +1,147 @@
+package off
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"vibebox/internal/backend"
+)
+
+// cancelWaitDelay bounds how long Wait blocks on output pipes after the
+// process group was killed.
+const cancelWaitDelay = 2 * time.Second
+
+// killProcessGroupOnCancel runs cmd in its own process group and makes context
+// cancellation kill the whole group, so children spawned by the shell do not
+// outlive the command.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return signalProcessGroup(cmd.Process, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = cancelWaitDelay
+}
+
+func signalProcessGroup(proc *os.Process, sig syscall.Signal) error {
+	if proc == nil {
+		return os.ErrProcessDone
+	}
+	err := syscall.Kill(-proc.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+var signalsByName = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+// process is a detached command running in its own process group.
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	exit backend.ProcessExit
+	err  error
+}
+
+func (b *Backend) SpawnInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ProcessHandle, error) {
+	_ = ctx
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid off session handle")
+	}
+	req = h.apply(req)
+	hostCwd, err := resolveHostCwd(spec.ProjectRoot, req.Cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not bound to ctx: the process outlives the spawn call until it exits or is signalled.
+	argv := backend.CommandArgv(spec, req)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = hostCwd
+	cmd.Env = mergeRestrictedEnv(req.Env)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.WaitDelay = cancelWaitDelay
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = req.Stdout
+	cmd.Stderr = req.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.exit, p.err = processExit(cmd.Wait(), cmd.ProcessState)
+	}()
+	return p, nil
+}
+
+func (b *Backend) WaitProcess(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, proc backend.ProcessHandle) (backend.ProcessExit, error) {
+	_ = spec
+	_ = handle
+	p, ok := proc.(*process)
+	if !ok {
+		return backend.ProcessExit{}, fmt.Errorf("invalid off process handle")
+	}
+	select {
+	case <-p.done:
+		return p.exit, p.err
+	case <-ctx.Done():
+		return backend.ProcessExit{}, ctx.Err()
+	}
+}
+
+func (b *Backend) SignalProcess(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, proc backend.ProcessHandle, signal string) error {
+	_ = ctx
+	_ = spec
+	_ = handle
+	p, ok := proc.(*process)
+	if !ok {
+		return fmt.Errorf("invalid off process handle")
+	}
+	sig, ok := signalsByName[signal]
+	if !ok {
+		return fmt.Errorf("unsupported signal: %q", signal)
+	}
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if err := signalProcessGroup(p.cmd.Process, sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// processExit converts the result of Wait into exit code and terminating signal.
+func processExit(waitErr error, state *os.ProcessState) (backend.ProcessExit, error) {
+	if state == nil {
+		return backend.ProcessExit{ExitCode: -1}, waitErr
+	}
+	exit := backend.ProcessExit{ExitCode: state.ExitCode()}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = backend.SignalName(status.Signal())
+	}
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		return exit, waitErr
+	}
+	return exit, nil
+}
@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+)
+
+// CaptureWriter returns a writer that records output into dst and, when live
+// is set, forwards each chunk to live as well. Errors from live are ignored so
+// a slow or broken consumer never aborts the command being captured.
+func CaptureWriter(dst io.Writer, live io.Writer) io.Writer {
+	if live == nil {
+		return dst
+	}
+	return &teeWriter{dst: dst, live: live}
+}
+
+type teeWriter struct {
+	dst  io.Writer
+	live io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.dst.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if t.live != nil {
+		if _, liveErr := t.live.Write(p); liveErr != nil {
+			t.live = nil
+		}
+	}
+	return n, nil
+}
+
+// OutputCapture records one output stream. With a positive limit it retains
+// only the first and last limit/2 bytes, so memory stays bounded no matter how
+// much the command prints.
+type OutputCapture struct {
+	limit     int
+	headLimit int
+	head      []byte
+	tail      []byte
+	total     int64
+}
+
+// NewOutputCapture returns a capture retaining at most limit bytes; limit <= 0 keeps everything.
+func NewOutputCapture(limit int) *OutputCapture {
+	if limit < 0 {
+		limit = 0
+	}
+	return &OutputCapture{limit: limit, headLimit: (limit + 1) / 2}
+}
+
+func (c *OutputCapture) Write(p []byte) (int, error) {
+	n := len(p)
+	c.total += int64(n)
+	if c.limit == 0 {
+		c.head = append(c.head, p...)
+		return n, nil
+	}
+	if room := c.headLimit - len(c.head); room > 0 {
+		take := min(room, len(p))
+		c.head = append(c.head, p[:take]...)
+		p = p[take:]
+	}
+	tailLimit := c.limit - c.headLimit
+	c.tail = append(c.tail, p...)
+	// Compact lazily so appends stay amortized O(1).
+	if len(c.tail) > 2*tailLimit+4096 {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-tailLimit:]...)
+	}
+	return n, nil
+}
+
+// Truncated reports whether bytes were dropped.
+func (c *OutputCapture) Truncated() bool {
+	return c.limit > 0 && c.total > int64(c.limit)
+}
+
+// Total returns the number of bytes written, including dropped ones.
+func (c *OutputCapture) Total() int64 {
+	return c.total
+}
+
+// String returns the retained output. When truncated, head and tail are joined
+// by a marker line stating how many bytes were dropped.
+func (c *OutputCapture) String() string {
+	if !c.Truncated() {
+		return string(c.head) + string(c.tail)
+	}
+	tailLimit := c.limit - c.headLimit
+	tail := c.tail[len(c.tail)-tailLimit:]
+	return string(c.head) + fmt.Sprintf("\n[... %d bytes truncated ...]\n", c.total-int64(c.limit)) + string(tail)
+}
+
+// CapturedResult builds an ExecResult from captured streams; ExitCode is left zero.
+func CapturedResult(stdout, stderr *OutputCapture) ExecResult {
+	return ExecResult{
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		StdoutBytes:     stdout.Total(),
+		StderrBytes:     stderr.Total(),
+		StdoutTruncated: stdout.Truncated(),
+		StderrTruncated: stderr.Truncated(),
+	}
+}
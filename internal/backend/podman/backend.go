@@ -0,0 +1,533 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+)
+
+const workspaceGuestPath = "/workspace"
+
+// Backend implements the podman runtime through the podman CLI. It works with
+// rootless podman, which needs no daemon.
+type Backend struct {
+	mu sync.Mutex
+	// info caches `podman info`; it is refreshed by Probe.
+	info *podmanInfo
+}
+
+type sessionHandle struct {
+	containerName string
+	defaultCwd    string
+	defaultEnv    map[string]string
+	// shell is the long-lived `podman exec` bash of a stateful session, nil otherwise.
+	shell *backend.Shell
+}
+
+func New() *Backend {
+	return &Backend{}
+}
+
+func (b *Backend) Name() string {
+	return "podman"
+}
+
+var capabilities = backend.Capabilities{
+	PersistentSessions: true,
+	Mounts:             true,
+	Env:                true,
+	Cwd:                true,
+	Stdin:              true,
+	LiveOutput:         true,
+	StatefulShell:      true,
+}
+
+// podmanInfo is the subset of `podman info --format json` used by the backend.
+type podmanInfo struct {
+	Host struct {
+		Arch     string `json:"arch"`
+		OS       string `json:"os"`
+		Security struct {
+			Rootless bool `json:"rootless"`
+		} `json:"security"`
+	} `json:"host"`
+	Version struct {
+		Version string `json:"Version"`
+	} `json:"version"`
+}
+
+func (b *Backend) Probe(ctx context.Context) backend.ProbeResult {
+	if _, err := exec.LookPath("podman"); err != nil {
+		return backend.ProbeResult{
+			Available:    false,
+			Reason:       "podman command not found",
+			FixHints:     []string{"install podman", "ensure podman is on PATH"},
+			Capabilities: capabilities,
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "podman", "info", "--format", "json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return backend.ProbeResult{
+			Available: false,
+			Reason:    fmt.Sprintf("podman not usable: %s", strings.TrimSpace(stderr.String())),
+			FixHints: []string{
+				"run `podman info` and fix errors",
+				"for rootless podman, check /etc/subuid and /etc/subgid entries for your user",
+			},
+			Capabilities: capabilities,
+		}
+	}
+	info, err := parseInfo(out)
+	if err != nil {
+		return backend.ProbeResult{
+			Available:    false,
+			Reason:       err.Error(),
+			FixHints:     []string{"run `podman info --format json` and check its output"},
+			Capabilities: capabilities,
+		}
+	}
+	b.mu.Lock()
+	b.info = &info
+	b.mu.Unlock()
+	return backend.ProbeResult{
+		Available:    true,
+		Capabilities: capabilities,
+		Runtime:      backend.RuntimeInfo{Name: "podman", Version: info.Version.Version, OS: info.Host.OS, Arch: info.Host.Arch},
+	}
+}
+
+func parseInfo(out []byte) (podmanInfo, error) {
+	var info podmanInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return podmanInfo{}, fmt.Errorf("decode podman info: %w", err)
+	}
+	return info, nil
+}
+
+// hostInfo returns the cached `podman info`, querying podman when Probe has not run.
+func (b *Backend) hostInfo(ctx context.Context) (podmanInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.info != nil {
+		return *b.info, nil
+	}
+	cmd := exec.CommandContext(ctx, "podman", "info", "--format", "json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return podmanInfo{}, fmt.Errorf("podman info: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	info, err := parseInfo(out)
+	if err != nil {
+		return podmanInfo{}, err
+	}
+	b.info = &info
+	return info, nil
+}
+
+// runArgs renders the user namespace and mount options shared by every `podman run`.
+func (b *Backend) runArgs(ctx context.Context, spec backend.RuntimeSpec) ([]string, error) {
+	info, err := b.hostInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mountArgs, err := buildMountArgs(spec, selinuxEnforcing())
+	if err != nil {
+		return nil, err
+	}
+	return append(usernsArgs(spec, info.Host.Security.Rootless), mountArgs...), nil
+}
+
+func (b *Backend) Prepare(ctx context.Context, spec backend.RuntimeSpec) error {
+	image := spec.Config.Podman.Image
+	if err := exec.CommandContext(ctx, "podman", "image", "exists", image).Run(); err == nil {
+		return nil
+	}
+	pull := exec.CommandContext(ctx, "podman", "pull", image)
+	pull.Stdout = spec.IO.Stdout
+	pull.Stderr = spec.IO.Stderr
+	if pull.Stdout == nil {
+		pull.Stdout = os.Stderr
+	}
+	if pull.Stderr == nil {
+		pull.Stderr = os.Stderr
+	}
+	if err := pull.Run(); err != nil {
+		return fmt.Errorf("pull podman image %s: %w", image, err)
+	}
+	return nil
+}
+
+func (b *Backend) Start(ctx context.Context, spec backend.RuntimeSpec) error {
+	containerName := "vibebox-" + container.SanitizeName(spec.ProjectName)
+
+	args := []string{"run", "--rm", "-it", "--name", containerName, "-e", "IS_SANDBOX=1"}
+	args = append(args, labelArgs(spec, container.KindStart, nil)...)
+	runArgs, err := b.runArgs(ctx, spec)
+	if err != nil {
+		return err
+	}
+	args = append(args, runArgs...)
+	args = append(args, "-w", workspaceGuestPath, spec.Config.Podman.Image, "/bin/bash")
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	cmd.Cancel = func() error {
+		_ = removeContainer(containerName)
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = cancelWaitDelay
+	cmd.Stdin = spec.IO.Stdin
+	cmd.Stdout = spec.IO.Stdout
+	cmd.Stderr = spec.IO.Stderr
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("podman exited with code %d", exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *Backend) Exec(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	guestCwd, err := container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuestPath)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+
+	token := container.ExecToken(req)
+	containerName := "vibebox-x-" + container.SanitizeName(spec.ProjectName) + "-" + container.SanitizeName(token)
+	// The container is removed after exit rather than with --rm so its final state can be inspected.
+	args := []string{"run", "-i", "--name", containerName, "-e", "IS_SANDBOX=1"}
+	args = append(args, labelArgs(spec, container.KindExec, map[string]string{container.LabelExec: token})...)
+	runArgs, err := b.runArgs(ctx, spec)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+	args = append(args, runArgs...)
+	for _, e := range container.EnvList(req.Env) {
+		args = append(args, "-e", e)
+	}
+	args = append(args, "-w", guestCwd, spec.Config.Podman.Image)
+	args = append(args, backend.CommandArgv(spec, req)...)
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	// Killing the podman CLI may leave the container running; remove it instead.
+	cmd.Cancel = func() error {
+		_ = removeContainer(containerName)
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = cancelWaitDelay
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = backend.CaptureWriter(stdout, req.Stdout)
+	cmd.Stderr = backend.CaptureWriter(stderr, req.Stderr)
+	startedAt := time.Now()
+	err = cmd.Run()
+
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	if state, stateErr := inspectContainerState(containerName); stateErr == nil {
+		container.ApplyState(&result, state)
+	}
+	_ = removeContainer(containerName)
+	if err == nil {
+		return result, nil
+	}
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		result.Signal = container.SignalFromExitCode(result.ExitCode)
+		return result, nil
+	}
+	if result.TimedOut {
+		result.ExitCode = -1
+		return result, nil
+	}
+	return result, err
+}
+
+func (b *Backend) StartSession(ctx context.Context, spec backend.RuntimeSpec, req backend.SessionStartRequest) (backend.SessionHandle, error) {
+	guestCwd, err := container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuestPath)
+	if err != nil {
+		return nil, err
+	}
+	containerName := "vibebox-s-" + container.SanitizeName(spec.ProjectName) + "-" + container.SanitizeName(req.SessionID)
+
+	args := []string{"run", "-d", "--rm", "--name", containerName, "-e", "IS_SANDBOX=1"}
+	args = append(args, labelArgs(spec, container.KindSession, map[string]string{container.LabelSession: req.SessionID})...)
+	runArgs, err := b.runArgs(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, runArgs...)
+	for _, e := range container.EnvList(req.Env) {
+		args = append(args, "-e", e)
+	}
+	args = append(args, "-w", guestCwd, spec.Config.Podman.Image, "sleep", "infinity")
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The container may already exist when the CLI fails or is cancelled mid-start.
+		_ = removeContainer(containerName)
+		return nil, fmt.Errorf("start podman session: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	h := sessionHandle{
+		containerName: containerName,
+		defaultCwd:    guestCwd,
+		defaultEnv:    cloneMap(req.Env),
+	}
+	if req.Stateful {
+		if h.shell, err = startShell(ctx, h); err != nil {
+			_ = removeContainer(containerName)
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (b *Backend) ExecInSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle, req backend.ExecRequest) (backend.ExecResult, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return backend.ExecResult{}, fmt.Errorf("invalid podman session handle")
+	}
+	if h.shell != nil {
+		return h.execInShell(ctx, spec, req)
+	}
+	guestCwd, env, err := h.resolve(spec, req)
+	if err != nil {
+		return backend.ExecResult{}, err
+	}
+
+	token := container.ExecToken(req)
+	args := []string{"exec", "-i", "-w", guestCwd}
+	for _, e := range container.EnvList(env) {
+		args = append(args, "-e", e)
+	}
+	args = append(args, "-e", container.ExecIDEnv+"="+token, h.containerName)
+	args = append(args, backend.CommandArgv(spec, req)...)
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	// podman exec processes survive the CLI; kill the tagged tree in the container first.
+	cmd.Cancel = func() error {
+		_ = killTaggedProcesses(h.containerName, token, "KILL")
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = cancelWaitDelay
+	stdout := backend.NewOutputCapture(req.MaxOutputBytes)
+	stderr := backend.NewOutputCapture(req.MaxOutputBytes)
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = backend.CaptureWriter(stdout, req.Stdout)
+	cmd.Stderr = backend.CaptureWriter(stderr, req.Stderr)
+	startedAt := time.Now()
+	err = cmd.Run()
+
+	result := backend.CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	if err == nil {
+		return result, nil
+	}
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		result.Signal = container.SignalFromExitCode(result.ExitCode)
+		return result, nil
+	}
+	if result.TimedOut {
+		result.ExitCode = -1
+		return result, nil
+	}
+	return result, err
+}
+
+func (b *Backend) StopSession(ctx context.Context, spec backend.RuntimeSpec, handle backend.SessionHandle) error {
+	_ = spec
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return fmt.Errorf("invalid podman session handle")
+	}
+	if h.shell != nil {
+		_ = h.shell.Close()
+	}
+	cmd := exec.CommandContext(ctx, "podman", "rm", "-f", h.containerName)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(strings.ToLower(stderr.String()), "no such container") {
+			return nil
+		}
+		return fmt.Errorf("stop podman session: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// persistedSession is the registry form of sessionHandle.
+type persistedSession struct {
+	ContainerName string            `json:"containerName"`
+	DefaultCwd    string            `json:"defaultCwd"`
+	DefaultEnv    map[string]string `json:"defaultEnv,omitempty"`
+	Stateful      bool              `json:"stateful,omitempty"`
+}
+
+func (b *Backend) MarshalSession(handle backend.SessionHandle) ([]byte, error) {
+	h, ok := handle.(sessionHandle)
+	if !ok {
+		return nil, fmt.Errorf("invalid podman session handle")
+	}
+	return json.Marshal(persistedSession{
+		ContainerName: h.containerName,
+		DefaultCwd:    h.defaultCwd,
+		DefaultEnv:    h.defaultEnv,
+		Stateful:      h.shell != nil,
+	})
+}
+
+func decodeSession(data []byte) (persistedSession, error) {
+	var p persistedSession
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("decode podman session: %w", err)
+	}
+	if p.ContainerName == "" {
+		return p, fmt.Errorf("decode podman session: missing container name")
+	}
+	return p, nil
+}
+
+// ProbeSession reports a session gone when its container no longer runs.
+func (b *Backend) ProbeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) error {
+	_ = spec
+	p, err := decodeSession(data)
+	if err != nil {
+		return err
+	}
+	return probeSessionContainer(ctx, p.ContainerName)
+}
+
+func probeSessionContainer(ctx context.Context, containerName string) error {
+	cmd := exec.CommandContext(ctx, "podman", "inspect", "--format", "{{.State.Running}}", containerName)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(strings.ToLower(msg), "no such") {
+			return fmt.Errorf("podman session container %s not found: %w", containerName, backend.ErrSessionGone)
+		}
+		return fmt.Errorf("podman session container %s: %w (%s)", containerName, err, msg)
+	}
+	if strings.TrimSpace(stdout.String()) != "true" {
+		return fmt.Errorf("podman session container %s is not running: %w", containerName, backend.ErrSessionGone)
+	}
+	return nil
+}
+
+func (b *Backend) ResumeSession(ctx context.Context, spec backend.RuntimeSpec, data []byte) (backend.SessionHandle, error) {
+	_ = spec
+	p, err := decodeSession(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := probeSessionContainer(ctx, p.ContainerName); err != nil {
+		return nil, err
+	}
+	h := sessionHandle{
+		containerName: p.ContainerName,
+		defaultCwd:    p.DefaultCwd,
+		defaultEnv:    cloneMap(p.DefaultEnv),
+	}
+	if p.Stateful {
+		// The previous shell's podman exec ended with the process that owned it;
+		// a new shell starts from the session defaults.
+		shell, err := startShell(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		h.shell = shell
+	}
+	return h, nil
+}
+
+// startShell runs bash in the session container for a stateful session.
+func startShell(ctx context.Context, h sessionHandle) (*backend.Shell, error) {
+	cmd := exec.Command("podman", "exec", "-i", "-w", h.defaultCwd, h.containerName, "bash", "-l")
+	shell, err := backend.StartShell(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("podman session shell: %w", err)
+	}
+	return shell, nil
+}
+
+// execInShell runs req in the session's stateful shell. The command's processes
+// carry the exec tag, so cancellation kills them without killing the shell.
+func (h sessionHandle) execInShell(ctx context.Context, spec backend.RuntimeSpec, req backend.ExecRequest) (backend.ExecResult, error) {
+	guestCwd := ""
+	if req.Cwd != "" {
+		var err error
+		if guestCwd, err = container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuestPath); err != nil {
+			return backend.ExecResult{}, err
+		}
+	}
+	token := container.ExecToken(req)
+	req.Env = cloneMap(req.Env)
+	req.Env[container.ExecIDEnv] = token
+	result, err := h.shell.Exec(ctx, req, guestCwd, func() error {
+		return killTaggedProcesses(h.containerName, token, "KILL")
+	})
+	if err == nil {
+		result.Signal = container.SignalFromExitCode(result.ExitCode)
+	}
+	return result, err
+}
+
+// resolve applies session defaults and returns the guest cwd and environment for req.
+func (h sessionHandle) resolve(spec backend.RuntimeSpec, req backend.ExecRequest) (string, map[string]string, error) {
+	guestCwd := h.defaultCwd
+	if req.Cwd != "" {
+		var err error
+		guestCwd, err = container.ResolveGuestCwd(spec.ProjectRoot, req.Cwd, workspaceGuestPath)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	env := cloneMap(h.defaultEnv)
+	for k, v := range req.Env {
+		env[k] = v
+	}
+	return guestCwd, env, nil
+}
@@ -0,0 +1,139 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/container"
+	"vibebox/internal/config"
+)
+
+const (
+	// cleanupTimeout bounds teardown commands issued after the caller's context is done.
+	cleanupTimeout  = 15 * time.Second
+	cancelWaitDelay = 2 * time.Second
+	// selinuxFS is mounted when SELinux is enabled on the host.
+	selinuxFS = "/sys/fs/selinux"
+)
+
+// labelArgs renders the container labels as --label options, so operators can
+// find every container vibebox created (`podman ps -a --filter label=vibebox.managed=true`).
+func labelArgs(spec backend.RuntimeSpec, kind string, extra map[string]string) []string {
+	labels := container.Labels(spec, kind, extra)
+	args := make([]string, 0, len(labels)*2)
+	for _, l := range container.EnvList(labels) {
+		args = append(args, "--label", l)
+	}
+	return args
+}
+
+// usernsArgs maps the host user to the same uid in rootless containers, so
+// files written to mounts are not owned by a subordinate uid on the host.
+// keep-id is rejected by rootful podman, which already maps root to root.
+// rootless comes from `podman info`, as a non-root user may drive a rootful
+// podman through a remote connection.
+func usernsArgs(spec backend.RuntimeSpec, rootless bool) []string {
+	userns := spec.Config.Podman.UserNS
+	if userns == "" && rootless {
+		userns = "keep-id"
+	}
+	if userns == "" {
+		return nil
+	}
+	return []string{"--userns=" + userns}
+}
+
+// selinuxEnforcing reports whether SELinux is enabled on the host.
+func selinuxEnforcing() bool {
+	_, err := os.Stat(filepath.Join(selinuxFS, "enforce"))
+	return err == nil
+}
+
+// buildMountArgs renders config mounts as -v options. On SELinux hosts mounts
+// get the shared z label by default, so the host and other containers keep
+// access to them; the private Z label is opt-in.
+func buildMountArgs(spec backend.RuntimeSpec, selinux bool) ([]string, error) {
+	relabel := spec.Config.Podman.Relabel
+	if relabel == "" {
+		relabel = config.PodmanRelabelNone
+		if selinux {
+			relabel = config.PodmanRelabelShared
+		}
+	}
+	args := make([]string, 0, len(spec.Config.Mounts)*2)
+	for _, m := range spec.Config.Mounts {
+		hostPath := m.Host
+		if !filepath.IsAbs(hostPath) {
+			hostPath = filepath.Join(spec.ProjectRoot, hostPath)
+		}
+		if _, err := os.Stat(hostPath); err != nil {
+			return nil, fmt.Errorf("mount host path does not exist: %s", hostPath)
+		}
+		opts := m.Mode
+		if relabel != config.PodmanRelabelNone {
+			opts += "," + relabel
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:%s:%s", hostPath, m.Guest, opts))
+	}
+	return args, nil
+}
+
+// killTaggedProcesses signals every process in container whose environment
+// carries the exec token, which covers children and background jobs as well.
+func killTaggedProcesses(containerName, token, signal string) error {
+	return runCleanup("exec", containerName, "/bin/sh", "-c", container.KillTaggedScript(token, signal))
+}
+
+// removeContainer force-removes a container, ignoring containers that are already gone.
+func removeContainer(containerName string) error {
+	return runCleanup("rm", "-f", containerName)
+}
+
+func runCleanup(args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.ToLower(stderr.String())
+		if strings.Contains(msg, "no such container") || strings.Contains(msg, "not running") {
+			return nil
+		}
+		return fmt.Errorf("podman %s: %w (%s)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func inspectContainerState(containerName string) (container.State, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "podman", "inspect", "--format", "{{json .State}}", containerName)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return container.State{}, fmt.Errorf("podman inspect: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return container.ParseState(stdout.Bytes())
+}
+
+func cloneMap(in map[string]string) map[string]string {
+	if in == nil {
+		return map[string]string{}
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
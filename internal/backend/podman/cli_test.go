@@ -0,0 +1,156 @@
+package podman
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+func TestParseInfo(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		out      string
+		rootless bool
+		wantErr  bool
+	}{
+		{
+			name:     "rootless",
+			out:      `{"host":{"arch":"amd64","os":"linux","security":{"rootless":true}},"version":{"Version":"5.2.1"}}`,
+			rootless: true,
+		},
+		{
+			name: "rootful",
+			out:  `{"host":{"arch":"arm64","os":"linux","security":{"rootless":false}},"version":{"Version":"4.9.3"}}`,
+		},
+		{
+			name: "missing security section",
+			out:  `{"host":{"arch":"amd64","os":"linux"},"version":{"Version":"4.0.0"}}`,
+		},
+		{
+			name:    "invalid json",
+			out:     `Error: cannot connect to Podman`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			info, err := parseInfo([]byte(tt.out))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse info: %v", err)
+			}
+			if info.Host.Security.Rootless != tt.rootless {
+				t.Fatalf("expected rootless %v, got %v", tt.rootless, info.Host.Security.Rootless)
+			}
+			if info.Host.OS != "linux" || info.Host.Arch == "" || info.Version.Version == "" {
+				t.Fatalf("unexpected host info: %+v", info)
+			}
+		})
+	}
+}
+
+func TestUsernsArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		userns   string
+		rootless bool
+		want     []string
+	}{
+		{name: "rootless default", rootless: true, want: []string{"--userns=keep-id"}},
+		{name: "rootful default", rootless: false, want: nil},
+		{name: "rootless override", userns: "auto", rootless: true, want: []string{"--userns=auto"}},
+		{name: "rootful override", userns: "host", rootless: false, want: []string{"--userns=host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var spec backend.RuntimeSpec
+			spec.Config.Podman.UserNS = tt.userns
+			if got := usernsArgs(spec, tt.rootless); !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildMountArgs(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	tests := []struct {
+		name    string
+		relabel string
+		selinux bool
+		mounts  []config.Mount
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "no selinux",
+			mounts: []config.Mount{{Host: ".", Guest: "/workspace", Mode: "rw"}},
+			want:   []string{"-v", root + ":/workspace:rw"},
+		},
+		{
+			name:    "selinux defaults to shared label",
+			selinux: true,
+			mounts:  []config.Mount{{Host: ".", Guest: "/workspace", Mode: "rw"}},
+			want:    []string{"-v", root + ":/workspace:rw,z"},
+		},
+		{
+			name:    "private label is opt-in",
+			relabel: config.PodmanRelabelPrivate,
+			selinux: true,
+			mounts:  []config.Mount{{Host: ".", Guest: "/workspace", Mode: "ro"}},
+			want:    []string{"-v", root + ":/workspace:ro,Z"},
+		},
+		{
+			name:    "explicit label without selinux",
+			relabel: config.PodmanRelabelShared,
+			mounts:  []config.Mount{{Host: root, Guest: "/data", Mode: "rw"}},
+			want:    []string{"-v", root + ":/data:rw,z"},
+		},
+		{
+			name:    "relabel disabled",
+			relabel: config.PodmanRelabelNone,
+			selinux: true,
+			mounts:  []config.Mount{{Host: ".", Guest: "/workspace", Mode: "rw"}},
+			want:    []string{"-v", root + ":/workspace:rw"},
+		},
+		{
+			name:    "missing host path",
+			mounts:  []config.Mount{{Host: "missing", Guest: "/missing", Mode: "rw"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			spec := backend.RuntimeSpec{ProjectRoot: root}
+			spec.Config.Mounts = tt.mounts
+			spec.Config.Podman.Relabel = tt.relabel
+			got, err := buildMountArgs(spec, tt.selinux)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %s, got %q", filepath.Join(root, tt.mounts[0].Host), got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("build mount args: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ProbeCache reuses probe results younger than its TTL. Results of probes
+// interrupted by their context are not cached.
+type ProbeCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]probeEntry
+}
+
+type probeEntry struct {
+	result ProbeResult
+	at     time.Time
+}
+
+// NewProbeCache returns a cache keeping results for ttl; ttl <= 0 disables caching.
+func NewProbeCache(ttl time.Duration) *ProbeCache {
+	return &ProbeCache{ttl: ttl, entries: map[string]probeEntry{}}
+}
+
+// Probe returns the cached result for name or probes b.
+func (c *ProbeCache) Probe(ctx context.Context, name string, b Backend) ProbeResult {
+	if c == nil || c.ttl <= 0 {
+		return b.Probe(ctx)
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Since(entry.at) < c.ttl {
+		return entry.result
+	}
+
+	result := b.Probe(ctx)
+	if ctx.Err() == nil {
+		c.mu.Lock()
+		c.entries[name] = probeEntry{result: result, at: time.Now()}
+		c.mu.Unlock()
+	}
+	return result
+}
+
+// Invalidate drops every cached result.
+func (c *ProbeCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries = map[string]probeEntry{}
+	c.mu.Unlock()
+}
+
+// probeAll probes the named backends of reg in parallel.
+func probeAll(ctx context.Context, reg *Registry, names []string, cache *ProbeCache) map[string]ProbeResult {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	out := make(map[string]ProbeResult, len(names))
+	for _, name := range names {
+		b, ok := reg.Lookup(name)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := cache.Probe(ctx, name, b)
+			mu.Lock()
+			out[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+
+	"vibebox/internal/config"
+)
+
+// Registry maps provider names to backends. Names are kept in registration
+// order, which is also the order diagnostics are probed in.
+type Registry struct {
+	mu       sync.RWMutex
+	names    []string
+	backends map[string]Backend
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{backends: map[string]Backend{}}
+}
+
+// Register adds b under provider name, replacing a backend already registered
+// under that name. The name becomes a valid provider for this registry only,
+// see Providers.
+func (r *Registry) Register(name string, b Backend) error {
+	if b == nil {
+		return fmt.Errorf("backend %q is nil", name)
+	}
+	provider := config.Provider(name)
+	switch {
+	case name == "":
+		return fmt.Errorf("backend name is required")
+	case provider == config.ProviderAuto || provider == config.ProviderMacOS:
+		return fmt.Errorf("backend name %q is reserved", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.backends[name]; !exists {
+		r.names = append(r.names, name)
+	}
+	r.backends[name] = b
+	return nil
+}
+
+// Lookup returns the backend registered under name.
+func (r *Registry) Lookup(name string) (Backend, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b, ok := r.backends[name]
+	return b, ok
+}
+
+// Providers returns the registered names as providers, for validating configs
+// that may select one of them.
+func (r *Registry) Providers() []config.Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	providers := make([]config.Provider, len(r.names))
+	for i, name := range r.names {
+		providers[i] = config.Provider(name)
+	}
+	return providers
+}
+
+// Names returns registered provider names in registration order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.names...)
+}
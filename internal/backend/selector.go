@@ -3,7 +3,7 @@ package backend
 import (
 	"context"
 	"fmt"
-	"runtime"
+	"strings"
 
 	"vibebox/internal/config"
 )
@@ -15,67 +15,101 @@ type Selection struct {
 	Diagnostics  map[string]ProbeResult
 	WasFallback  bool
 	FallbackFrom string
+	// Skipped lists auto candidates tried before the selected one.
+	Skipped []SkippedCandidate
 }
 
-func Select(ctx context.Context, provider config.Provider, off, appleVM, docker Backend) (Selection, error) {
+// SkippedCandidate explains why auto selection passed over a provider.
+type SkippedCandidate struct {
+	Provider config.Provider
+	Reason   string
+}
+
+// SelectOptions tunes Select.
+type SelectOptions struct {
+	// Auto is the strategy used when provider is auto.
+	Auto config.AutoConfig
+	// Cache, when set, serves recent probe results instead of probing again.
+	Cache *ProbeCache
+	// ProbeAll probes every registered backend for diagnostics. Otherwise only
+	// backends that can be chosen under the requested provider are probed.
+	ProbeAll bool
+}
+
+// Select picks the backend for provider from reg. Explicit providers must be
+// registered and available; auto tries opts.Auto.Candidates() in order and
+// records why earlier candidates were skipped. Probes run in parallel.
+func Select(ctx context.Context, provider config.Provider, reg *Registry, opts SelectOptions) (Selection, error) {
 	provider = config.NormalizeProvider(provider)
-	if err := provider.Validate(); err != nil {
+	if err := provider.Validate(reg.Providers()...); err != nil {
 		return Selection{}, err
 	}
+	auto := opts.Auto
 
-	diag := map[string]ProbeResult{}
-	offProbe := off.Probe(ctx)
-	appleProbe := appleVM.Probe(ctx)
-	dockerProbe := docker.Probe(ctx)
-	diag[off.Name()] = offProbe
-	diag[appleVM.Name()] = appleProbe
-	diag[docker.Name()] = dockerProbe
-
-	fail := func(target string) error {
-		return fmt.Errorf(
-			"requested provider %s is unavailable (%s). hints: %v",
-			target,
-			diag[target].Reason,
-			diag[target].FixHints,
-		)
+	var names []string
+	switch {
+	case opts.ProbeAll:
+		names = reg.Names()
+	case provider == config.ProviderAuto:
+		for _, candidate := range auto.Candidates() {
+			if candidate != config.ProviderOff || auto.AllowOff {
+				names = append(names, string(candidate))
+			}
+		}
+	default:
+		names = []string{string(provider)}
 	}
+	diag := probeAll(ctx, reg, names, opts.Cache)
 
-	switch provider {
-	case config.ProviderOff:
-		if !offProbe.Available {
-			return Selection{}, fail(off.Name())
-		}
-		return Selection{Backend: off, Provider: config.ProviderOff, Diagnostics: diag}, nil
-	case config.ProviderAppleVM:
-		if !appleProbe.Available {
-			return Selection{}, fail(appleVM.Name())
+	if provider != config.ProviderAuto {
+		b, ok := reg.Lookup(string(provider))
+		if !ok {
+			return Selection{}, fmt.Errorf("unsupported provider: %s", provider)
 		}
-		return Selection{Backend: appleVM, Provider: config.ProviderAppleVM, Diagnostics: diag}, nil
-	case config.ProviderDocker:
-		if !dockerProbe.Available {
-			return Selection{}, fail(docker.Name())
+		if !diag[string(provider)].Available {
+			return Selection{}, &UnavailableError{
+				Provider:    provider,
+				Diagnostics: diag,
+				message: fmt.Sprintf(
+					"requested provider %s is unavailable (%s). hints: %v",
+					provider,
+					diag[string(provider)].Reason,
+					diag[string(provider)].FixHints,
+				),
+			}
 		}
-		return Selection{Backend: docker, Provider: config.ProviderDocker, Diagnostics: diag}, nil
-	case config.ProviderAuto:
-		if runtime.GOOS == "darwin" && appleProbe.Available {
-			return Selection{Backend: appleVM, Provider: config.ProviderAppleVM, Diagnostics: diag}, nil
-		}
-		if dockerProbe.Available {
-			fallback := runtime.GOOS == "darwin"
-			return Selection{
-				Backend:      docker,
-				Provider:     config.ProviderDocker,
-				Diagnostics:  diag,
-				WasFallback:  fallback,
-				FallbackFrom: "apple-vm",
-			}, nil
+		return Selection{Backend: b, Provider: provider, Diagnostics: diag}, nil
+	}
+
+	candidates := auto.Candidates()
+	var skipped []SkippedCandidate
+	for _, candidate := range candidates {
+		b, ok := reg.Lookup(string(candidate))
+		switch {
+		case !ok:
+			skipped = append(skipped, SkippedCandidate{Provider: candidate, Reason: "not registered"})
+		case candidate == config.ProviderOff && !auto.AllowOff:
+			skipped = append(skipped, SkippedCandidate{Provider: candidate, Reason: "not allowed (set auto.allow_off: true)"})
+		case !diag[string(candidate)].Available:
+			skipped = append(skipped, SkippedCandidate{Provider: candidate, Reason: "unavailable: " + diag[string(candidate)].Reason})
+		default:
+			sel := Selection{Backend: b, Provider: candidate, Diagnostics: diag, Skipped: skipped}
+			if len(skipped) > 0 {
+				sel.WasFallback = true
+				sel.FallbackFrom = string(candidates[0])
+			}
+			return sel, nil
 		}
-		return Selection{}, fmt.Errorf(
-			"auto selection failed: apple-vm unavailable (%s); docker unavailable (%s)",
-			appleProbe.Reason,
-			dockerProbe.Reason,
-		)
-	default:
-		return Selection{}, fmt.Errorf("unsupported provider: %s", provider)
+	}
+
+	reasons := make([]string, 0, len(skipped))
+	for _, sc := range skipped {
+		reasons = append(reasons, fmt.Sprintf("%s %s", sc.Provider, sc.Reason))
+	}
+	return Selection{}, &UnavailableError{
+		Provider:    config.ProviderAuto,
+		Diagnostics: diag,
+		Skipped:     skipped,
+		message:     "auto selection failed: " + strings.Join(reasons, "; "),
 	}
 }
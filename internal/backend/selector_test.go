@@ -2,7 +2,10 @@ package backend
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"vibebox/internal/config"
 )
@@ -20,6 +23,17 @@ func (f fakeBackend) Exec(context.Context, RuntimeSpec, ExecRequest) (ExecResult
 	return ExecResult{}, nil
 }
 
+func testRegistry(t *testing.T, backends ...fakeBackend) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	for _, b := range backends {
+		if err := reg.Register(b.name, b); err != nil {
+			t.Fatalf("register %s: %v", b.name, err)
+		}
+	}
+	return reg
+}
+
 func TestSelectExplicitDocker(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -27,7 +41,7 @@ func TestSelectExplicitDocker(t *testing.T) {
 	mac := fakeBackend{name: "apple-vm", probe: ProbeResult{Available: false, Reason: "nope"}}
 	docker := fakeBackend{name: "docker", probe: ProbeResult{Available: true}}
 
-	sel, err := Select(ctx, config.ProviderDocker, off, mac, docker)
+	sel, err := Select(ctx, config.ProviderDocker, testRegistry(t, off, mac, docker), SelectOptions{})
 	if err != nil {
 		t.Fatalf("select: %v", err)
 	}
@@ -43,7 +57,7 @@ func TestSelectExplicitOff(t *testing.T) {
 	apple := fakeBackend{name: "apple-vm", probe: ProbeResult{Available: false, Reason: "nope"}}
 	docker := fakeBackend{name: "docker", probe: ProbeResult{Available: true}}
 
-	sel, err := Select(ctx, config.ProviderOff, off, apple, docker)
+	sel, err := Select(ctx, config.ProviderOff, testRegistry(t, off, apple, docker), SelectOptions{})
 	if err != nil {
 		t.Fatalf("select: %v", err)
 	}
@@ -51,3 +65,118 @@ func TestSelectExplicitOff(t *testing.T) {
 		t.Fatalf("provider mismatch: %s", sel.Provider)
 	}
 }
+
+func TestSelectRegisteredProvider(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	off := fakeBackend{name: "off", probe: ProbeResult{Available: true}}
+	custom := fakeBackend{name: "test-firecracker", probe: ProbeResult{Available: true}}
+
+	sel, err := Select(ctx, config.Provider("test-firecracker"), testRegistry(t, off, custom), SelectOptions{ProbeAll: true})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if sel.Provider != "test-firecracker" || sel.Backend.Name() != "test-firecracker" {
+		t.Fatalf("unexpected selection: %+v", sel)
+	}
+	if _, ok := sel.Diagnostics["off"]; !ok {
+		t.Fatalf("expected diagnostics for every registered backend, got %v", sel.Diagnostics)
+	}
+	if _, err := Select(ctx, config.Provider("test-firecracker"), testRegistry(t, off), SelectOptions{}); err == nil {
+		t.Fatalf("a provider registered in another registry must be rejected")
+	}
+}
+
+func TestSelectUnavailableError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	docker := fakeBackend{name: "docker", probe: ProbeResult{Available: false, Reason: "daemon down"}}
+
+	_, err := Select(ctx, config.ProviderDocker, testRegistry(t, docker), SelectOptions{})
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("expected UnavailableError, got %v", err)
+	}
+	if unavailable.Provider != config.ProviderDocker || unavailable.Diagnostics["docker"].Reason != "daemon down" {
+		t.Fatalf("unexpected error: %+v", unavailable)
+	}
+}
+
+func TestRegistryRejectsReservedNames(t *testing.T) {
+	t.Parallel()
+	reg := NewRegistry()
+	for _, name := range []string{"", "auto", "macos"} {
+		if err := reg.Register(name, fakeBackend{name: name}); err == nil {
+			t.Fatalf("expected error registering %q", name)
+		}
+	}
+}
+
+func TestSelectAutoOrderExplainsSkipped(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	reg := testRegistry(t,
+		fakeBackend{name: "off", probe: ProbeResult{Available: true}},
+		fakeBackend{name: "apple-vm", probe: ProbeResult{Available: false, Reason: "not darwin"}},
+		fakeBackend{name: "docker", probe: ProbeResult{Available: false, Reason: "daemon down"}},
+	)
+	auto := config.AutoConfig{Order: []config.Provider{config.ProviderDocker, config.ProviderAppleVM, config.ProviderOff}}
+
+	_, err := Select(ctx, config.ProviderAuto, reg, SelectOptions{Auto: auto})
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("expected UnavailableError, got %v", err)
+	}
+	if len(unavailable.Skipped) != 3 || unavailable.Skipped[0].Provider != config.ProviderDocker || unavailable.Skipped[2].Provider != config.ProviderOff {
+		t.Fatalf("unexpected skipped candidates: %+v", unavailable.Skipped)
+	}
+
+	auto.AllowOff = true
+	sel, err := Select(ctx, config.ProviderAuto, reg, SelectOptions{Auto: auto})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if sel.Provider != config.ProviderOff || !sel.WasFallback || sel.FallbackFrom != "docker" {
+		t.Fatalf("unexpected selection: %+v", sel)
+	}
+	if len(sel.Skipped) != 2 || sel.Skipped[1].Reason != "unavailable: not darwin" {
+		t.Fatalf("unexpected skipped candidates: %+v", sel.Skipped)
+	}
+}
+
+type countingBackend struct {
+	fakeBackend
+	probes *atomic.Int32
+}
+
+func (c countingBackend) Probe(ctx context.Context) ProbeResult {
+	c.probes.Add(1)
+	return c.fakeBackend.Probe(ctx)
+}
+
+func TestSelectProbesOnlyCandidatesAndCaches(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var offProbes, dockerProbes atomic.Int32
+	reg := NewRegistry()
+	_ = reg.Register("off", countingBackend{fakeBackend{name: "off", probe: ProbeResult{Available: true}}, &offProbes})
+	_ = reg.Register("docker", countingBackend{fakeBackend{name: "docker", probe: ProbeResult{Available: true}}, &dockerProbes})
+	cache := NewProbeCache(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := Select(ctx, config.ProviderOff, reg, SelectOptions{Cache: cache}); err != nil {
+			t.Fatalf("select: %v", err)
+		}
+	}
+	if offProbes.Load() != 1 || dockerProbes.Load() != 0 {
+		t.Fatalf("expected one cached off probe and no docker probe, got off=%d docker=%d", offProbes.Load(), dockerProbes.Load())
+	}
+
+	cache.Invalidate()
+	if _, err := Select(ctx, config.ProviderAuto, reg, SelectOptions{Cache: cache, ProbeAll: true}); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if offProbes.Load() != 2 || dockerProbes.Load() != 1 {
+		t.Fatalf("expected fresh probes after invalidation, got off=%d docker=%d", offProbes.Load(), dockerProbes.Load())
+	}
+}
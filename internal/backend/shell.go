@@ -0,0 +1,457 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrShellExited is returned by Shell.Exec once the session shell has exited,
+// for example because a command ran `exit`.
+var ErrShellExited = errors.New("session shell exited")
+
+const (
+	// shellStopGrace bounds how long a cancelled command may take to return to
+	// the prompt, and how long Close waits for the shell to exit.
+	shellStopGrace = 5 * time.Second
+	// shellReadChunk is the pipe read size used while scanning for markers.
+	shellReadChunk = 32 * 1024
+)
+
+// shellPrelude turns on job control, so every command runs in its own process
+// group, and defines the helper that reports a finished command. It prints the
+// begin marker, exit code, cwd and NUL-separated exported environment on
+// stdout, and just the markers on stderr, so both streams can be split per
+// command without relying on line boundaries.
+const shellPrelude = `set -m
+__vibebox_done() {
+  local __vibebox_k
+  printf '%s%s:%s\0' "$2" "$1" "$PWD"
+  for __vibebox_k in $(compgen -e); do printf '%s=%s\0' "$__vibebox_k" "${!__vibebox_k}"; done
+  printf '%s' "$3"
+  printf '%s%s' "$2" "$3" >&2
+}
+`
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Shell runs commands one at a time in a long-lived bash process, so `cd` and
+// exported variables persist between them like in a terminal.
+type Shell struct {
+	// execMu serializes commands. It is held while a command runs, so nothing
+	// that inspects the shell may wait for it.
+	execMu  sync.Mutex
+	proc    ShellProcess
+	stdout  *frameReader
+	stderr  *frameReader
+	waited  chan struct{}
+	waitErr error
+
+	// stateMu guards the state recorded after the last command.
+	stateMu sync.RWMutex
+	cwd     string
+	env     map[string]string
+	err     error
+}
+
+// ShellProcess is a started bash reading commands from Stdin. Backends that do
+// not run the shell as a local process, such as an API exec stream, describe it
+// with a ShellProcess and pass it to AttachShell.
+type ShellProcess struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	Stderr io.Reader
+	// Pid is the local process id, or 0 when the shell is not a local process.
+	Pid int
+	// Wait blocks until the shell has exited.
+	Wait func() error
+	// Kill stops the shell immediately.
+	Kill func() error
+}
+
+// StartShell starts cmd, which must run bash reading commands from stdin, and
+// waits until it is ready. The shell is not bound to ctx; stop it with Close.
+func StartShell(ctx context.Context, cmd *exec.Cmd) (*Shell, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return AttachShell(ctx, ShellProcess{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Pid:    cmd.Process.Pid,
+		Wait:   cmd.Wait,
+		Kill:   cmd.Process.Kill,
+	})
+}
+
+// AttachShell takes over an already started shell process and waits until it
+// is ready. Like StartShell, the shell is not bound to ctx.
+func AttachShell(ctx context.Context, proc ShellProcess) (*Shell, error) {
+	s := &Shell{
+		proc:   proc,
+		stdout: &frameReader{r: proc.Stdout},
+		stderr: &frameReader{r: proc.Stderr},
+		waited: make(chan struct{}),
+	}
+	go func() {
+		s.waitErr = proc.Wait()
+		close(s.waited)
+	}()
+	if _, err := io.WriteString(proc.Stdin, shellPrelude); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("start session shell: %w", err)
+	}
+	// A no-op command records the initial state and discards login banners.
+	result, err := s.Exec(ctx, ExecRequest{Command: ":"}, "", nil)
+	if err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("start session shell: %w", err)
+	}
+	if result.ExitCode != 0 {
+		_ = s.Close()
+		return nil, fmt.Errorf("start session shell: exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return s, nil
+}
+
+// Pid returns the local process id of the shell, or 0 if it has none.
+func (s *Shell) Pid() int {
+	return s.proc.Pid
+}
+
+// State returns the shell's working directory and exported environment after
+// the last command. It does not wait for a running command.
+func (s *Shell) State() (string, map[string]string) {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.cwd, cloneEnv(s.env)
+}
+
+// KillJobs SIGKILLs the process group of every child of a local shell. Job
+// control puts each command in its own group, so this also reaches processes
+// the command's children started, as long as they did not leave the group.
+func (s *Shell) KillJobs() error {
+	return KillShellJobs(s.proc.Pid)
+}
+
+// KillShellJobs is KillJobs for the shell with the given local pid, for shells
+// that run below a local process of their own, such as a sandbox init.
+func KillShellJobs(shellPid int) error {
+	out, err := exec.Command("pgrep", "-P", strconv.Itoa(shellPid)).Output()
+	if err != nil {
+		return fmt.Errorf("list session shell jobs: %w", err)
+	}
+	for _, field := range strings.Fields(string(out)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// Exec runs req in the shell. A non-empty cwd changes the shell's directory
+// first; req.Env applies to this command only. interrupt, if set, is called
+// when ctx ends and must SIGKILL the command's processes but not the shell.
+// Commands cannot read stdin, since the shell reads its own input from it.
+//
+// bash folds a terminating signal into $? as 128+n, which a command can also
+// return with `exit`, so the result names a signal only when the command was
+// killed by interrupt.
+func (s *Shell) Exec(ctx context.Context, req ExecRequest, cwd string, interrupt func() error) (ExecResult, error) {
+	if req.Stdin != nil {
+		return ExecResult{}, fmt.Errorf("stdin is not supported in stateful sessions")
+	}
+	line, markers, err := shellCommandLine(req, cwd)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	if err := s.failure(); err != nil {
+		return ExecResult{}, err
+	}
+
+	stdout := NewOutputCapture(req.MaxOutputBytes)
+	stderr := NewOutputCapture(req.MaxOutputBytes)
+	outCh := make(chan frameResult, 1)
+	errCh := make(chan frameResult, 1)
+	startedAt := time.Now()
+	if _, err := io.WriteString(s.proc.Stdin, line); err != nil {
+		return ExecResult{}, s.fail()
+	}
+	go func() {
+		trailer, err := s.stdout.copyUntil(CaptureWriter(stdout, req.Stdout), markers.begin, markers.end)
+		outCh <- frameResult{trailer: trailer, err: err}
+	}()
+	go func() {
+		trailer, err := s.stderr.copyUntil(CaptureWriter(stderr, req.Stderr), markers.begin, markers.end)
+		errCh <- frameResult{trailer: trailer, err: err}
+	}()
+
+	var out, errOut frameResult
+	gotOut, gotErr := false, false
+	done := ctx.Done()
+	interrupted := false
+	var grace <-chan time.Time
+	for !gotOut || !gotErr {
+		select {
+		case out = <-outCh:
+			gotOut = true
+		case errOut = <-errCh:
+			gotErr = true
+		case <-done:
+			done = nil
+			if interrupt != nil {
+				interrupted = interrupt() == nil
+			}
+			grace = time.After(shellStopGrace)
+		case <-grace:
+			// The command ignored the interrupt; only killing the shell stops it.
+			grace = nil
+			_ = s.proc.Kill()
+		}
+	}
+
+	result := CapturedResult(stdout, stderr)
+	result.StartedAt = startedAt.UTC()
+	result.Duration = time.Since(startedAt)
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if out.err != nil || errOut.err != nil {
+		failErr := s.fail()
+		if ctx.Err() != nil {
+			result.ExitCode = -1
+			return result, nil
+		}
+		return result, failErr
+	}
+	code, cwdAfter, env, err := parseShellTrailer(out.trailer)
+	if err != nil {
+		_ = s.fail()
+		return result, err
+	}
+	s.stateMu.Lock()
+	s.cwd, s.env = cwdAfter, env
+	s.stateMu.Unlock()
+	result.ExitCode = code
+	if interrupted && code == 128+int(syscall.SIGKILL) {
+		result.Signal = SignalName(syscall.SIGKILL)
+	}
+	result.Cwd = cwdAfter
+	result.Env = cloneEnv(env)
+	return result, nil
+}
+
+// Close stops the shell, killing it if it does not exit promptly.
+func (s *Shell) Close() error {
+	_ = s.proc.Stdin.Close()
+	select {
+	case <-s.waited:
+	case <-time.After(shellStopGrace):
+		_ = s.proc.Kill()
+		<-s.waited
+	}
+	s.stateMu.Lock()
+	if s.err == nil {
+		s.err = ErrShellExited
+	}
+	s.stateMu.Unlock()
+	return nil
+}
+
+// failure returns the error that made the shell unusable, if any.
+func (s *Shell) failure() error {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.err
+}
+
+// fail marks the shell unusable, kills it and returns the resulting error.
+// Callers hold s.execMu.
+func (s *Shell) fail() error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+	_ = s.proc.Stdin.Close()
+	_ = s.proc.Kill()
+	err := ErrShellExited
+	select {
+	case <-s.waited:
+		if s.waitErr != nil {
+			err = fmt.Errorf("%w (%v)", ErrShellExited, s.waitErr)
+		}
+	case <-time.After(shellStopGrace):
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+type shellMarkers struct {
+	begin []byte
+	end   []byte
+}
+
+// shellCommandLine renders req as one line of shell input. Per-command
+// variables are assignments in front of eval, so they apply to the command
+// only, while eval itself runs in the shell and keeps cd and export.
+func shellCommandLine(req ExecRequest, cwd string) (string, shellMarkers, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", shellMarkers{}, err
+	}
+	tag := hex.EncodeToString(nonce)
+	markers := shellMarkers{
+		begin: []byte("__VIBEBOX_DONE_" + tag + "__"),
+		end:   []byte("__VIBEBOX_END_" + tag + "__"),
+	}
+
+	command := req.Command
+	if len(req.Args) > 0 {
+		quoted := make([]string, len(req.Args))
+		for i, arg := range req.Args {
+			quoted[i] = shellQuote(arg)
+		}
+		command = strings.Join(quoted, " ")
+	}
+
+	keys := make([]string, 0, len(req.Env))
+	for k := range req.Env {
+		if !envNamePattern.MatchString(k) {
+			return "", shellMarkers{}, fmt.Errorf("invalid environment variable name: %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	if cwd != "" {
+		b.WriteString("cd " + shellQuote(cwd) + " && ")
+	}
+	for _, k := range keys {
+		b.WriteString(k + "=" + shellQuote(req.Env[k]) + " ")
+	}
+	b.WriteString("eval " + shellQuote(command) + " </dev/null; ")
+	b.WriteString("__vibebox_done $? " + string(markers.begin) + " " + string(markers.end) + "\n")
+	return b.String(), markers, nil
+}
+
+// parseShellTrailer decodes "<code>:<cwd>\0<KEY=VALUE>\0..." written by __vibebox_done.
+func parseShellTrailer(trailer []byte) (int, string, map[string]string, error) {
+	fields := bytes.Split(trailer, []byte{0})
+	head := string(fields[0])
+	codeText, cwd, ok := strings.Cut(head, ":")
+	if !ok {
+		return 0, "", nil, fmt.Errorf("malformed session shell status: %q", head)
+	}
+	code, err := strconv.Atoi(codeText)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("malformed session shell exit code: %q", codeText)
+	}
+	env := map[string]string{}
+	for _, field := range fields[1:] {
+		if k, v, ok := strings.Cut(string(field), "="); ok {
+			env[k] = v
+		}
+	}
+	return code, cwd, env, nil
+}
+
+type frameResult struct {
+	trailer []byte
+	err     error
+}
+
+// frameReader splits a stream into per-command frames delimited by markers.
+// Bytes read past a frame are kept for the next one.
+type frameReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// copyUntil writes everything before begin to w and returns the bytes between
+// begin and end.
+func (f *frameReader) copyUntil(w io.Writer, begin, end []byte) ([]byte, error) {
+	for {
+		if i := bytes.Index(f.buf, begin); i >= 0 {
+			_, _ = w.Write(f.buf[:i])
+			f.buf = f.buf[i+len(begin):]
+			break
+		}
+		// Hold back a possible partial marker; flush the rest so output stays live.
+		if keep := len(begin) - 1; len(f.buf) > keep {
+			_, _ = w.Write(f.buf[:len(f.buf)-keep])
+			f.buf = append(f.buf[:0], f.buf[len(f.buf)-keep:]...)
+		}
+		if err := f.fill(); err != nil {
+			_, _ = w.Write(f.buf)
+			f.buf = nil
+			return nil, err
+		}
+	}
+	for {
+		if j := bytes.Index(f.buf, end); j >= 0 {
+			trailer := append([]byte(nil), f.buf[:j]...)
+			f.buf = append(f.buf[:0], f.buf[j+len(end):]...)
+			return trailer, nil
+		}
+		if err := f.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *frameReader) fill() error {
+	chunk := make([]byte, shellReadChunk)
+	n, err := f.r.Read(chunk)
+	f.buf = append(f.buf, chunk[:n]...)
+	if n > 0 {
+		return nil
+	}
+	return err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func cloneEnv(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+var signalNames = map[string]bool{
+	"HUP": true, "INT": true, "QUIT": true, "KILL": true, "USR1": true,
+	"USR2": true, "TERM": true, "STOP": true, "CONT": true,
+}
+
+var signalNumbers = map[syscall.Signal]string{
+	syscall.SIGHUP: "HUP", syscall.SIGINT: "INT", syscall.SIGQUIT: "QUIT",
+	syscall.SIGKILL: "KILL", syscall.SIGUSR1: "USR1", syscall.SIGUSR2: "USR2",
+	syscall.SIGTERM: "TERM", syscall.SIGSTOP: "STOP", syscall.SIGCONT: "CONT",
+}
+
+// SignalName returns the canonical name of a signal taken from a wait status,
+// such as "KILL", falling back to the platform description for other signals.
+func SignalName(sig syscall.Signal) string {
+	if name, ok := signalNumbers[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
+
+// NormalizeSignal maps user input such as "sigterm" or "SIGTERM" to the
+// canonical name accepted by ProcessBackend.SignalProcess.
+func NormalizeSignal(name string) (string, error) {
+	canonical := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if !signalNames[canonical] {
+		return "", fmt.Errorf("unsupported signal: %q", name)
+	}
+	return canonical, nil
+}
@@ -6,6 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -20,15 +23,21 @@ const (
 	ProviderAppleVM Provider = "apple-vm"
 	ProviderMacOS   Provider = "macos" // legacy alias, normalized to apple-vm.
 	ProviderDocker  Provider = "docker"
+	ProviderLinuxNS Provider = "linux-ns"
+	ProviderPodman  Provider = "podman"
 )
 
-func (p Provider) Validate() error {
+// Validate accepts the built-in providers and the names in registered, which
+// callers with a backend registry pass for their custom backends.
+func (p Provider) Validate(registered ...Provider) error {
 	switch p {
-	case ProviderOff, ProviderAuto, ProviderAppleVM, ProviderDocker:
+	case ProviderOff, ProviderAuto, ProviderAppleVM, ProviderDocker, ProviderLinuxNS, ProviderPodman:
+		return nil
+	}
+	if p != "" && slices.Contains(registered, p) {
 		return nil
-	default:
-		return fmt.Errorf("invalid provider: %q", p)
 	}
+	return fmt.Errorf("invalid provider: %q", p)
 }
 
 // NormalizeProvider maps legacy provider names to canonical values.
@@ -43,10 +52,31 @@ func NormalizeProvider(p Provider) Provider {
 
 // Config is the project-level vibebox configuration.
 type Config struct {
-	Provider Provider     `yaml:"provider"`
-	VM       VMConfig     `yaml:"vm"`
-	Docker   DockerConfig `yaml:"docker"`
-	Mounts   []Mount      `yaml:"mounts"`
+	Provider Provider      `yaml:"provider"`
+	VM       VMConfig      `yaml:"vm"`
+	Docker   DockerConfig  `yaml:"docker"`
+	Podman   PodmanConfig  `yaml:"podman,omitempty"`
+	LinuxNS  LinuxNSConfig `yaml:"linux_ns,omitempty"`
+	Exec     ExecConfig    `yaml:"exec"`
+	Auto     AutoConfig    `yaml:"auto,omitempty"`
+	// Shell is the argv prefix that runs string commands, which are appended as
+	// the last argument. Empty means DefaultShell.
+	Shell  []string `yaml:"shell,omitempty"`
+	Mounts []Mount  `yaml:"mounts"`
+}
+
+// DefaultShell runs string commands when Config.Shell is empty.
+var DefaultShell = []string{"/bin/bash", "-lc"}
+
+// ShellCommand returns the argv that runs command through the configured shell.
+func (c Config) ShellCommand(command string) []string {
+	shell := c.Shell
+	if len(shell) == 0 {
+		shell = DefaultShell
+	}
+	out := make([]string, 0, len(shell)+1)
+	out = append(out, shell...)
+	return append(out, command)
 }
 
 // VMConfig stores VM backend settings.
@@ -63,6 +93,201 @@ type VMConfig struct {
 // DockerConfig stores Docker backend settings.
 type DockerConfig struct {
 	Image string `yaml:"image"`
+	// FreshContainers runs every one-shot exec in a new container. By default
+	// execs share a long-lived per-project container, which is much faster but
+	// lets files outside mounts and background state carry over between execs.
+	FreshContainers bool `yaml:"fresh_containers,omitempty"`
+	// WarmIdleMinutes is how long the shared container may go without execs
+	// before the backend removes it. Zero means DefaultWarmIdleMinutes.
+	WarmIdleMinutes int `yaml:"warm_idle_minutes,omitempty"`
+	// Resource limits for every container the backend creates. Zero means no
+	// limit. CPUs may be fractional, for example 1.5.
+	CPUs      float64        `yaml:"cpus,omitempty"`
+	MemoryMB  int            `yaml:"memory_mb,omitempty"`
+	PidsLimit int            `yaml:"pids_limit,omitempty"`
+	ShmSizeMB int            `yaml:"shm_size_mb,omitempty"`
+	Ulimits   []Ulimit       `yaml:"ulimits,omitempty"`
+	Security  DockerSecurity `yaml:"security,omitempty"`
+	// User is who container processes run as: "root", "host" (the uid:gid of
+	// the calling user, so files written to mounts stay owned by them) or an
+	// explicit "uid:gid". Empty means the image's default user.
+	User string `yaml:"user,omitempty"`
+}
+
+// Docker user modes besides an explicit uid:gid.
+const (
+	DockerUserRoot = "root"
+	DockerUserHost = "host"
+)
+
+// DockerSecurity restricts what processes in docker containers can do.
+type DockerSecurity struct {
+	// Preset "hardened" enables a read-only rootfs with HardenedTmpfs, drops
+	// every capability except HardenedCapAdd and sets no_new_privileges.
+	// Options set explicitly below take precedence over the preset.
+	Preset string `yaml:"preset,omitempty"`
+	// ReadOnlyRootfs mounts the image read-only; only mounts and Tmpfs stay
+	// writable. Unset follows the preset; false turns it off under the preset.
+	ReadOnlyRootfs *bool `yaml:"read_only_rootfs,omitempty"`
+	// Tmpfs lists in-memory mounts as path[:options], like docker run --tmpfs.
+	Tmpfs []string `yaml:"tmpfs,omitempty"`
+	// CapDrop removes capabilities ("ALL" for every one) and CapAdd adds
+	// back an allowlist, for example [CHOWN, SETUID].
+	CapDrop []string `yaml:"cap_drop,omitempty"`
+	CapAdd  []string `yaml:"cap_add,omitempty"`
+	// NoNewPrivileges stops setuid binaries from gaining privileges. Unset
+	// follows the preset; false turns it off under the preset.
+	NoNewPrivileges *bool `yaml:"no_new_privileges,omitempty"`
+	// SeccompProfile is a host path to a seccomp JSON profile, relative to the
+	// project root. Empty keeps docker's default profile.
+	SeccompProfile string `yaml:"seccomp_profile,omitempty"`
+	// Runtime names an OCI runtime registered with the daemon, such as runsc
+	// for gVisor. Empty uses the daemon default.
+	Runtime string `yaml:"runtime,omitempty"`
+}
+
+// DockerSecurityHardened is the preset that enables every hardening option.
+const DockerSecurityHardened = "hardened"
+
+var (
+	// HardenedTmpfs are the writable mounts the hardened preset adds. Docker
+	// mounts tmpfs noexec by default, which breaks tools that run what they
+	// unpack or build there.
+	HardenedTmpfs = []string{"/tmp:mode=1777,exec", "/var/tmp:mode=1777,exec", "/run:exec"}
+	// HardenedCapAdd keeps the capabilities root needs to manage files and
+	// switch users, for example to write mounted files owned by the host user.
+	HardenedCapAdd = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "SETGID", "SETUID"}
+)
+
+// Resolved returns s with its preset expanded into individual options.
+func (s DockerSecurity) Resolved() DockerSecurity {
+	if s.Preset != DockerSecurityHardened {
+		return s
+	}
+	enabled := true
+	if s.ReadOnlyRootfs == nil {
+		s.ReadOnlyRootfs = &enabled
+	}
+	if s.NoNewPrivileges == nil {
+		s.NoNewPrivileges = &enabled
+	}
+	if s.Tmpfs == nil {
+		s.Tmpfs = HardenedTmpfs
+	}
+	if s.CapDrop == nil {
+		s.CapDrop = []string{"ALL"}
+	}
+	if s.CapAdd == nil {
+		s.CapAdd = HardenedCapAdd
+	}
+	return s
+}
+
+// Enabled reports whether an optional setting is set to true.
+func Enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+// Ulimit is a process resource limit such as nofile or nproc.
+type Ulimit struct {
+	Name string `yaml:"name"`
+	Soft int64  `yaml:"soft"`
+	Hard int64  `yaml:"hard"`
+}
+
+// ulimitNames lists the limits docker accepts, without the RLIMIT_ prefix.
+var ulimitNames = map[string]bool{
+	"core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+	"memlock": true, "msgqueue": true, "nice": true, "nofile": true, "nproc": true,
+	"rss": true, "rtprio": true, "rttime": true, "sigpending": true, "stack": true,
+}
+
+// DefaultWarmIdleMinutes is the idle time after which shared docker
+// containers are removed, unless docker.warm_idle_minutes is set.
+const DefaultWarmIdleMinutes = 30
+
+// MinDockerMemoryMB is the smallest memory limit docker accepts.
+const MinDockerMemoryMB = 6
+
+// PodmanConfig stores Podman backend settings.
+type PodmanConfig struct {
+	Image string `yaml:"image"`
+	// UserNS is passed as --userns. Empty means keep-id when `podman info`
+	// reports rootless podman, so files written to mounts stay owned by the
+	// host user, and the podman default for rootful podman.
+	UserNS string `yaml:"userns,omitempty"`
+	// Relabel is the SELinux option added to mounts: "Z" (private label), "z"
+	// (shared with other containers) or "none". Empty means z when SELinux is
+	// enabled on the host; Z must be chosen explicitly.
+	Relabel string `yaml:"relabel,omitempty"`
+}
+
+// Podman mount relabel modes.
+const (
+	PodmanRelabelPrivate = "Z"
+	PodmanRelabelShared  = "z"
+	PodmanRelabelNone    = "none"
+)
+
+// LinuxNSConfig stores linux-ns backend settings.
+type LinuxNSConfig struct {
+	// Network is "none" (default: a private network namespace with only
+	// loopback) or "host" to share the host network.
+	Network string `yaml:"network,omitempty"`
+	// Seccomp blocks syscalls that change mounts, namespaces or the kernel.
+	Seccomp bool `yaml:"seccomp,omitempty"`
+	// Landlock limits writes to /tmp, /dev, /root and read-write mounts. It
+	// fails commands on kernels without landlock support.
+	Landlock bool `yaml:"landlock,omitempty"`
+}
+
+// Linux-ns network modes.
+const (
+	LinuxNSNetworkNone = "none"
+	LinuxNSNetworkHost = "host"
+)
+
+// AutoConfig controls how provider auto picks a backend.
+type AutoConfig struct {
+	// Order lists candidate providers by preference. Empty means apple-vm then
+	// docker on macOS, docker, podman then linux-ns on Linux, and docker elsewhere.
+	Order []Provider `yaml:"order,omitempty"`
+	// AllowOff lets auto fall back to host execution. Off is tried last unless
+	// Order places it earlier.
+	AllowOff bool `yaml:"allow_off,omitempty"`
+}
+
+// Candidates returns the providers auto selection tries, in order.
+func (a AutoConfig) Candidates() []Provider {
+	order := a.Order
+	if len(order) == 0 {
+		switch runtime.GOOS {
+		case "darwin":
+			order = []Provider{ProviderAppleVM, ProviderDocker}
+		case "linux":
+			order = []Provider{ProviderDocker, ProviderPodman, ProviderLinuxNS}
+		default:
+			order = []Provider{ProviderDocker}
+		}
+	}
+	out := make([]Provider, 0, len(order)+1)
+	hasOff := false
+	for _, p := range order {
+		p = NormalizeProvider(p)
+		hasOff = hasOff || p == ProviderOff
+		out = append(out, p)
+	}
+	if a.AllowOff && !hasOff {
+		out = append(out, ProviderOff)
+	}
+	return out
+}
+
+// ExecConfig stores defaults for command execution.
+type ExecConfig struct {
+	// MaxOutputBytes bounds the stdout/stderr retained per stream in exec results.
+	// Zero means unlimited.
+	MaxOutputBytes int `yaml:"max_output_bytes"`
 }
 
 // Mount represents a host-to-guest mount.
@@ -74,8 +299,11 @@ type Mount struct {
 
 func Default() Config {
 	defaultDockerImage := "debian:13"
+	// Podman does not assume docker.io for short names, so use qualified ones.
+	defaultPodmanImage := "docker.io/library/debian:13"
 	if runtime.GOARCH == "arm64" {
 		defaultDockerImage = "arm64v8/debian:13"
+		defaultPodmanImage = "docker.io/arm64v8/debian:13"
 	}
 
 	return Config{
@@ -88,6 +316,9 @@ func Default() Config {
 		Docker: DockerConfig{
 			Image: defaultDockerImage,
 		},
+		Podman: PodmanConfig{
+			Image: defaultPodmanImage,
+		},
 		Mounts: []Mount{{
 			Host:  ".",
 			Guest: "/workspace",
@@ -96,9 +327,11 @@ func Default() Config {
 	}
 }
 
-func (c *Config) Validate() error {
+// Validate checks c and normalizes its providers. registered lists the custom
+// providers accepted besides the built-in ones, see Provider.Validate.
+func (c *Config) Validate(registered ...Provider) error {
 	c.Provider = NormalizeProvider(c.Provider)
-	if err := c.Provider.Validate(); err != nil {
+	if err := c.Provider.Validate(registered...); err != nil {
 		return err
 	}
 	if c.Provider == ProviderAuto || c.Provider == ProviderAppleVM {
@@ -117,6 +350,43 @@ func (c *Config) Validate() error {
 			return errors.New("docker.image is required")
 		}
 	}
+	if err := c.Docker.validate(); err != nil {
+		return err
+	}
+	if c.Provider == ProviderPodman && c.Podman.Image == "" {
+		return errors.New("podman.image is required")
+	}
+	switch c.Podman.Relabel {
+	case "", PodmanRelabelPrivate, PodmanRelabelShared, PodmanRelabelNone:
+	default:
+		return fmt.Errorf("invalid podman.relabel: %q (expected Z, z or none)", c.Podman.Relabel)
+	}
+	switch c.LinuxNS.Network {
+	case "", LinuxNSNetworkNone, LinuxNSNetworkHost:
+	default:
+		return fmt.Errorf("invalid linux_ns.network: %q (expected none or host)", c.LinuxNS.Network)
+	}
+	if c.Exec.MaxOutputBytes < 0 {
+		return errors.New("exec.max_output_bytes must be >= 0")
+	}
+	if len(c.Shell) > 0 && c.Shell[0] == "" {
+		return errors.New("shell[0] must name the shell executable")
+	}
+	seen := map[Provider]bool{}
+	for i, p := range c.Auto.Order {
+		p = NormalizeProvider(p)
+		if p == ProviderAuto {
+			return errors.New("auto.order must not contain auto")
+		}
+		if err := p.Validate(registered...); err != nil {
+			return fmt.Errorf("auto.order: %w", err)
+		}
+		if seen[p] {
+			return fmt.Errorf("auto.order lists %s more than once", p)
+		}
+		seen[p] = true
+		c.Auto.Order[i] = p
+	}
 	for _, m := range c.Mounts {
 		if m.Host == "" || m.Guest == "" {
 			return errors.New("mount.host and mount.guest are required")
@@ -128,6 +398,84 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func (d DockerConfig) validate() error {
+	if err := d.validateLimits(); err != nil {
+		return err
+	}
+	if d.WarmIdleMinutes < 0 {
+		return errors.New("docker.warm_idle_minutes must be >= 0")
+	}
+	if err := d.Security.validate(); err != nil {
+		return err
+	}
+	if d.User != "" && d.User != DockerUserRoot && d.User != DockerUserHost && !isUIDGID(d.User) {
+		return fmt.Errorf("invalid docker.user: %q (expected root, host or uid:gid)", d.User)
+	}
+	return nil
+}
+
+// validateLimits checks the resource limits, ulimits included.
+func (d DockerConfig) validateLimits() error {
+	if d.CPUs < 0 {
+		return errors.New("docker.cpus must be >= 0")
+	}
+	if d.MemoryMB < 0 || (d.MemoryMB > 0 && d.MemoryMB < MinDockerMemoryMB) {
+		return fmt.Errorf("docker.memory_mb must be 0 (unlimited) or >= %d", MinDockerMemoryMB)
+	}
+	if d.PidsLimit < 0 {
+		return errors.New("docker.pids_limit must be >= 0")
+	}
+	if d.ShmSizeMB < 0 {
+		return errors.New("docker.shm_size_mb must be >= 0")
+	}
+	seen := map[string]bool{}
+	for _, u := range d.Ulimits {
+		if !ulimitNames[u.Name] {
+			return fmt.Errorf("invalid docker.ulimits name: %q", u.Name)
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("docker.ulimits lists %s more than once", u.Name)
+		}
+		seen[u.Name] = true
+		if u.Soft < 0 || u.Hard < u.Soft {
+			return fmt.Errorf("docker.ulimits %s: need 0 <= soft <= hard, got soft=%d hard=%d", u.Name, u.Soft, u.Hard)
+		}
+	}
+	return nil
+}
+
+func isUIDGID(s string) bool {
+	uid, gid, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	for _, id := range []string{uid, gid} {
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s DockerSecurity) validate() error {
+	switch s.Preset {
+	case "", DockerSecurityHardened:
+	default:
+		return fmt.Errorf("invalid docker.security.preset: %q (expected hardened)", s.Preset)
+	}
+	for _, t := range s.Tmpfs {
+		if path, _, _ := strings.Cut(t, ":"); !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("docker.security.tmpfs %q must be an absolute guest path", t)
+		}
+	}
+	for _, capability := range append(append([]string(nil), s.CapDrop...), s.CapAdd...) {
+		if capability == "" || strings.ToUpper(capability) != capability || strings.ContainsAny(capability, " \t") {
+			return fmt.Errorf("invalid docker.security capability: %q (expected a name like NET_RAW or ALL)", capability)
+		}
+	}
+	return nil
+}
+
 // ProjectConfigPath returns the path to the project-level config file.
 func ProjectConfigPath(projectRoot string) string {
 	return filepath.Join(projectRoot, ".vibebox", "config.yaml")
@@ -138,6 +486,11 @@ func ProjectStateDir(projectRoot string) string {
 	return filepath.Join(projectRoot, ".vibebox")
 }
 
+// ProjectLogsDir returns the directory for spilled command output.
+func ProjectLogsDir(projectRoot string) string {
+	return filepath.Join(ProjectStateDir(projectRoot), "logs")
+}
+
 // InstanceDiskPath returns project instance disk path.
 func InstanceDiskPath(projectRoot string) string {
 	return filepath.Join(ProjectStateDir(projectRoot), "instance.raw")
@@ -161,7 +514,18 @@ func UserCacheDir() (string, error) {
 	return filepath.Join(cacheDir, "vibebox"), nil
 }
 
-func Load(path string) (Config, error) {
+// UserSessionsDir returns the directory holding the persistent session registry.
+func UserSessionsDir() (string, error) {
+	cfgDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfgDir, "vibebox", "sessions"), nil
+}
+
+// Load reads and validates the config at path, accepting the custom providers
+// in registered.
+func Load(path string, registered ...Provider) (Config, error) {
 	var cfg Config
 	raw, err := os.ReadFile(path)
 	if err != nil {
@@ -189,14 +553,18 @@ func Load(path string) (Config, error) {
 	if cfg.Docker.Image == "" {
 		cfg.Docker.Image = Default().Docker.Image
 	}
+	if cfg.Podman.Image == "" {
+		cfg.Podman.Image = Default().Podman.Image
+	}
 	if len(cfg.Mounts) == 0 {
 		cfg.Mounts = Default().Mounts
 	}
-	return cfg, cfg.Validate()
+	return cfg, cfg.Validate(registered...)
 }
 
-func Save(path string, cfg Config) error {
-	if err := cfg.Validate(); err != nil {
+// Save validates cfg, accepting the custom providers in registered, and writes it to path.
+func Save(path string, cfg Config, registered ...Provider) error {
+	if err := cfg.Validate(registered...); err != nil {
 		return err
 	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
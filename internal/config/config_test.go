@@ -54,3 +54,154 @@ func TestLoadLegacyMacOSProviderAlias(t *testing.T) {
 		t.Fatalf("expected provider apple-vm, got %s", cfg.Provider)
 	}
 }
+
+func TestValidateAutoOrder(t *testing.T) {
+	t.Parallel()
+	cfg := Default()
+	cfg.Auto = AutoConfig{Order: []Provider{ProviderDocker, ProviderMacOS}, AllowOff: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	got := cfg.Auto.Candidates()
+	want := []Provider{ProviderDocker, ProviderAppleVM, ProviderOff}
+	if len(got) != len(want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candidates = %v, want %v", got, want)
+		}
+	}
+
+	for _, order := range [][]Provider{{ProviderAuto}, {ProviderDocker, ProviderDocker}, {"nope"}} {
+		cfg := Default()
+		cfg.Auto.Order = order
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected auto.order %v to be rejected", order)
+		}
+	}
+
+	custom := Default()
+	custom.Provider = "test-firecracker"
+	custom.Auto.Order = []Provider{"test-firecracker", ProviderOff}
+	if err := custom.Validate(); err == nil {
+		t.Fatalf("expected an unregistered custom provider to be rejected")
+	}
+	if err := custom.Validate("test-firecracker"); err != nil {
+		t.Fatalf("registered custom provider: %v", err)
+	}
+}
+
+func TestLoadFillsPodmanDefaults(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	raw := []byte("provider: podman\npodman:\n  relabel: z\n")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Podman.Image != Default().Podman.Image {
+		t.Fatalf("expected default podman image, got %q", cfg.Podman.Image)
+	}
+	if cfg.Podman.Relabel != PodmanRelabelShared {
+		t.Fatalf("expected relabel z, got %q", cfg.Podman.Relabel)
+	}
+
+	bad := Default()
+	bad.Podman.Relabel = "shared"
+	if err := bad.Validate(); err == nil {
+		t.Fatalf("expected invalid podman.relabel to be rejected")
+	}
+}
+
+func TestLoadDockerLimits(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	raw := []byte("provider: docker\ndocker:\n  cpus: 1.5\n  memory_mb: 512\n  pids_limit: 256\n  ulimits:\n    - name: nofile\n      soft: 1024\n      hard: 4096\n")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Docker.CPUs != 1.5 || cfg.Docker.MemoryMB != 512 || cfg.Docker.PidsLimit != 256 {
+		t.Fatalf("unexpected docker limits: %+v", cfg.Docker)
+	}
+	if len(cfg.Docker.Ulimits) != 1 || cfg.Docker.Ulimits[0] != (Ulimit{Name: "nofile", Soft: 1024, Hard: 4096}) {
+		t.Fatalf("unexpected ulimits: %+v", cfg.Docker.Ulimits)
+	}
+
+	for _, docker := range []DockerConfig{
+		{CPUs: -1},
+		{MemoryMB: 4},
+		{PidsLimit: -1},
+		{ShmSizeMB: -1},
+		{WarmIdleMinutes: -1},
+		{Ulimits: []Ulimit{{Name: "files", Soft: 1, Hard: 1}}},
+		{Ulimits: []Ulimit{{Name: "nofile", Soft: 2, Hard: 1}}},
+		{Ulimits: []Ulimit{{Name: "nproc", Soft: 1, Hard: 1}, {Name: "nproc", Soft: 1, Hard: 1}}},
+	} {
+		bad := Default()
+		docker.Image = bad.Docker.Image
+		bad.Docker = docker
+		if err := bad.Validate(); err == nil {
+			t.Fatalf("expected docker config %+v to be rejected", docker)
+		}
+	}
+}
+
+func TestDockerSecurityPreset(t *testing.T) {
+	t.Parallel()
+	sec := DockerSecurity{Preset: DockerSecurityHardened, CapAdd: []string{}}.Resolved()
+	if !Enabled(sec.ReadOnlyRootfs) || !Enabled(sec.NoNewPrivileges) || len(sec.Tmpfs) != len(HardenedTmpfs) {
+		t.Fatalf("unexpected hardened settings: %+v", sec)
+	}
+	if len(sec.CapDrop) != 1 || sec.CapDrop[0] != "ALL" || len(sec.CapAdd) != 0 {
+		t.Fatalf("expected every capability dropped with an empty allowlist: %+v", sec)
+	}
+	if plain := (DockerSecurity{Runtime: "runsc"}).Resolved(); Enabled(plain.ReadOnlyRootfs) || plain.CapDrop != nil {
+		t.Fatalf("options without a preset must stay as configured: %+v", plain)
+	}
+	no := false
+	if sec := (DockerSecurity{Preset: DockerSecurityHardened, ReadOnlyRootfs: &no, NoNewPrivileges: &no}).Resolved(); Enabled(sec.ReadOnlyRootfs) || Enabled(sec.NoNewPrivileges) {
+		t.Fatalf("explicit false must override the preset: %+v", sec)
+	}
+
+	for _, sec := range []DockerSecurity{
+		{Preset: "strict"},
+		{Tmpfs: []string{"tmp"}},
+		{CapDrop: []string{"all"}},
+	} {
+		cfg := Default()
+		cfg.Docker.Security = sec
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected docker.security %+v to be rejected", sec)
+		}
+	}
+}
+
+func TestValidateDockerUser(t *testing.T) {
+	t.Parallel()
+	for _, user := range []string{"", DockerUserRoot, DockerUserHost, "1000:1000"} {
+		cfg := Default()
+		cfg.Docker.User = user
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("docker.user %q: %v", user, err)
+		}
+	}
+	for _, user := range []string{"1000", "alice", "1000:", "-1:0", "host:1"} {
+		cfg := Default()
+		cfg.Docker.User = user
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected docker.user %q to be rejected", user)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package vibebox
+
+import (
+	"fmt"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/backend/linuxns"
+)
+
+// Backend is implemented by sandbox runtimes plugged in with WithBackend. A
+// backend can additionally implement SessionBackend, SessionPersister,
+// ProcessBackend, FileBackend and Cleaner to support the corresponding Service APIs.
+type Backend = backend.Backend
+
+// Types used by Backend implementations.
+type (
+	RuntimeSpec         = backend.RuntimeSpec
+	BackendExecRequest  = backend.ExecRequest
+	BackendExecResult   = backend.ExecResult
+	BackendProbeResult  = backend.ProbeResult
+	SessionBackend      = backend.SessionBackend
+	SessionHandle       = backend.SessionHandle
+	SessionStartRequest = backend.SessionStartRequest
+	SessionPersister    = backend.SessionPersister
+	ProcessBackend      = backend.ProcessBackend
+	ProcessHandle       = backend.ProcessHandle
+	ProcessExit         = backend.ProcessExit
+	FileBackend         = backend.FileBackend
+	BackendFileInfo     = backend.FileInfo
+	Cleaner             = backend.Cleaner
+)
+
+// MaybeRunSandboxInit must be called at the start of main by programs that use
+// the linux-ns provider, which re-executes the program as the init of each
+// sandbox. In such a child it runs the sandboxed command and exits; otherwise
+// it returns immediately. Without it the linux-ns provider is unavailable.
+func MaybeRunSandboxInit() {
+	linuxns.MaybeRunInit()
+}
+
+// WithBackend registers impl under provider name, so it can be selected with
+// ProviderOverride or the project config's provider field. Registering a
+// built-in name (off, apple-vm, docker, podman, linux-ns) replaces that
+// backend. The name is only valid for the Service created with this option.
+// NewService fails if name is empty or reserved (auto, macos) or impl is nil.
+func WithBackend(name string, impl Backend) Option {
+	return func(s *Service) error {
+		if err := s.backends.Register(name, impl); err != nil {
+			return fmt.Errorf("with backend: %w", err)
+		}
+		return nil
+	}
+}
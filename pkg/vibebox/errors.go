@@ -0,0 +1,107 @@
+package vibebox
+
+import (
+	"context"
+	"errors"
+
+	"vibebox/internal/backend"
+)
+
+// Sentinel errors returned by Service methods. Match them with errors.Is; the
+// returned errors add the offending ID or path to the message.
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrSessionNotActive = errors.New("session is not active")
+	ErrExecNotFound     = errors.New("exec not found")
+	ErrProcessNotFound  = errors.New("process not found")
+	// ErrNotInitialized is returned by APIs that need `vibebox init` to have run for the project.
+	ErrNotInitialized = errors.New("project is not initialized")
+	// ErrCwdEscapesProject is returned when a cwd or file path resolves outside the project root.
+	ErrCwdEscapesProject = backend.ErrEscapesProjectRoot
+	// ErrShellExited is returned by ExecInSession once the shell of a stateful
+	// session has exited, for example after `exit`. Stop the session and start a new one.
+	ErrShellExited = backend.ErrShellExited
+)
+
+// ProviderUnavailableError reports that the requested provider, or every
+// candidate of auto selection, failed its probe. Match it with errors.As.
+type ProviderUnavailableError struct {
+	// Provider is the requested provider, ProviderAuto for auto selection.
+	Provider Provider
+	// Diagnostic is the probe result of Provider; empty for ProviderAuto.
+	Diagnostic BackendDiagnostic
+	// Diagnostics holds the probe results of every backend.
+	Diagnostics map[string]BackendDiagnostic
+	// Skipped explains each rejected candidate of auto selection.
+	Skipped []SkippedProvider
+	message string
+}
+
+func (e *ProviderUnavailableError) Error() string {
+	return e.message
+}
+
+// Stable error codes reported by ErrorCode and `vibebox exec --json`.
+const (
+	ErrorCodeSessionNotFound     = "session_not_found"
+	ErrorCodeSessionNotActive    = "session_not_active"
+	ErrorCodeExecNotFound        = "exec_not_found"
+	ErrorCodeProcessNotFound     = "process_not_found"
+	ErrorCodeNotInitialized      = "not_initialized"
+	ErrorCodeProviderUnavailable = "provider_unavailable"
+	ErrorCodeCwdEscapesProject   = "cwd_escapes_project"
+	ErrorCodeShellExited         = "shell_exited"
+	ErrorCodeCanceled            = "canceled"
+	ErrorCodeTimeout             = "timeout"
+	// ErrorCodeInvalidArgument is reported by the CLI for malformed flags.
+	ErrorCodeInvalidArgument = "invalid_argument"
+	ErrorCodeUnknown         = "unknown"
+)
+
+// ErrorCode maps an error returned by Service to a stable code for bridges that
+// cannot inspect Go error values. It returns "" for a nil error.
+func ErrorCode(err error) string {
+	var unavailable *ProviderUnavailableError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrSessionNotFound):
+		return ErrorCodeSessionNotFound
+	case errors.Is(err, ErrSessionNotActive):
+		return ErrorCodeSessionNotActive
+	case errors.Is(err, ErrExecNotFound):
+		return ErrorCodeExecNotFound
+	case errors.Is(err, ErrProcessNotFound):
+		return ErrorCodeProcessNotFound
+	case errors.Is(err, ErrNotInitialized):
+		return ErrorCodeNotInitialized
+	case errors.As(err, &unavailable):
+		return ErrorCodeProviderUnavailable
+	case errors.Is(err, ErrCwdEscapesProject):
+		return ErrorCodeCwdEscapesProject
+	case errors.Is(err, ErrShellExited):
+		return ErrorCodeShellExited
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCodeCanceled
+	default:
+		return ErrorCodeUnknown
+	}
+}
+
+// selectionError converts a backend selection failure into a ProviderUnavailableError.
+func selectionError(err error) error {
+	var unavailable *backend.UnavailableError
+	if !errors.As(err, &unavailable) {
+		return err
+	}
+	diagnostics := toPublicDiagnostics(unavailable.Diagnostics)
+	return &ProviderUnavailableError{
+		Provider:    Provider(unavailable.Provider),
+		Diagnostic:  diagnostics[string(unavailable.Provider)],
+		Diagnostics: diagnostics,
+		Skipped:     toPublicSkipped(unavailable.Skipped),
+		message:     unavailable.Error(),
+	}
+}
@@ -0,0 +1,107 @@
+package vibebox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// runningExec tracks one in-flight command so it can be listed and cancelled.
+type runningExec struct {
+	info     ExecInfo
+	cancel   context.CancelFunc
+	done     chan struct{}
+	canceled bool
+}
+
+// CancelExec kills an in-flight command started by Exec or ExecInSession.
+// It returns once the backend has torn the command down or ctx is done.
+func (s *Service) CancelExec(ctx context.Context, execID string) error {
+	s.mu.Lock()
+	run, ok := s.execs[execID]
+	if ok {
+		run.canceled = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrExecNotFound, execID)
+	}
+
+	run.cancel()
+	select {
+	case <-run.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ListExecs returns in-flight commands ordered by start time.
+// When sessionID is set, only commands running in that session are listed.
+func (s *Service) ListExecs(_ context.Context, sessionID string) ([]ExecInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sessionID != "" {
+		if _, ok := s.sessions[sessionID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+		}
+	}
+	out := make([]ExecInfo, 0, len(s.execs))
+	for _, run := range s.execs {
+		if sessionID != "" && run.info.SessionID != sessionID {
+			continue
+		}
+		out = append(out, run.info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].StartedAt.Before(out[j].StartedAt)
+	})
+	return out, nil
+}
+
+// beginExec registers a new execution and returns a context that CancelExec cancels.
+func (s *Service) beginExec(ctx context.Context, sessionID string, command string, args []string, provider Provider) (context.Context, *runningExec, error) {
+	id, err := newExecID()
+	if err != nil {
+		return nil, nil, err
+	}
+	execCtx, cancel := context.WithCancel(ctx)
+	run := &runningExec{
+		info: ExecInfo{
+			ID:        id,
+			SessionID: sessionID,
+			Command:   command,
+			Args:      cloneArgs(args),
+			Selected:  provider,
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.execs[id] = run
+	s.mu.Unlock()
+	return execCtx, run, nil
+}
+
+// endExec unregisters an execution and reports whether it was cancelled via CancelExec.
+func (s *Service) endExec(run *runningExec) bool {
+	s.mu.Lock()
+	delete(s.execs, run.info.ID)
+	canceled := run.canceled
+	s.mu.Unlock()
+	run.cancel()
+	close(run.done)
+	return canceled
+}
+
+func newExecID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "x_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,110 @@
+package vibebox
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"vibebox/internal/backend"
+)
+
+// Paths passed to the file API are guest paths. Relative paths resolve against
+// the project root as seen by the sandbox; the off backend rejects paths outside it.
+// Missing files are reported with errors wrapping fs.ErrNotExist.
+
+// ReadFile returns the content of a file inside a session.
+func (s *Service) ReadFile(ctx context.Context, sessionID string, path string) ([]byte, error) {
+	record, fb, err := s.fileSession(sessionID, path)
+	if err != nil {
+		return nil, err
+	}
+	return fb.ReadFile(ctx, record.spec, record.handle, path)
+}
+
+// WriteFile writes a file inside a session. Content is passed as bytes, so binary
+// data and shell metacharacters need no quoting.
+func (s *Service) WriteFile(ctx context.Context, req WriteFileRequest) error {
+	record, fb, err := s.fileSession(req.SessionID, req.Path)
+	if err != nil {
+		return err
+	}
+	mode := req.Mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	return fb.WriteFile(ctx, record.spec, record.handle, req.Path, req.Data, mode)
+}
+
+// ListDir returns the entries of a directory inside a session.
+func (s *Service) ListDir(ctx context.Context, sessionID string, path string) ([]FileInfo, error) {
+	record, fb, err := s.fileSession(sessionID, path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fb.ListDir(ctx, record.spec, record.handle, path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, fromInternalFileInfo(e))
+	}
+	return out, nil
+}
+
+// Stat describes a file or directory inside a session.
+func (s *Service) Stat(ctx context.Context, sessionID string, path string) (FileInfo, error) {
+	record, fb, err := s.fileSession(sessionID, path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := fb.Stat(ctx, record.spec, record.handle, path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return fromInternalFileInfo(info), nil
+}
+
+// Remove deletes a file or directory inside a session.
+func (s *Service) Remove(ctx context.Context, req RemoveRequest) error {
+	record, fb, err := s.fileSession(req.SessionID, req.Path)
+	if err != nil {
+		return err
+	}
+	return fb.Remove(ctx, record.spec, record.handle, req.Path, req.Recursive)
+}
+
+// MkdirAll creates a directory and any missing parents inside a session.
+func (s *Service) MkdirAll(ctx context.Context, sessionID string, path string) error {
+	record, fb, err := s.fileSession(sessionID, path)
+	if err != nil {
+		return err
+	}
+	return fb.MkdirAll(ctx, record.spec, record.handle, path, 0o755)
+}
+
+func (s *Service) fileSession(sessionID string, path string) (*managedSession, backend.FileBackend, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("path is required")
+	}
+	record, err := s.activeSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	fb, ok := record.sessionBackend.(backend.FileBackend)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s backend does not support file operations", record.backend.Name())
+	}
+	s.touchSession(record)
+	return record, fb, nil
+}
+
+func fromInternalFileInfo(in backend.FileInfo) FileInfo {
+	return FileInfo{
+		Name:    in.Name,
+		Size:    in.Size,
+		Mode:    in.Mode,
+		ModTime: in.ModTime,
+		IsDir:   in.Mode&fs.ModeDir != 0,
+	}
+}
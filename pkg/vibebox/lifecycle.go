@@ -0,0 +1,193 @@
+package vibebox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"vibebox/internal/backend"
+)
+
+const (
+	// reaperInterval is how often the reaper checks sessions for expiry.
+	reaperInterval = time.Second
+	// reaperStopTimeout bounds stopping one expired session.
+	reaperStopTimeout = 30 * time.Second
+)
+
+// Close stops every session managed by this Service and the background reaper.
+// Sessions stopped here are removed from the session registry, so callers that
+// want to reattach after a restart should not call Close. The Service cannot
+// start or attach sessions afterwards.
+func (s *Service) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	stop, done := s.reaperStop, s.reaperDone
+	s.reaperStop, s.reaperDone = nil, nil
+	ids := make([]string, 0, len(s.sessions))
+	for id, record := range s.sessions {
+		if record.session.State == SessionStateActive {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := s.StopSession(ctx, StopSessionRequest{SessionID: id}); err != nil {
+			errs = append(errs, fmt.Errorf("stop session %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cleanup removes sandboxes that backends keep between calls, such as the
+// shared per-project containers of docker execs, when they have been idle past
+// their timeout, or all of them with req.All. Backends reap idle sandboxes on
+// their own as they are used; Cleanup also covers hosts where they no longer are.
+func (s *Service) Cleanup(ctx context.Context, req CleanupRequest) (CleanupResult, error) {
+	provider, err := s.normalizeProvider(req.Provider)
+	if err != nil {
+		return CleanupResult{}, err
+	}
+	names := []string{string(provider)}
+	if provider == ProviderAuto {
+		names = s.backends.Names()
+	}
+	var result CleanupResult
+	var errs []error
+	for _, name := range names {
+		b, ok := s.backends.Lookup(name)
+		if !ok {
+			continue
+		}
+		cleaner, ok := b.(backend.Cleaner)
+		if !ok {
+			continue
+		}
+		if provider == ProviderAuto && !s.probes.Probe(ctx, name, b).Available {
+			continue
+		}
+		removed, err := cleaner.Cleanup(ctx, req.All)
+		result.Removed = append(result.Removed, removed...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("clean up %s: %w", name, err))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// touchSession records activity on a session for IdleTimeout accounting, and
+// every activityPersistInterval in the registry too, so the session can still
+// expire should this process exit without stopping it.
+func (s *Service) touchSession(record *managedSession) {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record.session.LastActivityAt = now
+	// Checked under s.mu, so a record deleted by StopSession is not written back.
+	if record.session.State == SessionStateActive && now.Sub(record.activityPersistedAt) >= activityPersistInterval {
+		// A failed write only makes the record look idle for longer.
+		_ = s.persistSession(record)
+	}
+}
+
+// ensureReaper starts the reaper goroutine if a session needs expiry checks.
+// Callers hold s.mu.
+func (s *Service) ensureReaper(record *managedSession) {
+	if s.reaperStop != nil || (record.session.IdleTimeout <= 0 && record.session.MaxLifetime <= 0) {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.reaperStop, s.reaperDone = stop, done
+	go s.reap(stop, done)
+}
+
+func (s *Service) reap(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, exp := range s.expiredSessions(now.UTC()) {
+				s.expireSession(exp.record, exp.reason)
+			}
+		}
+	}
+}
+
+type sessionExpiry struct {
+	record *managedSession
+	reason string
+}
+
+// expiredSessions returns the active sessions past their limits at now. Sessions
+// with in-flight execs or running processes are busy and never idle.
+func (s *Service) expiredSessions(now time.Time) []sessionExpiry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []sessionExpiry
+	for id, record := range s.sessions {
+		session := &record.session
+		if session.State != SessionStateActive {
+			continue
+		}
+		if session.MaxLifetime > 0 && now.Sub(session.CreatedAt) >= session.MaxLifetime {
+			out = append(out, sessionExpiry{record: record, reason: "max lifetime"})
+			continue
+		}
+		if session.IdleTimeout <= 0 {
+			continue
+		}
+		if s.sessionBusyLocked(id) {
+			session.LastActivityAt = now
+			continue
+		}
+		if now.Sub(session.LastActivityAt) >= session.IdleTimeout {
+			out = append(out, sessionExpiry{record: record, reason: "idle timeout"})
+		}
+	}
+	return out
+}
+
+func (s *Service) sessionBusyLocked(sessionID string) bool {
+	for _, run := range s.execs {
+		if run.info.SessionID == sessionID {
+			return true
+		}
+	}
+	for _, proc := range s.processes {
+		if proc.info.SessionID == sessionID && proc.snapshot().State == ProcessStateRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) expireSession(record *managedSession, reason string) {
+	id := record.session.ID
+	ctx, cancel := context.WithTimeout(context.Background(), reaperStopTimeout)
+	defer cancel()
+	err := s.StopSession(ctx, StopSessionRequest{SessionID: id})
+	emit(record.onEvent, Event{
+		Kind:      "session.expired",
+		Message:   fmt.Sprintf("session expired after %s", reason),
+		SessionID: id,
+		Err:       err,
+		Done:      true,
+	})
+}
@@ -0,0 +1,22 @@
+package vibebox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	MaybeRunSandboxInit()
+	// Keep sessions started by tests out of the user's registry.
+	dir, err := os.MkdirTemp("", "vibebox-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defaultSessionsDir = func() (string, error) { return filepath.Join(dir, "sessions"), nil }
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,85 @@
+package vibebox
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+// resolveMaxOutputBytes applies the project default to a per-request limit.
+func resolveMaxOutputBytes(requested int, cfg config.Config) int {
+	switch {
+	case requested < 0:
+		return 0
+	case requested == 0:
+		return cfg.Exec.MaxOutputBytes
+	default:
+		return requested
+	}
+}
+
+// outputSpill receives the full output of one command under .vibebox/logs/.
+type outputSpill struct {
+	stdout *os.File
+	stderr *os.File
+}
+
+func openOutputSpill(projectRoot string, execID string) (*outputSpill, error) {
+	dir := config.ProjectLogsDir(projectRoot)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	stdout, err := os.Create(filepath.Join(dir, execID+".stdout.log"))
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := os.Create(filepath.Join(dir, execID+".stderr.log"))
+	if err != nil {
+		_ = stdout.Close()
+		_ = os.Remove(stdout.Name())
+		return nil, err
+	}
+	return &outputSpill{stdout: stdout, stderr: stderr}, nil
+}
+
+// writers returns live writers that also feed the spill files.
+func (o *outputSpill) writers(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if o == nil {
+		return stdout, stderr
+	}
+	return teeWriter(stdout, o.stdout), teeWriter(stderr, o.stderr)
+}
+
+// finish closes the spill files, keeping only those of truncated streams, and
+// records their paths in result.
+func (o *outputSpill) finish(result *ExecResult, beResult backend.ExecResult) error {
+	if o == nil {
+		return nil
+	}
+	stdoutPath, stdoutErr := closeSpillFile(o.stdout, beResult.StdoutTruncated)
+	stderrPath, stderrErr := closeSpillFile(o.stderr, beResult.StderrTruncated)
+	result.StdoutLogPath = stdoutPath
+	result.StderrLogPath = stderrPath
+	return errors.Join(stdoutErr, stderrErr)
+}
+
+func closeSpillFile(f *os.File, keep bool) (string, error) {
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if !keep {
+		return "", os.Remove(f.Name())
+	}
+	return f.Name(), nil
+}
+
+func teeWriter(live io.Writer, spill io.Writer) io.Writer {
+	if live == nil {
+		return spill
+	}
+	return io.MultiWriter(live, spill)
+}
@@ -0,0 +1,360 @@
+package vibebox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultHealthCheckTimeoutSeconds = 10
+
+// SessionPool keeps warm sessions for one project and provider so commands can
+// run without paying sandbox startup latency. Sessions are handed out by Acquire
+// and returned with Release or Discard.
+type SessionPool struct {
+	svc  *Service
+	opts SessionPoolOptions
+
+	mu       sync.Mutex
+	idle     []*pooledSession
+	inUse    map[string]*pooledSession
+	starting int
+	// returning counts sessions taken back by Release or Discard that are still being checked or stopped.
+	returning int
+	waiting   int
+	refilling bool
+	closed    bool
+	// released is closed and replaced whenever capacity frees up, waking blocked Acquire calls.
+	released chan struct{}
+	stats    PoolStats
+}
+
+type pooledSession struct {
+	session Session
+	uses    int
+}
+
+// NewSessionPool creates a pool and starts its MinSize warm sessions before returning.
+func (s *Service) NewSessionPool(ctx context.Context, opts SessionPoolOptions) (*SessionPool, error) {
+	if opts.MinSize < 0 || opts.MaxSize < 0 || opts.MaxUses < 0 || opts.HealthCheckTimeoutSeconds < 0 {
+		return nil, fmt.Errorf("pool sizes, maxUses and healthCheckTimeoutSeconds must be >= 0")
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = max(opts.MinSize, 1)
+	}
+	if opts.MinSize > opts.MaxSize {
+		return nil, fmt.Errorf("pool minSize %d exceeds maxSize %d", opts.MinSize, opts.MaxSize)
+	}
+	if opts.HealthCheck == "" {
+		opts.HealthCheck = "true"
+	}
+	if opts.HealthCheckTimeoutSeconds == 0 {
+		opts.HealthCheckTimeoutSeconds = defaultHealthCheckTimeoutSeconds
+	}
+	opts.Env = cloneMap(opts.Env)
+
+	p := &SessionPool{
+		svc:      s,
+		opts:     opts,
+		inUse:    map[string]*pooledSession{},
+		released: make(chan struct{}),
+	}
+	for i := 0; i < opts.MinSize; i++ {
+		p.mu.Lock()
+		p.starting++
+		p.mu.Unlock()
+		ps, err := p.startSession(ctx)
+		p.mu.Lock()
+		p.starting--
+		if err == nil {
+			p.idle = append(p.idle, ps)
+		}
+		p.mu.Unlock()
+		if err != nil {
+			_ = p.Close(context.WithoutCancel(ctx))
+			return nil, fmt.Errorf("warm session pool: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Acquire hands out a warm session, starting a new one if none is idle and the
+// pool is below MaxSize. At MaxSize it blocks until a session is released or ctx is done.
+func (p *SessionPool) Acquire(ctx context.Context) (Session, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return Session{}, fmt.Errorf("session pool is closed")
+		}
+		if n := len(p.idle); n > 0 {
+			ps := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			// Idle sessions can expire or be stopped behind the pool's back.
+			if current, err := p.svc.GetSession(ctx, ps.session.ID); err != nil || current.State != SessionStateActive {
+				p.mu.Lock()
+				p.returning++
+				p.mu.Unlock()
+				p.replace(ps, "session is no longer active")
+				p.doneReturning(nil)
+				p.refill()
+				continue
+			}
+			p.handOut(ps)
+			return ps.session, nil
+		}
+		if p.sizeLocked() < p.opts.MaxSize {
+			p.starting++
+			p.mu.Unlock()
+			ps, err := p.startSession(ctx)
+			p.mu.Lock()
+			p.starting--
+			if err != nil {
+				p.notifyLocked()
+				p.mu.Unlock()
+				return Session{}, err
+			}
+			p.mu.Unlock()
+			p.handOut(ps)
+			return ps.session, nil
+		}
+		p.waiting++
+		released := p.released
+		p.mu.Unlock()
+
+		select {
+		case <-released:
+			p.mu.Lock()
+			p.waiting--
+			p.mu.Unlock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.waiting--
+			p.mu.Unlock()
+			return Session{}, ctx.Err()
+		}
+	}
+}
+
+// Release returns an acquired session to the pool. The session is health-checked
+// and reused, or stopped and replaced when it failed the check or reached MaxUses.
+func (p *SessionPool) Release(ctx context.Context, sessionID string) error {
+	ps, err := p.takeInUse(sessionID)
+	if err != nil {
+		return err
+	}
+	ps.uses++
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		err := p.svc.StopSession(ctx, StopSessionRequest{SessionID: sessionID})
+		p.doneReturning(nil)
+		return err
+	}
+	reason := ""
+	if p.opts.MaxUses > 0 && ps.uses >= p.opts.MaxUses {
+		reason = "max uses reached"
+	} else if err := p.healthCheck(ctx, sessionID); err != nil {
+		reason = fmt.Sprintf("health check failed: %v", err)
+	}
+	if reason != "" {
+		p.replace(ps, reason)
+		p.doneReturning(nil)
+		p.refill()
+		return nil
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		err := p.svc.StopSession(ctx, StopSessionRequest{SessionID: sessionID})
+		p.doneReturning(nil)
+		return err
+	}
+	p.mu.Unlock()
+	p.doneReturning(ps)
+	return nil
+}
+
+// Discard stops an acquired session instead of returning it, for example after
+// a command left it in an unknown state, and starts a replacement if needed.
+func (p *SessionPool) Discard(ctx context.Context, sessionID string) error {
+	_ = ctx
+	ps, err := p.takeInUse(sessionID)
+	if err != nil {
+		return err
+	}
+	p.replace(ps, "discarded")
+	p.doneReturning(nil)
+	p.refill()
+	return nil
+}
+
+// Stats returns the current pool state and cumulative counters.
+func (p *SessionPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	stats.InUse = len(p.inUse)
+	stats.Starting = p.starting
+	stats.Waiting = p.waiting
+	return stats
+}
+
+// Close stops idle and acquired sessions. Sessions released afterwards are stopped
+// as well, and Acquire fails.
+func (p *SessionPool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	sessions := make([]*pooledSession, 0, len(p.idle)+len(p.inUse))
+	sessions = append(sessions, p.idle...)
+	for _, ps := range p.inUse {
+		sessions = append(sessions, ps)
+	}
+	p.idle = nil
+	p.notifyLocked()
+	p.mu.Unlock()
+
+	var errs []error
+	for _, ps := range sessions {
+		if err := p.svc.StopSession(ctx, StopSessionRequest{SessionID: ps.session.ID}); err != nil {
+			errs = append(errs, fmt.Errorf("stop session %s: %w", ps.session.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *SessionPool) startSession(ctx context.Context) (*pooledSession, error) {
+	session, err := p.svc.StartSession(ctx, StartSessionRequest{
+		ProjectRoot:      p.opts.ProjectRoot,
+		ProviderOverride: p.opts.ProviderOverride,
+		Cwd:              p.opts.Cwd,
+		Env:              p.opts.Env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stats.Created++
+	p.mu.Unlock()
+	emit(p.opts.OnEvent, Event{Kind: "pool.session.created", Message: "pooled session started", SessionID: session.ID})
+	return &pooledSession{session: session}, nil
+}
+
+func (p *SessionPool) handOut(ps *pooledSession) {
+	p.mu.Lock()
+	p.inUse[ps.session.ID] = ps
+	p.stats.Acquired++
+	p.mu.Unlock()
+	p.refill()
+}
+
+func (p *SessionPool) takeInUse(sessionID string) (*pooledSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps, ok := p.inUse[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("session is not acquired from this pool: %s", sessionID)
+	}
+	delete(p.inUse, sessionID)
+	p.returning++
+	return ps, nil
+}
+
+// doneReturning ends a Release or Discard, putting ps back to idle when it is reusable.
+func (p *SessionPool) doneReturning(ps *pooledSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.returning--
+	if ps != nil {
+		p.idle = append(p.idle, ps)
+	}
+	p.notifyLocked()
+}
+
+// sizeLocked counts every session the pool owns. Callers hold p.mu.
+func (p *SessionPool) sizeLocked() int {
+	return len(p.idle) + len(p.inUse) + p.starting + p.returning
+}
+
+func (p *SessionPool) healthCheck(ctx context.Context, sessionID string) error {
+	result, err := p.svc.ExecInSession(ctx, ExecInSessionRequest{
+		SessionID:      sessionID,
+		Command:        p.opts.HealthCheck,
+		TimeoutSeconds: p.opts.HealthCheckTimeoutSeconds,
+	})
+	if err != nil {
+		return err
+	}
+	if result.TimedOut {
+		return fmt.Errorf("timed out")
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("exit code %d", result.ExitCode)
+	}
+	return nil
+}
+
+// replace stops a session that left the pool. Callers refill the pool afterwards.
+func (p *SessionPool) replace(ps *pooledSession, reason string) {
+	err := p.svc.StopSession(context.Background(), StopSessionRequest{SessionID: ps.session.ID})
+	p.mu.Lock()
+	p.stats.Replaced++
+	p.notifyLocked()
+	p.mu.Unlock()
+	emit(p.opts.OnEvent, Event{Kind: "pool.session.replaced", Message: reason, SessionID: ps.session.ID, Err: err})
+}
+
+// refill starts sessions in the background until MinSize sessions are idle.
+func (p *SessionPool) refill() {
+	p.mu.Lock()
+	if p.refilling || p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.refilling = true
+	p.mu.Unlock()
+
+	go func() {
+		for {
+			p.mu.Lock()
+			if p.closed || len(p.idle)+p.starting >= p.opts.MinSize || p.sizeLocked() >= p.opts.MaxSize {
+				p.refilling = false
+				p.mu.Unlock()
+				return
+			}
+			p.starting++
+			p.mu.Unlock()
+
+			ps, err := p.startSession(context.Background())
+			p.mu.Lock()
+			p.starting--
+			if err != nil {
+				p.refilling = false
+				p.notifyLocked()
+				p.mu.Unlock()
+				emit(p.opts.OnEvent, Event{Kind: "pool.refill.failed", Message: "failed to start pooled session", Err: err})
+				return
+			}
+			if p.closed {
+				p.mu.Unlock()
+				_ = p.svc.StopSession(context.Background(), StopSessionRequest{SessionID: ps.session.ID})
+				continue
+			}
+			p.idle = append(p.idle, ps)
+			p.notifyLocked()
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// notifyLocked wakes blocked Acquire calls. Callers hold p.mu.
+func (p *SessionPool) notifyLocked() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
@@ -0,0 +1,301 @@
+package vibebox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"vibebox/internal/backend"
+)
+
+const (
+	// processStopTimeout bounds how long StopSession waits for killed processes to be reaped.
+	processStopTimeout = 5 * time.Second
+	// collectedProcessRetention is how long an exited process stays visible after
+	// WaitProcess returned its result, so its logs can still be read.
+	collectedProcessRetention = time.Minute
+)
+
+// managedProcess tracks one background process and its retained output.
+type managedProcess struct {
+	mu     sync.Mutex
+	info   Process
+	stdout *ringBuffer
+	stderr *ringBuffer
+	done   chan struct{}
+	// collectedAt is when WaitProcess first returned the final state; zero before.
+	collectedAt time.Time
+	backend     backend.ProcessBackend
+	record      *managedSession
+	handle      backend.ProcessHandle
+}
+
+// SpawnInSession starts a command in the background within an existing session.
+// It returns once the process is running; use WaitProcess to wait for it to exit.
+func (s *Service) SpawnInSession(ctx context.Context, req SpawnInSessionRequest) (Process, error) {
+	if err := validateCommand(req.Command, req.Args); err != nil {
+		return Process{}, err
+	}
+	if req.LogLimitBytes < 0 {
+		return Process{}, fmt.Errorf("logLimitBytes must be >= 0")
+	}
+	record, err := s.activeSession(req.SessionID)
+	if err != nil {
+		return Process{}, err
+	}
+	pb, ok := record.sessionBackend.(backend.ProcessBackend)
+	if !ok {
+		return Process{}, fmt.Errorf("%s backend does not support background processes", record.backend.Name())
+	}
+
+	s.touchSession(record)
+	id, err := newProcessID()
+	if err != nil {
+		return Process{}, err
+	}
+	limit := req.LogLimitBytes
+	if limit == 0 {
+		limit = DefaultProcessLogLimit
+	}
+	proc := &managedProcess{
+		info: Process{
+			ID:        id,
+			SessionID: req.SessionID,
+			Command:   req.Command,
+			Args:      cloneArgs(req.Args),
+			State:     ProcessStateRunning,
+			StartedAt: time.Now().UTC(),
+		},
+		stdout:  newRingBuffer(limit),
+		stderr:  newRingBuffer(limit),
+		done:    make(chan struct{}),
+		backend: pb,
+		record:  record,
+	}
+
+	stdout, stderr := outputStreams(req.OnEvent, Event{Kind: "process.output", ProcessID: id},
+		&logWriter{proc: proc, ring: proc.stdout, live: req.Stdout},
+		&logWriter{proc: proc, ring: proc.stderr, live: req.Stderr})
+	handle, err := pb.SpawnInSession(ctx, record.spec, record.handle, backend.ExecRequest{
+		ExecID:  id,
+		Command: req.Command,
+		Args:    req.Args,
+		Cwd:     req.Cwd,
+		Env:     req.Env,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	})
+	if err != nil {
+		return Process{}, err
+	}
+	proc.handle = handle
+
+	s.mu.Lock()
+	s.pruneProcessesLocked(time.Now())
+	s.processes[id] = proc
+	s.mu.Unlock()
+
+	emit(req.OnEvent, Event{Kind: "process.started", Message: "process started", ProcessID: id})
+	go proc.watch(req.OnEvent)
+	return proc.snapshot(), nil
+}
+
+// WaitProcess blocks until the process exits or ctx is done and returns its final state.
+func (s *Service) WaitProcess(ctx context.Context, processID string) (Process, error) {
+	proc, err := s.lookupProcess(processID)
+	if err != nil {
+		return Process{}, err
+	}
+	select {
+	case <-proc.done:
+		proc.mu.Lock()
+		if proc.collectedAt.IsZero() {
+			proc.collectedAt = time.Now()
+		}
+		proc.mu.Unlock()
+		return proc.snapshot(), nil
+	case <-ctx.Done():
+		return Process{}, ctx.Err()
+	}
+}
+
+// SignalProcess delivers a signal such as "TERM", "INT" or "KILL" to a background
+// process and everything it started. Signalling an exited process is a no-op.
+func (s *Service) SignalProcess(ctx context.Context, processID string, signal string) error {
+	name, err := backend.NormalizeSignal(signal)
+	if err != nil {
+		return err
+	}
+	proc, err := s.lookupProcess(processID)
+	if err != nil {
+		return err
+	}
+	return proc.backend.SignalProcess(ctx, proc.record.spec, proc.record.handle, proc.handle, name)
+}
+
+// ProcessLogs returns the retained stdout and stderr of a background process.
+func (s *Service) ProcessLogs(_ context.Context, processID string) (ProcessLogs, error) {
+	proc, err := s.lookupProcess(processID)
+	if err != nil {
+		return ProcessLogs{}, err
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	return ProcessLogs{
+		Stdout:        string(proc.stdout.Bytes()),
+		Stderr:        string(proc.stderr.Bytes()),
+		StdoutDropped: proc.stdout.Dropped(),
+		StderrDropped: proc.stderr.Dropped(),
+	}, nil
+}
+
+// ListProcesses returns the background processes of a session ordered by start time,
+// including ones that have exited, until collectedProcessRetention after WaitProcess
+// returned their result.
+func (s *Service) ListProcesses(_ context.Context, sessionID string) ([]Process, error) {
+	s.mu.Lock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	s.pruneProcessesLocked(time.Now())
+	procs := make([]*managedProcess, 0, len(s.processes))
+	for _, proc := range s.processes {
+		if proc.info.SessionID == sessionID {
+			procs = append(procs, proc)
+		}
+	}
+	s.mu.Unlock()
+
+	out := make([]Process, 0, len(procs))
+	for _, proc := range procs {
+		out = append(out, proc.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].StartedAt.Before(out[j].StartedAt)
+	})
+	return out, nil
+}
+
+// stopProcesses kills the running background processes of a session and waits
+// until they are reaped, bounded by processStopTimeout.
+func (s *Service) stopProcesses(ctx context.Context, sessionID string) {
+	s.mu.RLock()
+	var running []*managedProcess
+	for _, proc := range s.processes {
+		if proc.info.SessionID == sessionID && proc.snapshot().State == ProcessStateRunning {
+			running = append(running, proc)
+		}
+	}
+	s.mu.RUnlock()
+	if len(running) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, processStopTimeout)
+	defer cancel()
+	for _, proc := range running {
+		_ = proc.backend.SignalProcess(ctx, proc.record.spec, proc.record.handle, proc.handle, "KILL")
+	}
+	for _, proc := range running {
+		select {
+		case <-proc.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// forgetProcesses drops every process of a stopped session.
+func (s *Service) forgetProcesses(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, proc := range s.processes {
+		if proc.info.SessionID == sessionID {
+			delete(s.processes, id)
+		}
+	}
+}
+
+// pruneProcessesLocked drops exited processes whose result was collected more
+// than collectedProcessRetention before now. Callers hold s.mu.
+func (s *Service) pruneProcessesLocked(now time.Time) {
+	for id, proc := range s.processes {
+		proc.mu.Lock()
+		collected := proc.collectedAt
+		proc.mu.Unlock()
+		if !collected.IsZero() && now.Sub(collected) >= collectedProcessRetention {
+			delete(s.processes, id)
+		}
+	}
+}
+
+func (s *Service) lookupProcess(processID string) (*managedProcess, error) {
+	s.mu.RLock()
+	proc, ok := s.processes[processID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProcessNotFound, processID)
+	}
+	return proc, nil
+}
+
+// watch waits for the backend process to exit and records its final state.
+func (p *managedProcess) watch(handler EventHandler) {
+	exit, err := p.backend.WaitProcess(context.Background(), p.record.spec, p.record.handle, p.handle)
+
+	p.mu.Lock()
+	p.info.State = ProcessStateExited
+	p.info.ExitCode = exit.ExitCode
+	p.info.Signal = exit.Signal
+	if err != nil {
+		p.info.Error = err.Error()
+	}
+	p.info.ExitedAt = time.Now().UTC()
+	p.mu.Unlock()
+	close(p.done)
+
+	message := fmt.Sprintf("process exited with code %d", exit.ExitCode)
+	if exit.Signal != "" {
+		message = fmt.Sprintf("process terminated by signal %s", exit.Signal)
+	}
+	emit(handler, Event{Kind: "process.exited", Message: message, ProcessID: p.info.ID, Err: err, Done: true})
+}
+
+func (p *managedProcess) snapshot() Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info
+}
+
+// logWriter appends process output to a ring buffer and forwards it to an optional live writer.
+type logWriter struct {
+	proc *managedProcess
+	ring *ringBuffer
+	live io.Writer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.proc.mu.Lock()
+	_, _ = w.ring.Write(p)
+	w.proc.mu.Unlock()
+	if w.live != nil {
+		if _, err := w.live.Write(p); err != nil {
+			w.live = nil
+		}
+	}
+	return len(p), nil
+}
+
+func newProcessID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "p_" + hex.EncodeToString(buf), nil
+}
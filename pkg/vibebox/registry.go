@@ -0,0 +1,372 @@
+package vibebox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"vibebox/internal/backend"
+	"vibebox/internal/config"
+)
+
+var sessionIDPattern = regexp.MustCompile(`^s_[0-9a-f]+$`)
+
+// defaultSessionsDir locates the registry of Services created without
+// WithStateDir. Tests point it at a temporary directory.
+var defaultSessionsDir = config.UserSessionsDir
+
+// activityPersistInterval bounds how often session activity is written to the
+// registry. Records of exited owners get this much slack on IdleTimeout.
+const activityPersistInterval = 30 * time.Second
+
+// sessionRecord is the persisted form of one session, written when the session
+// starts and removed when it is stopped.
+type sessionRecord struct {
+	ID          string                       `json:"id"`
+	Provider    Provider                     `json:"provider"`
+	ProjectRoot string                       `json:"projectRoot"`
+	Cwd         string                       `json:"cwd,omitempty"`
+	Env         map[string]string            `json:"env,omitempty"`
+	CreatedAt   time.Time                    `json:"createdAt"`
+	IdleTimeout time.Duration                `json:"idleTimeout,omitempty"`
+	MaxLifetime time.Duration                `json:"maxLifetime,omitempty"`
+	Stateful    bool                         `json:"stateful,omitempty"`
+	Diagnostics map[string]BackendDiagnostic `json:"diagnostics,omitempty"`
+	// Handle is the backend's SessionPersister encoding of its session handle.
+	Handle json.RawMessage `json:"handle,omitempty"`
+	// OwnerPID is the process whose Service manages the session. Once it has
+	// exited, the record's limits and sandbox are checked whenever it is read.
+	OwnerPID       int       `json:"ownerPid,omitempty"`
+	LastActivityAt time.Time `json:"lastActivityAt,omitempty"`
+}
+
+// ListSessions returns sessions managed by this Service together with sessions
+// recorded in the registry by other processes, ordered by creation time.
+// Sessions not managed by this Service have Attached set to false. Records left
+// by exited processes are stopped when past their IdleTimeout or MaxLifetime
+// and reported as expired, or reported as stale when their sandbox is gone;
+// either way they are removed from the registry.
+func (s *Service) ListSessions(ctx context.Context) ([]Session, error) {
+	records, err := s.loadSessionRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	out := make([]Session, 0, len(s.sessions)+len(records))
+	for _, record := range s.sessions {
+		out = append(out, cloneSession(record.session))
+	}
+	var detached []sessionRecord
+	for _, rec := range records {
+		if _, ok := s.sessions[rec.ID]; !ok {
+			detached = append(detached, rec)
+		}
+	}
+	s.mu.RUnlock()
+	for _, rec := range detached {
+		out = append(out, s.checkRecord(ctx, rec))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+// AttachSession takes over a session recorded in the registry, typically one
+// started by a previous process, so it can be used with ExecInSession and the
+// other session APIs. Attaching a session this Service already manages returns it unchanged.
+// Sessions whose owning process is still running cannot be attached and report
+// ErrSessionNotActive.
+func (s *Service) AttachSession(ctx context.Context, sessionID string) (Session, error) {
+	if s.isClosed() {
+		return Session{}, fmt.Errorf("service is closed")
+	}
+	s.mu.RLock()
+	existing, ok := s.sessions[sessionID]
+	active := ok && existing.session.State == SessionStateActive
+	var session Session
+	if active {
+		session = cloneSession(existing.session)
+	}
+	s.mu.RUnlock()
+	if active {
+		return session, nil
+	}
+
+	rec, err := s.loadSessionRecord(sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	if rec.ownerAlive() {
+		return Session{}, fmt.Errorf("%w: %s is managed by process %d", ErrSessionNotActive, sessionID, rec.OwnerPID)
+	}
+	if reason := rec.expiry(time.Now()); reason != "" {
+		_ = s.stopDetachedSession(ctx, StopSessionRequest{SessionID: sessionID})
+		return Session{}, fmt.Errorf("%w: %s expired after %s", ErrSessionNotActive, sessionID, reason)
+	}
+	record, err := s.resumeSession(ctx, rec)
+	if err != nil {
+		return Session{}, fmt.Errorf("attach session %s: %w", sessionID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.sessions[sessionID]; ok && current.session.State == SessionStateActive {
+		return cloneSession(current.session), nil
+	}
+	// Take ownership, so the record is no longer treated as left behind.
+	if err := s.persistSession(record); err != nil {
+		return Session{}, fmt.Errorf("attach session %s: %w", sessionID, err)
+	}
+	s.sessions[sessionID] = record
+	s.ensureReaper(record)
+	return cloneSession(record.session), nil
+}
+
+// resumeSession rebuilds a managed session from its registry record.
+func (s *Service) resumeSession(ctx context.Context, rec sessionRecord) (*managedSession, error) {
+	projectRoot, cfg, baseRaw, err := s.resolveProjectRuntime(rec.ProjectRoot, rec.Provider, false)
+	if err != nil {
+		return nil, err
+	}
+	be, err := s.backendForProvider(rec.Provider)
+	if err != nil {
+		return nil, err
+	}
+	sb, ok := be.(backend.SessionBackend)
+	if !ok {
+		return nil, fmt.Errorf("%s backend does not support sessions", be.Name())
+	}
+	persister, ok := be.(backend.SessionPersister)
+	if !ok || len(rec.Handle) == 0 {
+		return nil, fmt.Errorf("%s backend does not support reattaching sessions", be.Name())
+	}
+
+	spec := newRuntimeSpec(projectRoot, cfg, baseRaw, backend.IOStreams{})
+	handle, err := persister.ResumeSession(ctx, spec, rec.Handle)
+	if err != nil {
+		return nil, err
+	}
+	session := rec.session()
+	session.LastActivityAt = time.Now().UTC()
+	session.Attached = true
+	return &managedSession{
+		session:        session,
+		backend:        be,
+		sessionBackend: sb,
+		handle:         handle,
+		spec:           spec,
+		defaultCwd:     rec.Cwd,
+		defaultEnv:     cloneMap(rec.Env),
+	}, nil
+}
+
+// checkRecord reports a session recorded by another Service. Records whose
+// owner has exited are expired or marked stale as described in ListSessions.
+func (s *Service) checkRecord(ctx context.Context, rec sessionRecord) Session {
+	session := rec.session()
+	if rec.ownerAlive() {
+		return session
+	}
+	if rec.expiry(time.Now()) != "" {
+		if err := s.stopDetachedSession(ctx, StopSessionRequest{SessionID: rec.ID}); err == nil {
+			session.State = SessionStateExpired
+		}
+		return session
+	}
+	if s.sandboxGone(ctx, rec) && s.deleteSessionRecord(rec.ID) == nil {
+		session.State = SessionStateStale
+	}
+	return session
+}
+
+// sandboxGone reports whether the backend knows the sandbox of rec no longer
+// exists. Backends that cannot tell, or cannot be reached, report false.
+func (s *Service) sandboxGone(ctx context.Context, rec sessionRecord) bool {
+	be, err := s.backendForProvider(rec.Provider)
+	if err != nil {
+		return false
+	}
+	prober, ok := be.(backend.SessionProber)
+	if !ok || len(rec.Handle) == 0 {
+		return false
+	}
+	projectRoot, cfg, baseRaw, err := s.resolveProjectRuntime(rec.ProjectRoot, rec.Provider, false)
+	if err != nil {
+		return false
+	}
+	spec := newRuntimeSpec(projectRoot, cfg, baseRaw, backend.IOStreams{})
+	return errors.Is(prober.ProbeSession(ctx, spec, rec.Handle), backend.ErrSessionGone)
+}
+
+// ownerAlive reports whether the process that manages rec is still running.
+// Records written before owners were tracked count as left behind.
+func (rec sessionRecord) ownerAlive() bool {
+	if rec.OwnerPID <= 0 {
+		return false
+	}
+	err := syscall.Kill(rec.OwnerPID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// expiry returns why rec is past its limits at now, or "" if it is not.
+func (rec sessionRecord) expiry(now time.Time) string {
+	if rec.MaxLifetime > 0 && now.Sub(rec.CreatedAt) >= rec.MaxLifetime {
+		return "max lifetime"
+	}
+	last := rec.LastActivityAt
+	if last.IsZero() {
+		last = rec.CreatedAt
+	}
+	if rec.IdleTimeout > 0 && now.Sub(last) >= rec.IdleTimeout+activityPersistInterval {
+		return "idle timeout"
+	}
+	return ""
+}
+
+// persistSession writes the registry record of a session this Service manages.
+func (s *Service) persistSession(record *managedSession) error {
+	record.activityPersistedAt = time.Now()
+	rec := sessionRecord{
+		ID:          record.session.ID,
+		Provider:    record.session.Selected,
+		ProjectRoot: record.spec.ProjectRoot,
+		Cwd:         record.defaultCwd,
+		Env:         record.defaultEnv,
+		CreatedAt:   record.session.CreatedAt,
+		IdleTimeout: record.session.IdleTimeout,
+		MaxLifetime: record.session.MaxLifetime,
+		Stateful:    record.session.Stateful,
+		Diagnostics: record.session.Diagnostics,
+
+		OwnerPID:       os.Getpid(),
+		LastActivityAt: record.session.LastActivityAt,
+	}
+	if persister, ok := record.backend.(backend.SessionPersister); ok && record.sessionBackend != nil {
+		data, err := persister.MarshalSession(record.handle)
+		if err != nil {
+			return err
+		}
+		rec.Handle = data
+	}
+	return s.saveSessionRecord(rec)
+}
+
+func (rec sessionRecord) session() Session {
+	return Session{
+		ID:          rec.ID,
+		Selected:    rec.Provider,
+		Diagnostics: cloneDiagnostics(rec.Diagnostics),
+		CreatedAt:   rec.CreatedAt,
+		State:       SessionStateActive,
+		ProjectRoot: rec.ProjectRoot,
+		IdleTimeout: rec.IdleTimeout,
+		MaxLifetime: rec.MaxLifetime,
+		Stateful:    rec.Stateful,
+	}
+}
+
+func (s *Service) sessionsDir() (string, error) {
+	if s.stateDir != "" {
+		return filepath.Join(s.stateDir, "sessions"), nil
+	}
+	return defaultSessionsDir()
+}
+
+func (s *Service) sessionRecordPath(sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	dir, err := s.sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionID+".json"), nil
+}
+
+func (s *Service) saveSessionRecord(rec sessionRecord) error {
+	path, err := s.sessionRecordPath(rec.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	payload, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, payload, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Service) loadSessionRecord(sessionID string) (sessionRecord, error) {
+	path, err := s.sessionRecordPath(sessionID)
+	if err != nil {
+		return sessionRecord{}, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return sessionRecord{}, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+		}
+		return sessionRecord{}, err
+	}
+	var rec sessionRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return sessionRecord{}, fmt.Errorf("decode session record %s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func (s *Service) loadSessionRecords() ([]sessionRecord, error) {
+	dir, err := s.sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	records := make([]sessionRecord, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		rec, err := s.loadSessionRecord(id)
+		if err != nil {
+			// Records removed or corrupted concurrently are skipped rather than failing the listing.
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func (s *Service) deleteSessionRecord(sessionID string) error {
+	path, err := s.sessionRecordPath(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package vibebox
+
+// ringBuffer keeps the most recent bytes written to it, up to a fixed size.
+// It is not safe for concurrent use.
+type ringBuffer struct {
+	buf     []byte
+	start   int
+	size    int
+	dropped int64
+}
+
+func newRingBuffer(limit int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, limit)}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	limit := len(r.buf)
+	if limit == 0 {
+		r.dropped += int64(n)
+		return n, nil
+	}
+	if len(p) > limit {
+		r.dropped += int64(len(p) - limit)
+		p = p[len(p)-limit:]
+	}
+	if overflow := r.size + len(p) - limit; overflow > 0 {
+		r.start = (r.start + overflow) % limit
+		r.size -= overflow
+		r.dropped += int64(overflow)
+	}
+	end := (r.start + r.size) % limit
+	copied := copy(r.buf[end:], p)
+	copy(r.buf, p[copied:])
+	r.size += len(p)
+	return n, nil
+}
+
+// Bytes returns a copy of the retained bytes in write order.
+func (r *ringBuffer) Bytes() []byte {
+	out := make([]byte, r.size)
+	copied := copy(out, r.buf[r.start:min(r.start+r.size, len(r.buf))])
+	copy(out[copied:], r.buf[:r.size-copied])
+	return out
+}
+
+// Dropped reports how many bytes were discarded to stay within the limit.
+func (r *ringBuffer) Dropped() int64 {
+	return r.dropped
+}
@@ -6,16 +6,16 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"vibebox/internal/backend"
-	dockerbackend "vibebox/internal/backend/docker"
-	macosbackend "vibebox/internal/backend/macos"
-	offbackend "vibebox/internal/backend/off"
+	"vibebox/internal/backend/builtin"
 	"vibebox/internal/config"
 	"vibebox/internal/image"
 	"vibebox/internal/progress"
@@ -23,8 +23,17 @@ import (
 
 // Service is the public application-layer entrypoint for embedding vibebox.
 type Service struct {
-	mu       sync.RWMutex
-	sessions map[string]*managedSession
+	mu        sync.RWMutex
+	sessions  map[string]*managedSession
+	execs     map[string]*runningExec
+	processes map[string]*managedProcess
+	stateDir  string
+	backends  *backend.Registry
+	probes    *backend.ProbeCache
+	closed    bool
+
+	reaperStop chan struct{}
+	reaperDone chan struct{}
 }
 
 type managedSession struct {
@@ -35,13 +44,52 @@ type managedSession struct {
 	spec           backend.RuntimeSpec
 	defaultCwd     string
 	defaultEnv     map[string]string
+	// activityPersistedAt is when the registry record was last written.
+	activityPersistedAt time.Time
+	// onEvent receives lifecycle events emitted outside a request, such as `session.expired`.
+	onEvent EventHandler
 }
 
-// NewService creates a new application service.
-func NewService() *Service {
-	return &Service{
-		sessions: map[string]*managedSession{},
+// DefaultProbeCacheTTL is how long backend probe results are reused.
+const DefaultProbeCacheTTL = 30 * time.Second
+
+// Option customizes a Service created by NewService.
+type Option func(*Service) error
+
+// WithStateDir stores persistent service state, such as the session registry,
+// under dir instead of the user config directory.
+func WithStateDir(dir string) Option {
+	return func(s *Service) error {
+		s.stateDir = dir
+		return nil
+	}
+}
+
+// WithProbeCacheTTL changes how long backend probe results are reused; ttl <= 0
+// probes on every call.
+func WithProbeCacheTTL(ttl time.Duration) Option {
+	return func(s *Service) error {
+		s.probes = backend.NewProbeCache(ttl)
+		return nil
+	}
+}
+
+// NewService creates a new application service. It returns the first error
+// reported by opts.
+func NewService(opts ...Option) (*Service, error) {
+	s := &Service{
+		sessions:  map[string]*managedSession{},
+		execs:     map[string]*runningExec{},
+		processes: map[string]*managedProcess{},
+		backends:  builtin.Registry(),
+		probes:    backend.NewProbeCache(DefaultProbeCacheTTL),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
 	}
+	return s, nil
 }
 
 // ListImages returns official white-listed images for the provided architecture.
@@ -82,7 +130,7 @@ func (s *Service) Initialize(ctx context.Context, req InitializeRequest) (Initia
 		return InitializeResult{}, fmt.Errorf("image %s is for arch=%s, host arch=%s", desc.ID, desc.Arch, runtime.GOARCH)
 	}
 
-	provider, err := normalizeProvider(req.Provider)
+	provider, err := s.normalizeProvider(req.Provider)
 	if err != nil {
 		return InitializeResult{}, err
 	}
@@ -126,18 +174,25 @@ func (s *Service) Initialize(ctx context.Context, req InitializeRequest) (Initia
 		cfg.VM.DiskGB = req.DiskGB
 	}
 	cfg.VM.ProvisionScript = req.ProvisionScript
+	cfg.Docker.CPUs = req.DockerCPUs
+	cfg.Docker.MemoryMB = req.DockerMemoryMB
+	cfg.Docker.PidsLimit = req.DockerPidsLimit
+	cfg.Docker.ShmSizeMB = req.DockerShmSizeMB
+	for _, u := range req.DockerUlimits {
+		cfg.Docker.Ulimits = append(cfg.Docker.Ulimits, config.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
 	if req.NoDefaultMounts {
 		cfg.Mounts = nil
 	}
 	if len(req.Mounts) > 0 {
 		cfg.Mounts = append(cfg.Mounts, toInternalMounts(req.Mounts)...)
 	}
-	if err := cfg.Validate(); err != nil {
+	if err := cfg.Validate(s.backends.Providers()...); err != nil {
 		return InitializeResult{}, err
 	}
 
 	configPath := config.ProjectConfigPath(projectRoot)
-	if err := config.Save(configPath, cfg); err != nil {
+	if err := config.Save(configPath, cfg, s.backends.Providers()...); err != nil {
 		return InitializeResult{}, err
 	}
 
@@ -151,27 +206,66 @@ func (s *Service) Initialize(ctx context.Context, req InitializeRequest) (Initia
 	return result, nil
 }
 
-// Probe evaluates backend availability and provider selection.
+// Probe evaluates backend availability and provider selection with the default
+// auto strategy. Use ProbeProject to apply a project's auto settings.
 func (s *Service) Probe(ctx context.Context, provider Provider) (ProbeResult, error) {
-	normalized, err := normalizeProvider(provider)
+	return s.probe(ctx, provider, config.AutoConfig{})
+}
+
+// ProbeProject evaluates provider selection as Exec would for req.ProjectRoot,
+// honoring the project's auto order and allow_off settings. Available backends
+// also check the project configuration, see BackendDiagnostic.ConfigError.
+func (s *Service) ProbeProject(ctx context.Context, req ProbeRequest) (ProbeResult, error) {
+	_, cfg, _, err := s.resolveProjectRuntime(req.ProjectRoot, req.Provider, false)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	result, err := s.probe(ctx, req.Provider, cfg.Auto)
+	for name, d := range result.Diagnostics {
+		b, ok := s.backends.Lookup(name)
+		if !ok || !d.Available {
+			continue
+		}
+		if checker, ok := b.(backend.ConfigChecker); ok {
+			if checkErr := checker.CheckConfig(ctx, cfg); checkErr != nil {
+				d.ConfigError = checkErr.Error()
+				result.Diagnostics[name] = d
+			}
+		}
+	}
+	return result, err
+}
+
+// InvalidateProbeCache forgets cached backend probe results, for example after
+// the user started Docker, so the next call probes again.
+func (s *Service) InvalidateProbeCache() {
+	s.probes.Invalidate()
+}
+
+func (s *Service) probe(ctx context.Context, provider Provider, auto config.AutoConfig) (ProbeResult, error) {
+	normalized, err := s.normalizeProvider(provider)
 	if err != nil {
 		return ProbeResult{}, err
 	}
 
-	off := offbackend.New()
-	appleVM := macosbackend.New()
-	docker := dockerbackend.New()
-	selection, selErr := backend.Select(ctx, toInternalProvider(normalized), off, appleVM, docker)
+	selection, selErr := backend.Select(ctx, toInternalProvider(normalized), s.backends, backend.SelectOptions{
+		Auto:     auto,
+		Cache:    s.probes,
+		ProbeAll: true,
+	})
+	diagnostics, skipped := selection.Diagnostics, selection.Skipped
+	var unavailable *backend.UnavailableError
+	if errors.As(selErr, &unavailable) {
+		diagnostics, skipped = unavailable.Diagnostics, unavailable.Skipped
+	}
 
 	result := ProbeResult{
-		Diagnostics: map[string]BackendDiagnostic{},
+		Diagnostics: toPublicDiagnostics(diagnostics),
+		Skipped:     toPublicSkipped(skipped),
 	}
-	result.Diagnostics[off.Name()] = fromInternalDiag(off.Probe(ctx))
-	result.Diagnostics[appleVM.Name()] = fromInternalDiag(appleVM.Probe(ctx))
-	result.Diagnostics[docker.Name()] = fromInternalDiag(docker.Probe(ctx))
 
 	if selErr != nil {
-		return result, selErr
+		return result, selectionError(selErr)
 	}
 
 	result.Selected = Provider(selection.Provider)
@@ -187,21 +281,17 @@ func (s *Service) Start(ctx context.Context, req StartRequest) (StartResult, err
 		return StartResult{}, err
 	}
 
-	off := offbackend.New()
-	appleVM := macosbackend.New()
-	docker := dockerbackend.New()
-
 	provider := Provider(cfg.Provider)
 	if req.ProviderOverride != "" {
-		provider, err = normalizeProvider(req.ProviderOverride)
+		provider, err = s.normalizeProvider(req.ProviderOverride)
 		if err != nil {
 			return StartResult{}, err
 		}
 	}
 
-	selection, err := backend.Select(ctx, toInternalProvider(provider), off, appleVM, docker)
+	selection, err := backend.Select(ctx, toInternalProvider(provider), s.backends, backend.SelectOptions{Auto: cfg.Auto, Cache: s.probes})
 	if err != nil {
-		return StartResult{}, err
+		return StartResult{}, selectionError(err)
 	}
 
 	result := StartResult{
@@ -245,8 +335,12 @@ func (s *Service) Start(ctx context.Context, req StartRequest) (StartResult, err
 
 // Exec executes one command non-interactively and returns deterministic output.
 func (s *Service) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
-	if req.Command == "" {
-		return ExecResult{}, fmt.Errorf("command is required")
+	if err := validateCommand(req.Command, req.Args); err != nil {
+		return ExecResult{}, err
+	}
+	stdin, err := resolveStdin(req.Stdin, req.StdinString)
+	if err != nil {
+		return ExecResult{}, err
 	}
 
 	projectRoot, cfg, baseRaw, err := s.resolveProjectRuntime(req.ProjectRoot, req.ProviderOverride, false)
@@ -254,21 +348,17 @@ func (s *Service) Exec(ctx context.Context, req ExecRequest) (ExecResult, error)
 		return ExecResult{}, err
 	}
 
-	off := offbackend.New()
-	appleVM := macosbackend.New()
-	docker := dockerbackend.New()
-
 	provider := Provider(cfg.Provider)
 	if req.ProviderOverride != "" {
-		provider, err = normalizeProvider(req.ProviderOverride)
+		provider, err = s.normalizeProvider(req.ProviderOverride)
 		if err != nil {
 			return ExecResult{}, err
 		}
 	}
 
-	selection, err := backend.Select(ctx, toInternalProvider(provider), off, appleVM, docker)
+	selection, err := backend.Select(ctx, toInternalProvider(provider), s.backends, backend.SelectOptions{Auto: cfg.Auto, Cache: s.probes})
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, selectionError(err)
 	}
 
 	diagnostics := map[string]BackendDiagnostic{}
@@ -289,39 +379,84 @@ func (s *Service) Exec(ctx context.Context, req ExecRequest) (ExecResult, error)
 		return ExecResult{}, err
 	}
 
-	execCtx := ctx
+	execCtx, run, err := s.beginExec(ctx, "", req.Command, req.Args, Provider(selection.Provider))
+	if err != nil {
+		return ExecResult{}, err
+	}
+	emit(req.OnEvent, Event{Kind: "exec.started", Message: "command started", ExecID: run.info.ID})
 	timeout := time.Duration(0)
 	if req.TimeoutSeconds > 0 {
 		timeout = time.Duration(req.TimeoutSeconds) * time.Second
 		var cancel context.CancelFunc
-		execCtx, cancel = context.WithTimeout(ctx, timeout)
+		execCtx, cancel = context.WithTimeout(execCtx, timeout)
 		defer cancel()
 	}
 
-	emit(req.OnEvent, Event{Kind: "exec.running", Message: fmt.Sprintf("executing via %s", selection.Backend.Name())})
+	var spill *outputSpill
+	if req.SpillOutput {
+		if spill, err = openOutputSpill(projectRoot, run.info.ID); err != nil {
+			s.endExec(run)
+			return ExecResult{}, fmt.Errorf("open output spill: %w", err)
+		}
+	}
+	stdout, stderr := spill.writers(req.Stdout, req.Stderr)
+	stdout, stderr = outputStreams(req.OnEvent, Event{Kind: "exec.output", ExecID: run.info.ID}, stdout, stderr)
+	emit(req.OnEvent, Event{Kind: "exec.running", Message: fmt.Sprintf("executing via %s", selection.Backend.Name()), ExecID: run.info.ID})
 	beResult, err := selection.Backend.Exec(execCtx, spec, backend.ExecRequest{
-		Command: req.Command,
-		Cwd:     req.Cwd,
-		Env:     req.Env,
-		Timeout: timeout,
+		ExecID:         run.info.ID,
+		Command:        req.Command,
+		Args:           req.Args,
+		Cwd:            req.Cwd,
+		Env:            req.Env,
+		Timeout:        timeout,
+		Stdin:          stdin,
+		Stdout:         stdout,
+		Stderr:         stderr,
+		MaxOutputBytes: resolveMaxOutputBytes(req.MaxOutputBytes, cfg),
 	})
+	canceled := s.endExec(run)
 	if err != nil {
+		_ = spill.finish(&ExecResult{}, backend.ExecResult{})
 		return ExecResult{}, err
 	}
 
 	result := ExecResult{
-		Stdout:      beResult.Stdout,
-		Stderr:      beResult.Stderr,
-		ExitCode:    beResult.ExitCode,
-		Selected:    Provider(selection.Provider),
-		Diagnostics: diagnostics,
-	}
-	emit(req.OnEvent, Event{Kind: "exec.completed", Message: "command execution completed", Done: true})
+		ExecID:          run.info.ID,
+		Stdout:          beResult.Stdout,
+		Stderr:          beResult.Stderr,
+		ExitCode:        beResult.ExitCode,
+		TimedOut:        beResult.TimedOut,
+		Canceled:        canceled,
+		StartedAt:       beResult.StartedAt,
+		Duration:        beResult.Duration,
+		Signal:          beResult.Signal,
+		OOMKilled:       beResult.OOMKilled,
+		StdoutBytes:     beResult.StdoutBytes,
+		StderrBytes:     beResult.StderrBytes,
+		StdoutTruncated: beResult.StdoutTruncated,
+		StderrTruncated: beResult.StderrTruncated,
+		Selected:        Provider(selection.Provider),
+		Diagnostics:     diagnostics,
+	}
+	if err := spill.finish(&result, beResult); err != nil {
+		emit(req.OnEvent, Event{Kind: "exec.spill.failed", Message: "failed to keep spilled output", ExecID: run.info.ID, Err: err})
+	}
+	if canceled {
+		emit(req.OnEvent, Event{Kind: "exec.canceled", Message: "command execution canceled", ExecID: run.info.ID, Done: true})
+		return result, nil
+	}
+	emit(req.OnEvent, Event{Kind: "exec.completed", Message: "command execution completed", ExecID: run.info.ID, Done: true})
 	return result, nil
 }
 
 // StartSession creates a reusable sandbox session for repeated command execution.
 func (s *Service) StartSession(ctx context.Context, req StartSessionRequest) (Session, error) {
+	if req.IdleTimeout < 0 || req.MaxLifetime < 0 {
+		return Session{}, fmt.Errorf("idleTimeout and maxLifetime must be >= 0")
+	}
+	if s.isClosed() {
+		return Session{}, fmt.Errorf("service is closed")
+	}
 	projectRoot, cfg, baseRaw, err := s.resolveProjectRuntime(req.ProjectRoot, req.ProviderOverride, false)
 	if err != nil {
 		return Session{}, err
@@ -344,13 +479,18 @@ func (s *Service) StartSession(ctx context.Context, req StartSessionRequest) (Se
 
 	var sessionHandle backend.SessionHandle
 	var sessionBackend backend.SessionBackend
-	if sb, ok := selection.Backend.(backend.SessionBackend); ok {
+	sb, ok := selection.Backend.(backend.SessionBackend)
+	if req.Stateful && !ok {
+		return Session{}, fmt.Errorf("%s backend does not support stateful sessions", selection.Backend.Name())
+	}
+	if ok {
 		sessionBackend = sb
 		emit(req.OnEvent, Event{Kind: "session.start.backend", Message: fmt.Sprintf("starting session on %s", selection.Backend.Name())})
 		sessionHandle, err = sb.StartSession(ctx, spec, backend.SessionStartRequest{
 			SessionID: sessionID,
 			Cwd:       req.Cwd,
 			Env:       req.Env,
+			Stateful:  req.Stateful,
 		})
 		if err != nil {
 			return Session{}, err
@@ -358,16 +498,21 @@ func (s *Service) StartSession(ctx context.Context, req StartSessionRequest) (Se
 	}
 
 	diagnostics := toPublicDiagnostics(selection.Diagnostics)
+	now := time.Now().UTC()
 	session := Session{
-		ID:          sessionID,
-		Selected:    Provider(selection.Provider),
-		Diagnostics: diagnostics,
-		CreatedAt:   time.Now().UTC(),
-		State:       SessionStateActive,
-	}
-
-	s.mu.Lock()
-	s.sessions[sessionID] = &managedSession{
+		ID:             sessionID,
+		Selected:       Provider(selection.Provider),
+		Diagnostics:    diagnostics,
+		CreatedAt:      now,
+		State:          SessionStateActive,
+		ProjectRoot:    projectRoot,
+		IdleTimeout:    req.IdleTimeout,
+		MaxLifetime:    req.MaxLifetime,
+		Stateful:       req.Stateful,
+		LastActivityAt: now,
+		Attached:       true,
+	}
+	record := &managedSession{
 		session:        session,
 		backend:        selection.Backend,
 		sessionBackend: sessionBackend,
@@ -375,7 +520,18 @@ func (s *Service) StartSession(ctx context.Context, req StartSessionRequest) (Se
 		spec:           spec,
 		defaultCwd:     req.Cwd,
 		defaultEnv:     cloneMap(req.Env),
+		onEvent:        req.OnEvent,
+	}
+	if err := s.persistSession(record); err != nil {
+		if sessionBackend != nil {
+			_ = sessionBackend.StopSession(ctx, spec, sessionHandle)
+		}
+		return Session{}, fmt.Errorf("persist session: %w", err)
 	}
+
+	s.mu.Lock()
+	s.sessions[sessionID] = record
+	s.ensureReaper(record)
 	s.mu.Unlock()
 
 	emit(req.OnEvent, Event{Kind: "session.start.completed", Message: "session started", Done: true})
@@ -384,37 +540,57 @@ func (s *Service) StartSession(ctx context.Context, req StartSessionRequest) (Se
 
 // ExecInSession executes a command in a previously created session.
 func (s *Service) ExecInSession(ctx context.Context, req ExecInSessionRequest) (ExecResult, error) {
-	if req.Command == "" {
-		return ExecResult{}, fmt.Errorf("command is required")
+	if err := validateCommand(req.Command, req.Args); err != nil {
+		return ExecResult{}, err
 	}
-	s.mu.RLock()
-	record, ok := s.sessions[req.SessionID]
-	s.mu.RUnlock()
-	if !ok {
-		return ExecResult{}, fmt.Errorf("session not found: %s", req.SessionID)
+	stdin, err := resolveStdin(req.Stdin, req.StdinString)
+	if err != nil {
+		return ExecResult{}, err
 	}
-	if record.session.State != SessionStateActive {
-		return ExecResult{}, fmt.Errorf("session is not active: %s", req.SessionID)
+	record, err := s.activeSession(req.SessionID)
+	if err != nil {
+		return ExecResult{}, err
 	}
 
-	execCtx := ctx
+	s.touchSession(record)
+	defer s.touchSession(record)
+	execCtx, run, err := s.beginExec(ctx, req.SessionID, req.Command, req.Args, record.session.Selected)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	emit(req.OnEvent, Event{Kind: "session.exec.started", Message: "command started", ExecID: run.info.ID})
 	timeout := time.Duration(0)
 	if req.TimeoutSeconds > 0 {
 		timeout = time.Duration(req.TimeoutSeconds) * time.Second
 		var cancel context.CancelFunc
-		execCtx, cancel = context.WithTimeout(ctx, timeout)
+		execCtx, cancel = context.WithTimeout(execCtx, timeout)
 		defer cancel()
 	}
 
-	emit(req.OnEvent, Event{Kind: "session.exec.running", Message: fmt.Sprintf("executing via %s", record.backend.Name())})
+	var spill *outputSpill
+	if req.SpillOutput {
+		if spill, err = openOutputSpill(record.spec.ProjectRoot, run.info.ID); err != nil {
+			s.endExec(run)
+			return ExecResult{}, fmt.Errorf("open output spill: %w", err)
+		}
+	}
+	maxOutputBytes := resolveMaxOutputBytes(req.MaxOutputBytes, record.spec.Config)
+	stdout, stderr := spill.writers(req.Stdout, req.Stderr)
+	stdout, stderr = outputStreams(req.OnEvent, Event{Kind: "session.exec.output", ExecID: run.info.ID}, stdout, stderr)
+	emit(req.OnEvent, Event{Kind: "session.exec.running", Message: fmt.Sprintf("executing via %s", record.backend.Name()), ExecID: run.info.ID})
 	var beResult backend.ExecResult
-	var err error
 	if record.sessionBackend != nil {
 		beResult, err = record.sessionBackend.ExecInSession(execCtx, record.spec, record.handle, backend.ExecRequest{
-			Command: req.Command,
-			Cwd:     req.Cwd,
-			Env:     req.Env,
-			Timeout: timeout,
+			ExecID:         run.info.ID,
+			Command:        req.Command,
+			Args:           req.Args,
+			Cwd:            req.Cwd,
+			Env:            req.Env,
+			Timeout:        timeout,
+			Stdin:          stdin,
+			Stdout:         stdout,
+			Stderr:         stderr,
+			MaxOutputBytes: maxOutputBytes,
 		})
 	} else {
 		effectiveCwd := req.Cwd
@@ -426,34 +602,64 @@ func (s *Service) ExecInSession(ctx context.Context, req ExecInSessionRequest) (
 			effectiveEnv[k] = v
 		}
 		beResult, err = record.backend.Exec(execCtx, record.spec, backend.ExecRequest{
-			Command: req.Command,
-			Cwd:     effectiveCwd,
-			Env:     effectiveEnv,
-			Timeout: timeout,
+			ExecID:         run.info.ID,
+			Command:        req.Command,
+			Args:           req.Args,
+			Cwd:            effectiveCwd,
+			Env:            effectiveEnv,
+			Timeout:        timeout,
+			Stdin:          stdin,
+			Stdout:         stdout,
+			Stderr:         stderr,
+			MaxOutputBytes: maxOutputBytes,
 		})
 	}
+	canceled := s.endExec(run)
 	if err != nil {
+		_ = spill.finish(&ExecResult{}, backend.ExecResult{})
 		return ExecResult{}, err
 	}
 
 	result := ExecResult{
-		Stdout:      beResult.Stdout,
-		Stderr:      beResult.Stderr,
-		ExitCode:    beResult.ExitCode,
-		Selected:    record.session.Selected,
-		Diagnostics: cloneDiagnostics(record.session.Diagnostics),
-	}
-	emit(req.OnEvent, Event{Kind: "session.exec.completed", Message: "command execution completed", Done: true})
+		ExecID:          run.info.ID,
+		Stdout:          beResult.Stdout,
+		Stderr:          beResult.Stderr,
+		ExitCode:        beResult.ExitCode,
+		TimedOut:        beResult.TimedOut,
+		Canceled:        canceled,
+		StartedAt:       beResult.StartedAt,
+		Duration:        beResult.Duration,
+		Signal:          beResult.Signal,
+		OOMKilled:       beResult.OOMKilled,
+		StdoutBytes:     beResult.StdoutBytes,
+		StderrBytes:     beResult.StderrBytes,
+		StdoutTruncated: beResult.StdoutTruncated,
+		StderrTruncated: beResult.StderrTruncated,
+		Cwd:             beResult.Cwd,
+		Env:             beResult.Env,
+		Selected:        record.session.Selected,
+		Diagnostics:     cloneDiagnostics(record.session.Diagnostics),
+	}
+	if err := spill.finish(&result, beResult); err != nil {
+		emit(req.OnEvent, Event{Kind: "session.exec.spill.failed", Message: "failed to keep spilled output", ExecID: run.info.ID, Err: err})
+	}
+	if canceled {
+		emit(req.OnEvent, Event{Kind: "session.exec.canceled", Message: "command execution canceled", ExecID: run.info.ID, Done: true})
+		return result, nil
+	}
+	emit(req.OnEvent, Event{Kind: "session.exec.completed", Message: "command execution completed", ExecID: run.info.ID, Done: true})
 	return result, nil
 }
 
-// StopSession stops and removes a managed session.
+// StopSession stops and removes a managed session. Once stopped, the session
+// is forgotten and the session APIs report ErrSessionNotFound for it.
+// Sessions recorded in the registry by another process can be stopped as well.
 func (s *Service) StopSession(ctx context.Context, req StopSessionRequest) error {
 	s.mu.Lock()
 	record, ok := s.sessions[req.SessionID]
 	if !ok {
 		s.mu.Unlock()
-		return fmt.Errorf("session not found: %s", req.SessionID)
+		return s.stopDetachedSession(ctx, req)
 	}
 	if record.session.State == SessionStateStopped {
 		s.mu.Unlock()
@@ -462,26 +668,81 @@ func (s *Service) StopSession(ctx context.Context, req StopSessionRequest) error
 	record.session.State = SessionStateStopped
 	s.mu.Unlock()
 
+	s.stopProcesses(ctx, req.SessionID)
+	defer s.forgetProcesses(req.SessionID)
+
 	if record.sessionBackend != nil {
 		emit(req.OnEvent, Event{Kind: "session.stop.backend", Message: fmt.Sprintf("stopping %s session", record.backend.Name())})
 		if err := record.sessionBackend.StopSession(ctx, record.spec, record.handle); err != nil {
 			return err
 		}
 	}
+	s.mu.Lock()
+	if s.sessions[req.SessionID] == record {
+		delete(s.sessions, req.SessionID)
+	}
+	s.mu.Unlock()
+	if err := s.deleteSessionRecord(req.SessionID); err != nil {
+		return err
+	}
 
 	emit(req.OnEvent, Event{Kind: "session.stop.completed", Message: "session stopped", Done: true})
 	return nil
 }
 
-// GetSession returns session metadata by id.
-func (s *Service) GetSession(_ context.Context, sessionID string) (Session, error) {
+// stopDetachedSession stops a session known only from the registry. Records whose
+// sandbox is already gone are simply removed.
+func (s *Service) stopDetachedSession(ctx context.Context, req StopSessionRequest) error {
+	rec, err := s.loadSessionRecord(req.SessionID)
+	if err != nil {
+		return err
+	}
+	if record, err := s.resumeSession(ctx, rec); err == nil {
+		emit(req.OnEvent, Event{Kind: "session.stop.backend", Message: fmt.Sprintf("stopping %s session", record.backend.Name())})
+		if err := record.sessionBackend.StopSession(ctx, record.spec, record.handle); err != nil {
+			return err
+		}
+	}
+	if err := s.deleteSessionRecord(req.SessionID); err != nil {
+		return err
+	}
+	emit(req.OnEvent, Event{Kind: "session.stop.completed", Message: "session stopped", Done: true})
+	return nil
+}
+
+// GetSession returns session metadata by id, falling back to the session registry
+// for sessions managed by another process.
+func (s *Service) GetSession(ctx context.Context, sessionID string) (Session, error) {
 	s.mu.RLock()
 	record, ok := s.sessions[sessionID]
+	var session Session
+	if ok {
+		session = cloneSession(record.session)
+	}
 	s.mu.RUnlock()
 	if !ok {
-		return Session{}, fmt.Errorf("session not found: %s", sessionID)
+		rec, err := s.loadSessionRecord(sessionID)
+		if err != nil {
+			return Session{}, err
+		}
+		return s.checkRecord(ctx, rec), nil
+	}
+	return session, nil
+}
+
+// activeSession returns the managed session with the given id if it is active.
+// The state is read under s.mu, which StopSession and the reaper hold to change it.
+func (s *Service) activeSession(sessionID string) (*managedSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if record.session.State != SessionStateActive {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotActive, sessionID)
 	}
-	return cloneSession(record.session), nil
+	return record, nil
 }
 
 func (s *Service) resolveProjectRuntime(projectRootInput string, providerOverride Provider, requireInitialized bool) (string, config.Config, string, error) {
@@ -491,13 +752,13 @@ func (s *Service) resolveProjectRuntime(projectRootInput string, providerOverrid
 	}
 
 	cfgPath := config.ProjectConfigPath(projectRoot)
-	cfg, err := config.Load(cfgPath)
+	cfg, err := config.Load(cfgPath, s.backends.Providers()...)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return "", config.Config{}, "", err
 		}
 		if requireInitialized {
-			return "", config.Config{}, "", fmt.Errorf("project is not initialized. run `vibebox init`")
+			return "", config.Config{}, "", fmt.Errorf("%w. run `vibebox init`", ErrNotInitialized)
 		}
 		cfg = config.Default()
 		if providerOverride == ProviderOff {
@@ -524,6 +785,12 @@ func (s *Service) resolveProjectRuntime(projectRootInput string, providerOverrid
 	return projectRoot, cfg, baseRaw, nil
 }
 
+func (s *Service) isClosed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
+}
+
 func resolveProjectRoot(root string) (string, error) {
 	if root == "" {
 		cwd, err := os.Getwd()
@@ -557,18 +824,17 @@ func resolveImageDescriptor(imageID string) (image.Descriptor, error) {
 	return images[0], nil
 }
 
-func normalizeProvider(p Provider) (Provider, error) {
+// normalizeProvider maps legacy aliases to canonical names and rejects providers
+// that are neither built in nor registered through WithBackend.
+func (s *Service) normalizeProvider(p Provider) (Provider, error) {
 	if p == "" {
 		return ProviderAuto, nil
 	}
-	switch p {
-	case ProviderOff, ProviderAuto, ProviderAppleVM, ProviderDocker:
-		return p, nil
-	case ProviderMacOS:
-		return ProviderAppleVM, nil
-	default:
-		return "", fmt.Errorf("invalid provider: %q", p)
+	normalized := config.NormalizeProvider(config.Provider(p))
+	if err := normalized.Validate(s.backends.Providers()...); err != nil {
+		return "", err
 	}
+	return Provider(normalized), nil
 }
 
 func toInternalProvider(p Provider) config.Provider {
@@ -586,24 +852,23 @@ func (s *Service) selectBackendAndSpec(
 	baseRaw string,
 	streams backend.IOStreams,
 ) (backend.Selection, backend.RuntimeSpec, error) {
-	off := offbackend.New()
-	appleVM := macosbackend.New()
-	docker := dockerbackend.New()
-
 	provider := Provider(cfg.Provider)
 	var err error
 	if providerOverride != "" {
-		provider, err = normalizeProvider(providerOverride)
+		provider, err = s.normalizeProvider(providerOverride)
 		if err != nil {
 			return backend.Selection{}, backend.RuntimeSpec{}, err
 		}
 	}
-	selection, err := backend.Select(ctx, toInternalProvider(provider), off, appleVM, docker)
+	selection, err := backend.Select(ctx, toInternalProvider(provider), s.backends, backend.SelectOptions{Auto: cfg.Auto, Cache: s.probes})
 	if err != nil {
-		return backend.Selection{}, backend.RuntimeSpec{}, err
+		return backend.Selection{}, backend.RuntimeSpec{}, selectionError(err)
 	}
+	return selection, newRuntimeSpec(projectRoot, cfg, baseRaw, streams), nil
+}
 
-	spec := backend.RuntimeSpec{
+func newRuntimeSpec(projectRoot string, cfg config.Config, baseRaw string, streams backend.IOStreams) backend.RuntimeSpec {
+	return backend.RuntimeSpec{
 		ProjectRoot: projectRoot,
 		ProjectName: filepath.Base(projectRoot),
 		Config:      cfg,
@@ -611,15 +876,60 @@ func (s *Service) selectBackendAndSpec(
 		InstanceRaw: config.InstanceDiskPath(projectRoot),
 		IO:          streams,
 	}
-	return selection, spec, nil
+}
+
+// backendForProvider returns the registered backend implementing a concrete provider.
+func (s *Service) backendForProvider(p Provider) (backend.Backend, error) {
+	be, ok := s.backends.Lookup(string(toInternalProvider(p)))
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", p)
+	}
+	return be, nil
+}
+
+func toPublicSkipped(in []backend.SkippedCandidate) []SkippedProvider {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]SkippedProvider, 0, len(in))
+	for _, sc := range in {
+		out = append(out, SkippedProvider{Provider: Provider(sc.Provider), Reason: sc.Reason})
+	}
+	return out
+}
+
+// validateCommand checks that exactly one of a shell command and argv is given.
+func validateCommand(command string, args []string) error {
+	switch {
+	case command == "" && len(args) == 0:
+		return fmt.Errorf("command is required")
+	case command != "" && len(args) > 0:
+		return fmt.Errorf("command and args are mutually exclusive")
+	case len(args) > 0 && args[0] == "":
+		return fmt.Errorf("args[0] must name the executable")
+	}
+	return nil
+}
+
+func cloneArgs(in []string) []string {
+	if len(in) == 0 {
+		return nil
+	}
+	return append([]string(nil), in...)
 }
 
 func fromInternalDiag(d backend.ProbeResult) BackendDiagnostic {
-	return BackendDiagnostic{
-		Available: d.Available,
-		Reason:    d.Reason,
-		FixHints:  d.FixHints,
+	out := BackendDiagnostic{
+		Available:    d.Available,
+		Reason:       d.Reason,
+		FixHints:     d.FixHints,
+		Capabilities: BackendCapabilities(d.Capabilities),
+	}
+	if d.Runtime != (backend.RuntimeInfo{}) {
+		rt := RuntimeInfo(d.Runtime)
+		out.Runtime = &rt
 	}
+	return out
 }
 
 func toPublicDiagnostics(in map[string]backend.ProbeResult) map[string]BackendDiagnostic {
@@ -653,6 +963,16 @@ func toInternalMounts(in []Mount) []config.Mount {
 	return out
 }
 
+func resolveStdin(reader io.Reader, text string) (io.Reader, error) {
+	if reader != nil && text != "" {
+		return nil, fmt.Errorf("stdin and stdinString are mutually exclusive")
+	}
+	if text != "" {
+		return strings.NewReader(text), nil
+	}
+	return reader, nil
+}
+
 func emit(handler EventHandler, e Event) {
 	if handler != nil {
 		handler(e)
@@ -683,11 +1003,17 @@ func cloneDiagnostics(in map[string]BackendDiagnostic) map[string]BackendDiagnos
 
 func cloneSession(in Session) Session {
 	return Session{
-		ID:          in.ID,
-		Selected:    in.Selected,
-		Diagnostics: cloneDiagnostics(in.Diagnostics),
-		CreatedAt:   in.CreatedAt,
-		State:       in.State,
+		ID:             in.ID,
+		Selected:       in.Selected,
+		Diagnostics:    cloneDiagnostics(in.Diagnostics),
+		CreatedAt:      in.CreatedAt,
+		State:          in.State,
+		ProjectRoot:    in.ProjectRoot,
+		IdleTimeout:    in.IdleTimeout,
+		MaxLifetime:    in.MaxLifetime,
+		Stateful:       in.Stateful,
+		LastActivityAt: in.LastActivityAt,
+		Attached:       in.Attached,
 	}
 }
 
@@ -1,27 +1,49 @@
 package vibebox
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"vibebox/internal/config"
 )
 
+func newTestService(t *testing.T, opts ...Option) *Service {
+	t.Helper()
+	svc, err := NewService(opts...)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	return svc
+}
+
 func TestNormalizeProvider(t *testing.T) {
 	t.Parallel()
-	if _, err := normalizeProvider("bad"); err == nil {
+	svc := newTestService(t)
+	if _, err := svc.normalizeProvider("bad"); err == nil {
 		t.Fatalf("expected error for invalid provider")
 	}
-	p, err := normalizeProvider("")
+	p, err := svc.normalizeProvider("")
 	if err != nil {
 		t.Fatalf("normalize default: %v", err)
 	}
 	if p != ProviderAuto {
 		t.Fatalf("expected auto, got %s", p)
 	}
-	alias, err := normalizeProvider(ProviderMacOS)
+	alias, err := svc.normalizeProvider(ProviderMacOS)
 	if err != nil {
 		t.Fatalf("normalize alias: %v", err)
 	}
@@ -32,7 +54,7 @@ func TestNormalizeProvider(t *testing.T) {
 
 func TestResolveDefaultImage(t *testing.T) {
 	t.Parallel()
-	svc := NewService()
+	svc := newTestService(t)
 	img, err := svc.ResolveDefaultImage(runtime.GOARCH)
 	if err != nil {
 		t.Fatalf("resolve image: %v", err)
@@ -47,7 +69,7 @@ func TestResolveDefaultImage(t *testing.T) {
 
 func TestExecOffWithoutInit(t *testing.T) {
 	t.Parallel()
-	svc := NewService()
+	svc := newTestService(t)
 	project := t.TempDir()
 	if err := os.WriteFile(filepath.Join(project, "hello.txt"), []byte("x"), 0o644); err != nil {
 		t.Fatalf("write fixture: %v", err)
@@ -74,7 +96,7 @@ func TestExecOffWithoutInit(t *testing.T) {
 
 func TestSessionLifecycleOff(t *testing.T) {
 	t.Parallel()
-	svc := NewService()
+	svc := newTestService(t)
 	project := t.TempDir()
 
 	session, err := svc.StartSession(context.Background(), StartSessionRequest{
@@ -106,11 +128,1307 @@ func TestSessionLifecycleOff(t *testing.T) {
 	if err := svc.StopSession(context.Background(), StopSessionRequest{SessionID: session.ID}); err != nil {
 		t.Fatalf("stop session: %v", err)
 	}
-	state, err := svc.GetSession(context.Background(), session.ID)
+	if _, err := svc.GetSession(context.Background(), session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected stopped session to be forgotten, got %v", err)
+	}
+}
+
+func TestStatefulSessionOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	if err := os.Mkdir(filepath.Join(project, "src"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	srcDir, err := filepath.EvalSymlinks(filepath.Join(project, "src"))
+	if err != nil {
+		t.Fatalf("eval symlinks: %v", err)
+	}
+	ctx := context.Background()
+	session, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: project, ProviderOverride: ProviderOff, Stateful: true})
+	if err != nil {
+		t.Fatalf("start stateful session: %v", err)
+	}
+	defer func() {
+		_ = svc.StopSession(ctx, StopSessionRequest{SessionID: session.ID})
+	}()
+	if !session.Stateful {
+		t.Fatalf("expected stateful session")
+	}
+	run := func(req ExecInSessionRequest) ExecResult {
+		t.Helper()
+		req.SessionID = session.ID
+		result, err := svc.ExecInSession(ctx, req)
+		if err != nil {
+			t.Fatalf("exec %q: %v", req.Command, err)
+		}
+		return result
+	}
+
+	result := run(ExecInSessionRequest{Command: "cd src && export FOO=bar"})
+	if result.ExitCode != 0 || result.Cwd != srcDir || result.Env["FOO"] != "bar" {
+		t.Fatalf("unexpected state after cd/export: exit=%d cwd=%q FOO=%q", result.ExitCode, result.Cwd, result.Env["FOO"])
+	}
+	result = run(ExecInSessionRequest{Command: "pwd; echo $FOO"})
+	if result.Stdout != srcDir+"\nbar\n" {
+		t.Fatalf("state did not persist: stdout=%q", result.Stdout)
+	}
+	result = run(ExecInSessionRequest{Command: "echo $ONCE", Env: map[string]string{"ONCE": "1"}})
+	if result.Stdout != "1\n" {
+		t.Fatalf("per-command env missing: stdout=%q", result.Stdout)
+	}
+	result = run(ExecInSessionRequest{Command: "echo ${ONCE:-unset}; printf partial; echo err >&2; false"})
+	if result.Stdout != "unset\npartial" || result.Stderr != "err\n" || result.ExitCode != 1 {
+		t.Fatalf("unexpected framing: stdout=%q stderr=%q exit=%d", result.Stdout, result.Stderr, result.ExitCode)
+	}
+	result = run(ExecInSessionRequest{Args: []string{"echo", "$FOO"}})
+	if result.Stdout != "$FOO\n" {
+		t.Fatalf("args were interpreted: stdout=%q", result.Stdout)
+	}
+
+	result = run(ExecInSessionRequest{Command: "sleep 30", TimeoutSeconds: 1})
+	if !result.TimedOut {
+		t.Fatalf("expected timeout, got exit=%d", result.ExitCode)
+	}
+	result = run(ExecInSessionRequest{Command: "echo alive"})
+	if result.Stdout != "alive\n" || result.Cwd != srcDir {
+		t.Fatalf("shell did not survive timeout: stdout=%q cwd=%q", result.Stdout, result.Cwd)
+	}
+
+	if _, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "exit 3"}); !errors.Is(err, ErrShellExited) {
+		t.Fatalf("expected ErrShellExited after exit, got %v", err)
+	}
+	if _, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "true"}); ErrorCode(err) != ErrorCodeShellExited {
+		t.Fatalf("expected shell_exited code, got %v", err)
+	}
+}
+
+func TestExecStreamsOutputOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	var liveStdout bytes.Buffer
+	var mu sync.Mutex
+	chunks := map[string]string{}
+	result, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Command:          "echo out-line; echo err-line >&2",
+		Stdout:           &liveStdout,
+		OnEvent: func(e Event) {
+			if e.Kind != "exec.output" {
+				return
+			}
+			mu.Lock()
+			chunks[e.Stream] += string(e.Data)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("exec off: %v", err)
+	}
+	if liveStdout.String() != result.Stdout {
+		t.Fatalf("live stdout %q does not match result %q", liveStdout.String(), result.Stdout)
+	}
+	if !strings.Contains(chunks["stdout"], "out-line") {
+		t.Fatalf("missing stdout chunk events: %q", chunks["stdout"])
+	}
+	if !strings.Contains(chunks["stderr"], "err-line") {
+		t.Fatalf("missing stderr chunk events: %q", chunks["stderr"])
+	}
+}
+
+func TestSessionExecStdinOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	session, err := svc.StartSession(context.Background(), StartSessionRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+	})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	defer func() {
+		_ = svc.StopSession(context.Background(), StopSessionRequest{SessionID: session.ID})
+	}()
+
+	result, err := svc.ExecInSession(context.Background(), ExecInSessionRequest{
+		SessionID:   session.ID,
+		Command:     "cat > patch.txt && wc -l < patch.txt",
+		StdinString: "one\ntwo\n",
+	})
+	if err != nil {
+		t.Fatalf("exec in session: %v", err)
+	}
+	if strings.TrimSpace(result.Stdout) != "2" {
+		t.Fatalf("unexpected stdout: %q", result.Stdout)
+	}
+
+	if _, err := svc.ExecInSession(context.Background(), ExecInSessionRequest{
+		SessionID:   session.ID,
+		Command:     "cat",
+		Stdin:       strings.NewReader("a"),
+		StdinString: "b",
+	}); err == nil {
+		t.Fatalf("expected error when both stdin forms are set")
+	}
+}
+
+func TestCancelExecKillsProcessTreeOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	pidFile := filepath.Join(project, "child.pid")
+
+	started := make(chan string, 1)
+	type outcome struct {
+		result ExecResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := svc.Exec(context.Background(), ExecRequest{
+			ProjectRoot:      project,
+			ProviderOverride: ProviderOff,
+			Command:          "sleep 60 & echo $! > child.pid; wait",
+			OnEvent: func(e Event) {
+				if e.Kind == "exec.started" {
+					started <- e.ExecID
+				}
+			},
+		})
+		done <- outcome{result: result, err: err}
+	}()
+
+	execID := <-started
+	execs, err := svc.ListExecs(context.Background(), "")
+	if err != nil {
+		t.Fatalf("list execs: %v", err)
+	}
+	if len(execs) != 1 || execs[0].ID != execID {
+		t.Fatalf("expected running exec %s, got %+v", execID, execs)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(pidFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("child pid file was not written")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := svc.CancelExec(context.Background(), execID); err != nil {
+		t.Fatalf("cancel exec: %v", err)
+	}
+
+	out := <-done
+	if out.err != nil {
+		t.Fatalf("exec: %v", out.err)
+	}
+	if !out.result.Canceled || out.result.ExecID != execID {
+		t.Fatalf("expected canceled result for %s, got %+v", execID, out.result)
+	}
+	raw, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read pid file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatalf("parse pid: %v", err)
+	}
+	if processAlive(pid) {
+		t.Fatalf("background child %d survived cancellation", pid)
+	}
+	if err := svc.CancelExec(context.Background(), execID); err == nil {
+		t.Fatalf("expected error cancelling finished exec")
+	}
+}
+
+func TestStatefulSessionExecDoesNotBlockSpawnOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	pidFile := filepath.Join(project, "grandchild.pid")
+	ctx := context.Background()
+	session, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: project, ProviderOverride: ProviderOff, Stateful: true})
+	if err != nil {
+		t.Fatalf("start stateful session: %v", err)
+	}
+	defer func() {
+		_ = svc.StopSession(ctx, StopSessionRequest{SessionID: session.ID})
+	}()
+
+	execCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type outcome struct {
+		result ExecResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		// The sleep is a grandchild of the shell, started by a nested bash.
+		result, err := svc.ExecInSession(execCtx, ExecInSessionRequest{
+			SessionID: session.ID,
+			Command:   "bash -c 'sleep 60 & echo $! > grandchild.pid; wait'",
+		})
+		done <- outcome{result: result, err: err}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(pidFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("grandchild pid file was not written")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	spawnCtx, spawnCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer spawnCancel()
+	job, err := svc.SpawnInSession(spawnCtx, SpawnInSessionRequest{SessionID: session.ID, Command: "echo spawned"})
+	if err != nil {
+		t.Fatalf("spawn while a command runs: %v", err)
+	}
+	exited, err := svc.WaitProcess(spawnCtx, job.ID)
+	if err != nil || exited.ExitCode != 0 {
+		t.Fatalf("wait spawned process while a command runs: %+v, %v", exited, err)
+	}
+	select {
+	case out := <-done:
+		t.Fatalf("exec returned before cancellation: %+v, %v", out.result, out.err)
+	default:
+	}
+
+	cancel()
+	out := <-done
+	if out.err != nil || out.result.Signal != "KILL" {
+		t.Fatalf("expected the command to be killed, got %+v, %v", out.result, out.err)
+	}
+	raw, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read pid file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatalf("parse pid: %v", err)
+	}
+	if processAlive(pid) {
+		t.Fatalf("grandchild %d survived cancellation", pid)
+	}
+	result, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "echo ok"})
+	if err != nil || strings.TrimSpace(result.Stdout) != "ok" {
+		t.Fatalf("session shell should survive cancellation: %+v, %v", result, err)
+	}
+}
+
+// processAlive reports whether pid is running, treating zombies awaiting reaping as dead.
+func processAlive(pid int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return false
+		}
+		if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+			if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] == "Z" {
+				return false
+			}
+		}
+		if time.Now().After(deadline) {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExecOutputLimitSpillsOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	result, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Command:          "printf head-; head -c 1000 /dev/zero | tr '\\0' x; printf -- -tail",
+		MaxOutputBytes:   20,
+		SpillOutput:      true,
+	})
+	if err != nil {
+		t.Fatalf("exec off: %v", err)
+	}
+	if !result.StdoutTruncated || result.StdoutBytes != 1010 {
+		t.Fatalf("unexpected stdout accounting: truncated=%v bytes=%d", result.StdoutTruncated, result.StdoutBytes)
+	}
+	want := "head-xxxxx\n[... 990 bytes truncated ...]\nxxxxx-tail"
+	if result.Stdout != want {
+		t.Fatalf("unexpected stdout: %q", result.Stdout)
+	}
+	// Login shells may print warnings to stderr, so only check that its log follows truncation.
+	if result.StderrTruncated == (result.StderrLogPath == "") {
+		t.Fatalf("stderr truncated=%v but log path %q", result.StderrTruncated, result.StderrLogPath)
+	}
+	if filepath.Dir(result.StdoutLogPath) != filepath.Join(project, ".vibebox", "logs") {
+		t.Fatalf("unexpected stdout log path: %q", result.StdoutLogPath)
+	}
+	full, err := os.ReadFile(result.StdoutLogPath)
+	if err != nil {
+		t.Fatalf("read spilled stdout: %v", err)
+	}
+	if len(full) != 1010 || !strings.HasPrefix(string(full), "head-x") || !strings.HasSuffix(string(full), "x-tail") {
+		t.Fatalf("unexpected spilled stdout (%d bytes)", len(full))
+	}
+}
+
+func TestExecArgsAndShellOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	result, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Args:             []string{"printf", "%s", "$HOME; echo 'no shell'"},
+	})
+	if err != nil {
+		t.Fatalf("exec args: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "$HOME; echo 'no shell'" {
+		t.Fatalf("args were interpreted: exit=%d stdout=%q", result.ExitCode, result.Stdout)
+	}
+
+	result, err = svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Args:             []string{"vibebox-no-such-binary"},
+	})
+	if err != nil {
+		t.Fatalf("exec missing binary: %v", err)
+	}
+	if result.ExitCode != 127 || result.Stderr == "" {
+		t.Fatalf("expected exit 127 with stderr, got exit=%d stderr=%q", result.ExitCode, result.Stderr)
+	}
+
+	if _, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Command:          "true",
+		Args:             []string{"true"},
+	}); err == nil {
+		t.Fatalf("expected error when both command and args are set")
+	}
+
+	cfg := config.Default()
+	cfg.Shell = []string{"/bin/sh", "-c"}
+	if err := config.Save(config.ProjectConfigPath(project), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	result, err = svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Command:          "echo $0",
+	})
+	if err != nil {
+		t.Fatalf("exec with configured shell: %v", err)
+	}
+	if result.Stdout != "/bin/sh\n" {
+		t.Fatalf("expected configured shell, got stdout=%q", result.Stdout)
+	}
+}
+
+func TestExecLinuxNS(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	probe, _ := svc.Probe(context.Background(), ProviderLinuxNS)
+	if diag := probe.Diagnostics[string(ProviderLinuxNS)]; !diag.Available {
+		t.Skipf("linux-ns unavailable: %s", diag.Reason)
+	}
+	project := t.TempDir()
+	run := func(command string) ExecResult {
+		t.Helper()
+		result, err := svc.Exec(context.Background(), ExecRequest{
+			ProjectRoot:      project,
+			ProviderOverride: ProviderLinuxNS,
+			Command:          command,
+		})
+		if err != nil {
+			t.Fatalf("exec %q: %v", command, err)
+		}
+		return result
+	}
+
+	result := run("echo hi > out.txt && echo private > /tmp/marker && pwd && hostname && echo $IS_SANDBOX")
+	if result.ExitCode != 0 || result.Stdout != "/workspace\nvibebox\n1\n" {
+		t.Fatalf("unexpected result: exit=%d stdout=%q stderr=%q", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(project, "out.txt")); err != nil || string(data) != "hi\n" {
+		t.Fatalf("expected write through rw mount, got %q (%v)", data, err)
+	}
+	if result = run("cat /tmp/marker"); result.ExitCode == 0 {
+		t.Fatalf("expected a fresh /tmp per exec, got stdout=%q", result.Stdout)
+	}
+
+	cfg := config.Default()
+	cfg.Mounts = []config.Mount{{Host: ".", Guest: "/workspace", Mode: "ro"}}
+	if err := config.Save(config.ProjectConfigPath(project), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	if result = run("touch readonly.txt"); result.ExitCode == 0 {
+		t.Fatalf("expected read-only mount to reject writes")
+	}
+}
+
+func TestTypedErrorsOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	ctx := context.Background()
+
+	_, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: "s_0123", Command: "true"})
+	if !errors.Is(err, ErrSessionNotFound) || ErrorCode(err) != ErrorCodeSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+	if err := svc.CancelExec(ctx, "x_missing"); !errors.Is(err, ErrExecNotFound) {
+		t.Fatalf("expected ErrExecNotFound, got %v", err)
+	}
+	if _, err := svc.WaitProcess(ctx, "p_missing"); !errors.Is(err, ErrProcessNotFound) {
+		t.Fatalf("expected ErrProcessNotFound, got %v", err)
+	}
+	_, err = svc.Exec(ctx, ExecRequest{ProjectRoot: project, ProviderOverride: ProviderOff, Command: "true", Cwd: "../.."})
+	if !errors.Is(err, ErrCwdEscapesProject) {
+		t.Fatalf("expected ErrCwdEscapesProject, got %v", err)
+	}
+	_, err = svc.Start(ctx, StartRequest{ProjectRoot: project, ProviderOverride: ProviderOff})
+	if !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("expected ErrNotInitialized, got %v", err)
+	}
+
+	session, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: project, ProviderOverride: ProviderOff})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	if err := svc.StopSession(ctx, StopSessionRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("stop session: %v", err)
+	}
+	if _, err := svc.ReadFile(ctx, session.ID, "x"); !errors.Is(err, ErrSessionNotFound) && !errors.Is(err, ErrSessionNotActive) {
+		t.Fatalf("expected session error after stop, got %v", err)
+	}
+	if code := ErrorCode(fmt.Errorf("start: %w", context.DeadlineExceeded)); code != ErrorCodeTimeout {
+		t.Fatalf("expected %q for a deadline, got %q", ErrorCodeTimeout, code)
+	}
+	if code := ErrorCode(fmt.Errorf("start: %w", context.Canceled)); code != ErrorCodeCanceled {
+		t.Fatalf("expected %q for a cancellation, got %q", ErrorCodeCanceled, code)
+	}
+
+	if _, probeErr := svc.Probe(ctx, ProviderDocker); probeErr == nil {
+		return
+	}
+	_, err = svc.Exec(ctx, ExecRequest{ProjectRoot: project, ProviderOverride: ProviderDocker, Command: "true"})
+	var unavailable *ProviderUnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("expected ProviderUnavailableError, got %v", err)
+	}
+	if unavailable.Provider != ProviderDocker || unavailable.Diagnostic.Available || unavailable.Diagnostic.Reason == "" {
+		t.Fatalf("unexpected unavailable error: %+v", unavailable)
+	}
+}
+
+type echoBackend struct{}
+
+func (echoBackend) Name() string { return "test-echo" }
+func (echoBackend) Probe(context.Context) BackendProbeResult {
+	return BackendProbeResult{Available: true, Reason: "always available"}
+}
+func (echoBackend) Prepare(context.Context, RuntimeSpec) error { return nil }
+func (echoBackend) Start(context.Context, RuntimeSpec) error   { return nil }
+func (echoBackend) Exec(_ context.Context, _ RuntimeSpec, req BackendExecRequest) (BackendExecResult, error) {
+	return BackendExecResult{Stdout: "echo:" + req.Command}, nil
+}
+
+func TestWithBackendRegistersProvider(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t, WithBackend("test-echo", echoBackend{}))
+	project := t.TempDir()
+
+	probe, err := svc.Probe(context.Background(), Provider("test-echo"))
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if probe.Selected != "test-echo" || !probe.Diagnostics["test-echo"].Available {
+		t.Fatalf("unexpected probe result: %+v", probe)
+	}
+	if _, ok := probe.Diagnostics[string(ProviderOff)]; !ok {
+		t.Fatalf("built-in backends should stay registered: %v", probe.Diagnostics)
+	}
+
+	result, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: Provider("test-echo"),
+		Command:          "hello",
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if result.Selected != "test-echo" || result.Stdout != "echo:hello" {
+		t.Fatalf("unexpected exec result: %+v", result)
+	}
+
+	if _, err := newTestService(t).Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: Provider("test-echo"),
+		Command:          "hello",
+	}); err == nil {
+		t.Fatalf("a provider registered on another service must be rejected")
+	}
+
+	for _, name := range []string{"", "auto", "macos"} {
+		if _, err := NewService(WithBackend(name, echoBackend{})); err == nil {
+			t.Fatalf("expected NewService to reject backend name %q", name)
+		}
+	}
+	if _, err := NewService(WithBackend("test-nil", nil)); err == nil {
+		t.Fatalf("expected NewService to reject a nil backend")
+	}
+}
+
+type countingProbeBackend struct {
+	echoBackend
+	probes *atomic.Int32
+}
+
+func (c countingProbeBackend) Probe(ctx context.Context) BackendProbeResult {
+	c.probes.Add(1)
+	return c.echoBackend.Probe(ctx)
+}
+
+type runtimeCheckingBackend struct {
+	echoBackend
+}
+
+func (runtimeCheckingBackend) CheckConfig(_ context.Context, cfg config.Config) error {
+	if runtime := cfg.Docker.Security.Runtime; runtime != "" {
+		return fmt.Errorf("runtime %q is not registered", runtime)
+	}
+	return nil
+}
+
+func TestProbeProjectReportsConfigError(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t, WithBackend("test-checked", runtimeCheckingBackend{}))
+	project := t.TempDir()
+	cfg := config.Default()
+	cfg.Docker.Security.Runtime = "runsc"
+	if err := config.Save(config.ProjectConfigPath(project), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	result, err := svc.ProbeProject(context.Background(), ProbeRequest{ProjectRoot: project, Provider: "test-checked"})
 	if err != nil {
-		t.Fatalf("get session: %v", err)
+		t.Fatalf("probe project: %v", err)
+	}
+	if d := result.Diagnostics["test-checked"]; !d.Available || d.ConfigError != `runtime "runsc" is not registered` {
+		t.Fatalf("expected a config error, got %+v", d)
+	}
+	plain, err := svc.Probe(context.Background(), "test-checked")
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if d := plain.Diagnostics["test-checked"]; d.ConfigError != "" {
+		t.Fatalf("Probe does not check project configs: %+v", d)
+	}
+}
+
+type cleanerBackend struct {
+	echoBackend
+	calls *atomic.Int32
+}
+
+func (c cleanerBackend) Cleanup(_ context.Context, all bool) ([]string, error) {
+	c.calls.Add(1)
+	if all {
+		return []string{"idle", "busy"}, nil
+	}
+	return []string{"idle"}, nil
+}
+
+func TestCleanupCallsCleaners(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	svc := newTestService(t, WithBackend("test-cleaner", cleanerBackend{calls: &calls}))
+	ctx := context.Background()
+
+	result, err := svc.Cleanup(ctx, CleanupRequest{})
+	if err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != "idle" {
+		t.Fatalf("unexpected cleanup result: %+v", result)
+	}
+	result, err = svc.Cleanup(ctx, CleanupRequest{Provider: "test-cleaner", All: true})
+	if err != nil {
+		t.Fatalf("cleanup all: %v", err)
+	}
+	if len(result.Removed) != 2 || calls.Load() != 2 {
+		t.Fatalf("unexpected cleanup result: %+v after %d calls", result, calls.Load())
+	}
+	if result, err := svc.Cleanup(ctx, CleanupRequest{Provider: ProviderOff}); err != nil || len(result.Removed) != 0 {
+		t.Fatalf("off keeps no sandboxes: %+v %v", result, err)
+	}
+	if _, err := svc.Cleanup(ctx, CleanupRequest{Provider: "test-missing"}); err == nil {
+		t.Fatalf("expected an unknown provider to be rejected")
+	}
+}
+
+func TestProbeCacheInvalidation(t *testing.T) {
+	t.Parallel()
+	var probes atomic.Int32
+	svc := newTestService(t, WithBackend("test-counted", countingProbeBackend{probes: &probes}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Probe(ctx, Provider("test-counted")); err != nil {
+			t.Fatalf("probe: %v", err)
+		}
+	}
+	if got := probes.Load(); got != 1 {
+		t.Fatalf("expected cached probe, got %d probes", got)
+	}
+	if _, err := svc.Exec(ctx, ExecRequest{ProjectRoot: t.TempDir(), ProviderOverride: ProviderOff, Command: "true"}); err != nil {
+		t.Fatalf("exec off: %v", err)
+	}
+	svc.InvalidateProbeCache()
+	if _, err := svc.Probe(ctx, Provider("test-counted")); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if got := probes.Load(); got != 2 {
+		t.Fatalf("expected a fresh probe after invalidation, got %d probes", got)
+	}
+}
+
+func TestExitSignalFromWaitStatusOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	ctx := context.Background()
+
+	cases := []struct {
+		command string
+		code    int
+		signal  string
+	}{
+		{command: "exit 137", code: 137, signal: ""},
+		{command: "kill -KILL $$", code: -1, signal: "KILL"},
+	}
+	for _, tc := range cases {
+		result, err := svc.Exec(ctx, ExecRequest{ProjectRoot: project, ProviderOverride: ProviderOff, Command: tc.command})
+		if err != nil {
+			t.Fatalf("exec %q: %v", tc.command, err)
+		}
+		if result.ExitCode != tc.code || result.Signal != tc.signal {
+			t.Fatalf("exec %q: exit %d signal %q, want %d %q", tc.command, result.ExitCode, result.Signal, tc.code, tc.signal)
+		}
+	}
+
+	session, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: project, ProviderOverride: ProviderOff, Stateful: true})
+	if err != nil {
+		t.Fatalf("start stateful session: %v", err)
+	}
+	defer func() {
+		_ = svc.StopSession(ctx, StopSessionRequest{SessionID: session.ID})
+	}()
+	result, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "(exit 137)"})
+	if err != nil {
+		t.Fatalf("exec in session: %v", err)
+	}
+	if result.ExitCode != 137 || result.Signal != "" {
+		t.Fatalf("a shell exit code must not be reported as a signal: %+v", result)
+	}
+}
+
+func TestExecTimeoutReportsTimedOutOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	start := time.Now()
+	result, err := svc.Exec(context.Background(), ExecRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Command:          "echo before; sleep 30",
+		TimeoutSeconds:   4,
+	})
+	if err != nil {
+		t.Fatalf("exec off: %v", err)
+	}
+	if !result.TimedOut {
+		t.Fatalf("expected TimedOut, got %+v", result)
+	}
+	if result.Canceled {
+		t.Fatalf("timeout must not be reported as cancellation")
+	}
+	if !strings.Contains(result.Stdout, "before") {
+		t.Fatalf("expected partial stdout, got %q", result.Stdout)
+	}
+	if result.Signal != "KILL" {
+		t.Fatalf("expected KILL signal, got %q", result.Signal)
+	}
+	if result.StartedAt.Before(start) || result.Duration < 4*time.Second {
+		t.Fatalf("unexpected timing: startedAt=%s duration=%s", result.StartedAt, result.Duration)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Fatalf("timeout took too long: %s", elapsed)
+	}
+}
+
+func TestBackgroundProcessLifecycleOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+
+	session, err := svc.StartSession(context.Background(), StartSessionRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+	})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	defer func() {
+		_ = svc.StopSession(context.Background(), StopSessionRequest{SessionID: session.ID})
+	}()
+
+	server, err := svc.SpawnInSession(context.Background(), SpawnInSessionRequest{
+		SessionID: session.ID,
+		Command:   "echo ready; exec sleep 30",
+	})
+	if err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	if server.State != ProcessStateRunning {
+		t.Fatalf("expected running process, got %s", server.State)
+	}
+
+	// The session stays usable while the process runs.
+	execResult, err := svc.ExecInSession(context.Background(), ExecInSessionRequest{
+		SessionID: session.ID,
+		Command:   "echo alongside",
+	})
+	if err != nil || !strings.Contains(execResult.Stdout, "alongside") {
+		t.Fatalf("exec alongside process: %v %+v", err, execResult)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		logs, err := svc.ProcessLogs(context.Background(), server.ID)
+		if err != nil {
+			t.Fatalf("process logs: %v", err)
+		}
+		if strings.Contains(logs.Stdout, "ready") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process never became ready, logs=%+v", logs)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	procs, err := svc.ListProcesses(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("list processes: %v", err)
+	}
+	if len(procs) != 1 || procs[0].ID != server.ID {
+		t.Fatalf("unexpected processes: %+v", procs)
+	}
+
+	if err := svc.SignalProcess(context.Background(), server.ID, "sigterm"); err != nil {
+		t.Fatalf("signal process: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exited, err := svc.WaitProcess(waitCtx, server.ID)
+	if err != nil {
+		t.Fatalf("wait process: %v", err)
+	}
+	if exited.State != ProcessStateExited || exited.Signal != "TERM" {
+		t.Fatalf("expected exit by TERM, got %+v", exited)
+	}
+
+	var mu sync.Mutex
+	var exitEvents int
+	job, err := svc.SpawnInSession(context.Background(), SpawnInSessionRequest{
+		SessionID: session.ID,
+		Command:   "echo out; echo err >&2; exit 3",
+		OnEvent: func(e Event) {
+			if e.Kind == "process.exited" {
+				mu.Lock()
+				exitEvents++
+				mu.Unlock()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("spawn job: %v", err)
+	}
+	exited, err = svc.WaitProcess(waitCtx, job.ID)
+	if err != nil {
+		t.Fatalf("wait job: %v", err)
+	}
+	if exited.ExitCode != 3 || exited.Signal != "" {
+		t.Fatalf("unexpected job exit: %+v", exited)
+	}
+	logs, err := svc.ProcessLogs(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("job logs: %v", err)
+	}
+	if !strings.HasSuffix(logs.Stdout, "out\n") || !strings.HasSuffix(logs.Stderr, "err\n") {
+		t.Fatalf("unexpected job logs: %+v", logs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if exitEvents != 1 {
+		t.Fatalf("expected one process.exited event, got %d", exitEvents)
+	}
+}
+
+func TestProcessesArePrunedOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	ctx := context.Background()
+	session, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: t.TempDir(), ProviderOverride: ProviderOff})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	job, err := svc.SpawnInSession(ctx, SpawnInSessionRequest{SessionID: session.ID, Command: "true"})
+	if err != nil {
+		t.Fatalf("spawn job: %v", err)
+	}
+	if _, err := svc.WaitProcess(ctx, job.ID); err != nil {
+		t.Fatalf("wait job: %v", err)
+	}
+	if _, err := svc.ProcessLogs(ctx, job.ID); err != nil {
+		t.Fatalf("logs must stay readable right after wait: %v", err)
+	}
+	proc, _ := svc.lookupProcess(job.ID)
+	proc.mu.Lock()
+	proc.collectedAt = proc.collectedAt.Add(-collectedProcessRetention)
+	proc.mu.Unlock()
+	if procs, err := svc.ListProcesses(ctx, session.ID); err != nil || len(procs) != 0 {
+		t.Fatalf("expected the collected job to be pruned: %v %+v", err, procs)
+	}
+
+	server, err := svc.SpawnInSession(ctx, SpawnInSessionRequest{SessionID: session.ID, Command: "exec sleep 30"})
+	if err != nil {
+		t.Fatalf("spawn server: %v", err)
+	}
+	if err := svc.StopSession(ctx, StopSessionRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("stop session: %v", err)
+	}
+	if _, err := svc.ProcessLogs(ctx, server.ID); !errors.Is(err, ErrProcessNotFound) {
+		t.Fatalf("expected processes of a stopped session to be dropped, got %v", err)
+	}
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	if len(svc.processes) != 0 {
+		t.Fatalf("process table leaked %d entries", len(svc.processes))
+	}
+}
+
+func TestRingBufferKeepsNewestBytes(t *testing.T) {
+	t.Parallel()
+	r := newRingBuffer(8)
+	for _, chunk := range []string{"abc", "defgh", "ij", "klmnopqrstu"} {
+		_, _ = r.Write([]byte(chunk))
+	}
+	if got := string(r.Bytes()); got != "nopqrstu" {
+		t.Fatalf("unexpected ring contents: %q", got)
+	}
+	if r.Dropped() != 13 {
+		t.Fatalf("unexpected dropped count: %d", r.Dropped())
+	}
+}
+
+func TestSessionFileAPIOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	project := t.TempDir()
+	ctx := context.Background()
+
+	session, err := svc.StartSession(ctx, StartSessionRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+	})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	if err := svc.MkdirAll(ctx, session.ID, "src/data"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	content := []byte("line 'one'\n$HOME `two`\x00\xff")
+	if err := svc.WriteFile(ctx, WriteFileRequest{SessionID: session.ID, Path: "src/data/blob.bin", Data: content}); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	got, err := svc.ReadFile(ctx, session.ID, filepath.Join(project, "src", "data", "blob.bin"))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content: %q", got)
+	}
+
+	info, err := svc.Stat(ctx, session.ID, "src/data/blob.bin")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Name != "blob.bin" || info.Size != int64(len(content)) || info.IsDir || info.Mode.Perm() != 0o644 {
+		t.Fatalf("unexpected stat: %+v", info)
+	}
+	entries, err := svc.ListDir(ctx, session.ID, "src")
+	if err != nil {
+		t.Fatalf("list dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "data" || !entries[0].IsDir {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	if _, err := svc.ReadFile(ctx, session.ID, "../outside.txt"); err == nil {
+		t.Fatalf("expected path escaping the project to be rejected")
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(project, "link")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := svc.WriteFile(ctx, WriteFileRequest{SessionID: session.ID, Path: "link/escape.txt", Data: []byte("x")}); err == nil {
+		t.Fatalf("expected write through symlink escaping the project to be rejected")
+	}
+	if err := svc.Remove(ctx, RemoveRequest{SessionID: session.ID, Path: "link"}); err != nil {
+		t.Fatalf("remove symlink: %v", err)
+	}
+
+	if err := svc.Remove(ctx, RemoveRequest{SessionID: session.ID, Path: "src"}); err == nil {
+		t.Fatalf("expected non-recursive remove of a non-empty directory to fail")
+	}
+	if err := svc.Remove(ctx, RemoveRequest{SessionID: session.ID, Path: "src", Recursive: true}); err != nil {
+		t.Fatalf("remove recursive: %v", err)
+	}
+	if _, err := svc.Stat(ctx, session.ID, "src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestSessionRegistryAttachOff(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	project := t.TempDir()
+	ctx := context.Background()
+	if err := os.Mkdir(filepath.Join(project, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	first := newTestService(t, WithStateDir(stateDir))
+	session, err := first.StartSession(ctx, StartSessionRequest{
+		ProjectRoot:      project,
+		ProviderOverride: ProviderOff,
+		Cwd:              "sub",
+		Env:              map[string]string{"VIBEBOX_TEST_VALUE": "persisted"},
+	})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	// A second Service stands in for a restarted orchestrator.
+	second := newTestService(t, WithStateDir(stateDir))
+	sessions, err := second.ListSessions(ctx)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != session.ID || sessions[0].Attached || sessions[0].ProjectRoot != project {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+	if _, err := second.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "true"}); err == nil {
+		t.Fatalf("expected exec before attach to fail")
+	}
+	if _, err := second.AttachSession(ctx, session.ID); !errors.Is(err, ErrSessionNotActive) {
+		t.Fatalf("expected attach to a session of a running owner to fail, got %v", err)
+	}
+
+	// Simulate the first orchestrator exiting.
+	rec, err := second.loadSessionRecord(session.ID)
+	if err != nil {
+		t.Fatalf("load record: %v", err)
+	}
+	rec.OwnerPID = deadPID(t)
+	if err := second.saveSessionRecord(rec); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+	attached, err := second.AttachSession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("attach session: %v", err)
+	}
+	if !attached.Attached || attached.Selected != ProviderOff || !attached.CreatedAt.Equal(session.CreatedAt) {
+		t.Fatalf("unexpected attached session: %+v", attached)
+	}
+	result, err := second.ExecInSession(ctx, ExecInSessionRequest{
+		SessionID: session.ID,
+		Command:   `echo "$(basename "$PWD") $VIBEBOX_TEST_VALUE"`,
+	})
+	if err != nil {
+		t.Fatalf("exec in attached session: %v", err)
+	}
+	if !strings.Contains(result.Stdout, "sub persisted") {
+		t.Fatalf("session defaults were not restored: %q", result.Stdout)
+	}
+
+	if err := second.StopSession(ctx, StopSessionRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("stop session: %v", err)
+	}
+	if _, err := newTestService(t, WithStateDir(stateDir)).AttachSession(ctx, session.ID); err == nil {
+		t.Fatalf("expected attach after stop to fail")
+	}
+	if _, err := second.AttachSession(ctx, "../../etc/passwd"); err == nil {
+		t.Fatalf("expected invalid session id to be rejected")
+	}
+}
+
+func TestSessionRegistryPrunesLeftoverRecordsOff(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	ctx := context.Background()
+	owner := newTestService(t, WithStateDir(stateDir))
+	expiredProject, goneProject, liveProject := t.TempDir(), t.TempDir(), t.TempDir()
+	start := func(project string) Session {
+		session, err := owner.StartSession(ctx, StartSessionRequest{ProjectRoot: project, ProviderOverride: ProviderOff, MaxLifetime: time.Hour})
+		if err != nil {
+			t.Fatalf("start session: %v", err)
+		}
+		return session
+	}
+	expired, gone, live := start(expiredProject), start(goneProject), start(liveProject)
+
+	// Simulate an owner that crashed: its pid no longer runs.
+	dead := deadPID(t)
+	for _, id := range []string{expired.ID, gone.ID, live.ID} {
+		rec, err := owner.loadSessionRecord(id)
+		if err != nil {
+			t.Fatalf("load record: %v", err)
+		}
+		rec.OwnerPID = dead
+		if id == expired.ID {
+			rec.CreatedAt = rec.CreatedAt.Add(-2 * time.Hour)
+		}
+		if err := owner.saveSessionRecord(rec); err != nil {
+			t.Fatalf("save record: %v", err)
+		}
+	}
+	if err := os.RemoveAll(goneProject); err != nil {
+		t.Fatalf("remove project: %v", err)
+	}
+
+	observer := newTestService(t, WithStateDir(stateDir))
+	sessions, err := observer.ListSessions(ctx)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	states := map[string]SessionState{}
+	for _, s := range sessions {
+		states[s.ID] = s.State
+	}
+	want := map[string]SessionState{expired.ID: SessionStateExpired, gone.ID: SessionStateStale, live.ID: SessionStateActive}
+	for id, state := range want {
+		if states[id] != state {
+			t.Fatalf("session %s: state %q, want %q (all: %v)", id, states[id], state, states)
+		}
+	}
+	remaining, err := observer.ListSessions(ctx)
+	if err != nil || len(remaining) != 1 || remaining[0].ID != live.ID {
+		t.Fatalf("expected only the live record to remain, got %+v (%v)", remaining, err)
+	}
+	if _, err := observer.AttachSession(ctx, live.ID); err != nil {
+		t.Fatalf("attach leftover session: %v", err)
+	}
+	if rec, err := observer.loadSessionRecord(live.ID); err != nil || rec.OwnerPID != os.Getpid() {
+		t.Fatalf("attach must take ownership of the record: %+v (%v)", rec, err)
+	}
+}
+
+// deadPID returns the pid of a process that has exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return dead.Process.Pid
+}
+
+func TestSessionIdleTimeoutExpiresOff(t *testing.T) {
+	t.Parallel()
+	svc := newTestService(t)
+	ctx := context.Background()
+	expired := make(chan Event, 1)
+
+	session, err := svc.StartSession(ctx, StartSessionRequest{
+		ProjectRoot:      t.TempDir(),
+		ProviderOverride: ProviderOff,
+		IdleTimeout:      time.Second,
+		OnEvent: func(e Event) {
+			if e.Kind == "session.expired" {
+				expired <- e
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	select {
+	case e := <-expired:
+		if e.SessionID != session.ID || e.Err != nil {
+			t.Fatalf("unexpected expiry event: %+v", e)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatalf("session did not expire")
+	}
+	if _, err := svc.GetSession(ctx, session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected expired session to be forgotten, got %v", err)
+	}
+	if _, err := svc.ExecInSession(ctx, ExecInSessionRequest{SessionID: session.ID, Command: "true"}); err == nil {
+		t.Fatalf("expected exec in expired session to fail")
+	}
+}
+
+func TestServiceCloseStopsSessionsOff(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	svc := newTestService(t, WithStateDir(stateDir))
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		session, err := svc.StartSession(ctx, StartSessionRequest{
+			ProjectRoot:      t.TempDir(),
+			ProviderOverride: ProviderOff,
+			MaxLifetime:      time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("start session: %v", err)
+		}
+		ids = append(ids, session.ID)
+	}
+	proc, err := svc.SpawnInSession(ctx, SpawnInSessionRequest{SessionID: ids[0], Command: "exec sleep 30"})
+	if err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	managed, err := svc.lookupProcess(proc.ID)
+	if err != nil {
+		t.Fatalf("lookup process: %v", err)
+	}
+
+	if err := svc.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for _, id := range ids {
+		if _, err := svc.GetSession(ctx, id); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected closed session to be forgotten, got %v", err)
+		}
+	}
+	if exited := managed.snapshot(); exited.State != ProcessStateExited {
+		t.Fatalf("expected process to be stopped, got %+v", exited)
+	}
+	if _, err := svc.WaitProcess(ctx, proc.ID); !errors.Is(err, ErrProcessNotFound) {
+		t.Fatalf("expected processes of closed sessions to be dropped, got %v", err)
+	}
+	if remaining, err := newTestService(t, WithStateDir(stateDir)).ListSessions(ctx); err != nil || len(remaining) != 0 {
+		t.Fatalf("expected empty registry after close, got %+v (%v)", remaining, err)
+	}
+	if _, err := svc.StartSession(ctx, StartSessionRequest{ProjectRoot: t.TempDir(), ProviderOverride: ProviderOff}); err == nil {
+		t.Fatalf("expected start after close to fail")
+	}
+}
+
+func TestSessionPoolOff(t *testing.T) {
+	t.Parallel()
+	stateDir := t.TempDir()
+	svc := newTestService(t, WithStateDir(stateDir))
+	ctx := context.Background()
+
+	pool, err := svc.NewSessionPool(ctx, SessionPoolOptions{
+		ProjectRoot:      t.TempDir(),
+		ProviderOverride: ProviderOff,
+		MinSize:          1,
+		MaxSize:          2,
+		MaxUses:          2,
+	})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+	if stats := pool.Stats(); stats.Idle != 1 || stats.Created != 1 {
+		t.Fatalf("expected one warm session, got %+v", stats)
+	}
+
+	first, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire first: %v", err)
+	}
+	second, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire second: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("expected distinct sessions")
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected acquire at max size to block, got %v", err)
+	}
+
+	if err := pool.Release(ctx, first.ID); err != nil {
+		t.Fatalf("release first: %v", err)
+	}
+	again, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("reacquire: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("expected released session to be reused, got %s want %s", again.ID, first.ID)
+	}
+	// Second release reaches MaxUses, so the session is replaced.
+	if err := pool.Release(ctx, again.ID); err != nil {
+		t.Fatalf("release again: %v", err)
+	}
+	if err := pool.Discard(ctx, second.ID); err != nil {
+		t.Fatalf("discard: %v", err)
+	}
+	if err := pool.Release(ctx, second.ID); err == nil {
+		t.Fatalf("expected release of a discarded session to fail")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		stats := pool.Stats()
+		if stats.Replaced == 2 && stats.Idle >= 1 && stats.InUse == 0 && stats.Starting == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool did not settle: %+v", stats)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := svc.GetSession(ctx, first.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected replaced session to be stopped, got %v", err)
+	}
+
+	if err := pool.Close(ctx); err != nil {
+		t.Fatalf("close pool: %v", err)
+	}
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatalf("expected acquire after close to fail")
 	}
-	if state.State != SessionStateStopped {
-		t.Fatalf("expected stopped state, got %s", state.State)
+	if remaining, err := newTestService(t, WithStateDir(stateDir)).ListSessions(ctx); err != nil || len(remaining) != 0 {
+		t.Fatalf("expected no sessions after close, got %+v (%v)", remaining, err)
 	}
 }
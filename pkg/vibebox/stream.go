@@ -0,0 +1,49 @@
+package vibebox
+
+import (
+	"io"
+	"sync"
+)
+
+// outputStreams builds the live writers passed to a backend for one command.
+// Each chunk is forwarded to the caller-provided writer and emitted as a copy of
+// base carrying the stream name and data. Deliveries are serialized so handlers and writers never see
+// concurrent stdout/stderr writes.
+func outputStreams(handler EventHandler, base Event, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if handler == nil && stdout == nil && stderr == nil {
+		return nil, nil
+	}
+	mu := &sync.Mutex{}
+	return &streamWriter{mu: mu, handler: handler, base: base, stream: "stdout", dst: stdout},
+		&streamWriter{mu: mu, handler: handler, base: base, stream: "stderr", dst: stderr}
+}
+
+type streamWriter struct {
+	mu      *sync.Mutex
+	handler EventHandler
+	base    Event
+	stream  string
+	dst     io.Writer
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dst != nil {
+		if _, err := w.dst.Write(p); err != nil {
+			w.dst = nil
+		}
+	}
+	if w.handler != nil {
+		data := make([]byte, len(p))
+		copy(data, p)
+		e := w.base
+		e.Stream = w.stream
+		e.Data = data
+		w.handler(e)
+	}
+	return len(p), nil
+}
@@ -2,6 +2,7 @@ package vibebox
 
 import (
 	"io"
+	"io/fs"
 	"time"
 )
 
@@ -14,6 +15,8 @@ const (
 	ProviderAppleVM Provider = "apple-vm"
 	ProviderMacOS   Provider = "macos" // legacy alias accepted as input.
 	ProviderDocker  Provider = "docker"
+	ProviderLinuxNS Provider = "linux-ns"
+	ProviderPodman  Provider = "podman"
 )
 
 // StreamSet allows embedding apps to wire custom stdio.
@@ -40,6 +43,13 @@ type Mount struct {
 	Mode  string
 }
 
+// Ulimit is a process resource limit such as nofile or nproc.
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
 // Event is emitted during long-running operations.
 type Event struct {
 	Kind       string
@@ -52,6 +62,16 @@ type Event struct {
 	ETA        time.Duration
 	Err        error
 	Done       bool
+	// ExecID identifies the command an `*.exec.*` event belongs to.
+	ExecID string
+	// ProcessID identifies the background process a `process.*` event belongs to.
+	ProcessID string
+	// SessionID identifies the session a `session.expired` event belongs to.
+	SessionID string
+	// Stream and Data carry live command output for `*.output` events.
+	// Stream is either "stdout" or "stderr".
+	Stream string
+	Data   []byte
 }
 
 // EventHandler receives operation events.
@@ -68,6 +88,12 @@ type InitializeRequest struct {
 	ProvisionScript string
 	NoDefaultMounts bool
 	Mounts          []Mount
+	// Docker container resource limits; zero values leave a limit unset.
+	DockerCPUs      float64
+	DockerMemoryMB  int
+	DockerPidsLimit int
+	DockerShmSizeMB int
+	DockerUlimits   []Ulimit
 	OnEvent         EventHandler
 }
 
@@ -91,19 +117,47 @@ type StartRequest struct {
 type ExecRequest struct {
 	ProjectRoot      string
 	ProviderOverride Provider
-	Command          string
-	Cwd              string
-	Env              map[string]string
-	TimeoutSeconds   int
-	OnEvent          EventHandler
+	// Command is a shell command line, run through the project's configured
+	// shell (/bin/bash -lc by default).
+	Command string
+	// Args runs argv directly with no shell, for example []string{"ls", "-la"}.
+	// Exactly one of Command and Args must be set.
+	Args           []string
+	Cwd            string
+	Env            map[string]string
+	TimeoutSeconds int
+	// Stdin optionally feeds the command's standard input.
+	// StdinString is a convenience for callers that only carry text (for example JSON bridges).
+	// At most one of them may be set.
+	Stdin       io.Reader
+	StdinString string
+	// Stdout and Stderr optionally receive output while the command runs.
+	Stdout io.Writer
+	Stderr io.Writer
+	// MaxOutputBytes bounds stdout and stderr retained in ExecResult, per stream,
+	// keeping the head and tail. Zero uses the project's exec.max_output_bytes;
+	// a negative value disables the limit.
+	MaxOutputBytes int
+	// SpillOutput writes the full output of a truncated stream to .vibebox/logs/
+	// and reports the file in ExecResult.
+	SpillOutput bool
+	OnEvent     EventHandler
 }
 
 // SessionState describes lifecycle status of a managed sandbox session.
 type SessionState string
 
 const (
-	SessionStateActive  SessionState = "active"
+	SessionStateActive SessionState = "active"
+	// SessionStateStopped marks a session while StopSession stops it. Stopped
+	// sessions are then forgotten.
 	SessionStateStopped SessionState = "stopped"
+	// SessionStateExpired marks a registry record of an exited process that was
+	// stopped after IdleTimeout or MaxLifetime.
+	SessionStateExpired SessionState = "expired"
+	// SessionStateStale marks a registry record whose owning process is gone and
+	// whose sandbox no longer exists. Stale records are removed once reported.
+	SessionStateStale SessionState = "stale"
 )
 
 // StartSessionRequest creates a reusable sandbox session.
@@ -112,7 +166,19 @@ type StartSessionRequest struct {
 	ProviderOverride Provider
 	Cwd              string
 	Env              map[string]string
-	OnEvent          EventHandler
+	// IdleTimeout stops the session once no command, process or file operation
+	// has used it for this long. Zero disables the idle timeout.
+	IdleTimeout time.Duration
+	// MaxLifetime stops the session this long after it was created, even if busy.
+	// Zero disables the limit.
+	MaxLifetime time.Duration
+	// Stateful runs every ExecInSession in one long-lived bash, like a terminal:
+	// cd and exported variables carry over to later commands, and each ExecResult
+	// reports the resulting Cwd and Env. Commands cannot read stdin. Supported by
+	// the off and docker backends.
+	Stateful bool
+	// OnEvent receives start events and, later, the `session.expired` event.
+	OnEvent EventHandler
 }
 
 // Session identifies a managed sandbox session.
@@ -122,15 +188,36 @@ type Session struct {
 	Diagnostics map[string]BackendDiagnostic
 	CreatedAt   time.Time
 	State       SessionState
+	ProjectRoot string
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+	Stateful    bool
+	// LastActivityAt is the last time the session was used through this Service.
+	LastActivityAt time.Time
+	// Attached reports whether this Service manages the session. Sessions started
+	// by another process are listed with Attached false until AttachSession is called.
+	Attached bool
 }
 
 // ExecInSessionRequest executes one command within an existing session.
 type ExecInSessionRequest struct {
-	SessionID      string
+	SessionID string
+	// Command and Args behave as in ExecRequest; exactly one must be set.
 	Command        string
+	Args           []string
 	Cwd            string
 	Env            map[string]string
 	TimeoutSeconds int
+	// Stdin optionally feeds the command's standard input.
+	// StdinString is a convenience for callers that only carry text. At most one may be set.
+	Stdin       io.Reader
+	StdinString string
+	// Stdout and Stderr optionally receive output while the command runs.
+	Stdout io.Writer
+	Stderr io.Writer
+	// MaxOutputBytes and SpillOutput behave as in ExecRequest.
+	MaxOutputBytes int
+	SpillOutput    bool
 	OnEvent        EventHandler
 }
 
@@ -142,9 +229,44 @@ type StopSessionRequest struct {
 
 // BackendDiagnostic describes availability status of one backend.
 type BackendDiagnostic struct {
-	Available bool     `json:"available"`
-	Reason    string   `json:"reason"`
-	FixHints  []string `json:"fixHints"`
+	Available    bool                `json:"available"`
+	Reason       string              `json:"reason"`
+	FixHints     []string            `json:"fixHints"`
+	Capabilities BackendCapabilities `json:"capabilities"`
+	// Runtime is nil when the backend's runtime could not be inspected.
+	Runtime *RuntimeInfo `json:"runtime,omitempty"`
+	// ConfigError, set only by ProbeProject, explains why an available backend
+	// cannot run the project's configuration, such as a missing docker runtime.
+	ConfigError string `json:"configError,omitempty"`
+}
+
+// BackendCapabilities lists the features a backend supports, so callers can
+// pick a provider or adapt their requests before running anything.
+type BackendCapabilities struct {
+	// PersistentSessions means state outside mounts survives between session execs.
+	PersistentSessions bool `json:"persistentSessions"`
+	Mounts             bool `json:"mounts"`
+	Env                bool `json:"env"`
+	Cwd                bool `json:"cwd"`
+	NetworkIsolation   bool `json:"networkIsolation"`
+	Stdin              bool `json:"stdin"`
+	// FileTransfer means ReadFile/WriteFile/ListFiles work in sessions.
+	FileTransfer bool `json:"fileTransfer"`
+	// BackgroundProcesses means StartProcess and related APIs work in sessions.
+	BackgroundProcesses bool `json:"backgroundProcesses"`
+	// LiveOutput means Stdout/Stderr writers receive output while commands run.
+	LiveOutput bool `json:"liveOutput"`
+	// StatefulShell means StartSessionRequest.Stateful is supported.
+	StatefulShell bool `json:"statefulShell"`
+}
+
+// RuntimeInfo identifies the runtime behind a backend, such as the docker
+// server version and architecture or the macOS version.
+type RuntimeInfo struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Arch    string `json:"arch,omitempty"`
 }
 
 // ProbeResult reports selection outcome and diagnostics.
@@ -153,6 +275,32 @@ type ProbeResult struct {
 	WasFallback  bool
 	FallbackFrom string
 	Diagnostics  map[string]BackendDiagnostic
+	// Skipped explains, in order, why auto selection passed over earlier candidates.
+	Skipped []SkippedProvider
+}
+
+// SkippedProvider is an auto candidate that was not selected.
+type SkippedProvider struct {
+	Provider Provider `json:"provider"`
+	Reason   string   `json:"reason"`
+}
+
+// ProbeRequest selects the project whose auto settings ProbeProject applies.
+type ProbeRequest struct {
+	ProjectRoot string
+	Provider    Provider
+}
+
+// CleanupRequest selects what Cleanup removes. An empty Provider cleans every
+// available backend; All removes sandboxes that are not idle yet as well.
+type CleanupRequest struct {
+	Provider Provider
+	All      bool
+}
+
+// CleanupResult lists the sandboxes Cleanup removed.
+type CleanupResult struct {
+	Removed []string
 }
 
 // StartResult reports startup decision details.
@@ -163,11 +311,168 @@ type StartResult struct {
 	Diagnostics  map[string]BackendDiagnostic
 }
 
+// ExecInfo describes one in-flight command execution.
+type ExecInfo struct {
+	ID        string
+	SessionID string
+	// Command and Args echo the request; one of them is empty.
+	Command   string
+	Args      []string
+	Selected  Provider
+	StartedAt time.Time
+}
+
 // ExecResult is the deterministic output for one command execution.
 type ExecResult struct {
-	Stdout      string
-	Stderr      string
-	ExitCode    int
+	ExecID   string
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// TimedOut reports that TimeoutSeconds expired and the command was killed.
+	TimedOut bool
+	// Canceled reports that the command was stopped through CancelExec.
+	Canceled bool
+	// StartedAt and Duration measure the command itself, excluding sandbox preparation.
+	StartedAt time.Time
+	Duration  time.Duration
+	// Signal is the terminating signal name (for example "KILL"), if any. The
+	// docker and apple-vm backends derive it from 128+n exit codes.
+	Signal string
+	// OOMKilled reports that the sandbox killed the command for exceeding its memory limit.
+	OOMKilled bool
+	// StdoutBytes and StderrBytes count all bytes the command produced.
+	StdoutBytes int64
+	StderrBytes int64
+	// StdoutTruncated and StderrTruncated report that MaxOutputBytes dropped the
+	// middle of a stream.
+	StdoutTruncated bool
+	StderrTruncated bool
+	// StdoutLogPath and StderrLogPath point at the full output of truncated
+	// streams when SpillOutput was requested.
+	StdoutLogPath string
+	StderrLogPath string
+	// Cwd and Env are the shell's working directory and exported environment
+	// after the command. Only stateful sessions report them.
+	Cwd         string
+	Env         map[string]string
 	Selected    Provider
 	Diagnostics map[string]BackendDiagnostic
 }
+
+// DefaultProcessLogLimit is the per-stream log retention used when
+// SpawnInSessionRequest.LogLimitBytes is zero.
+const DefaultProcessLogLimit = 1 << 20
+
+// SpawnInSessionRequest starts a background process within an existing session.
+type SpawnInSessionRequest struct {
+	SessionID string
+	// Command and Args behave as in ExecRequest; exactly one must be set.
+	Command string
+	Args    []string
+	Cwd     string
+	Env     map[string]string
+	// LogLimitBytes caps the retained output per stream. Oldest bytes are dropped first.
+	LogLimitBytes int
+	// Stdout and Stderr optionally receive output while the process runs.
+	Stdout  io.Writer
+	Stderr  io.Writer
+	OnEvent EventHandler
+}
+
+// ProcessState describes lifecycle status of a background process.
+type ProcessState string
+
+const (
+	ProcessStateRunning ProcessState = "running"
+	ProcessStateExited  ProcessState = "exited"
+)
+
+// Process describes one background process started by SpawnInSession.
+type Process struct {
+	ID        string
+	SessionID string
+	Command   string
+	Args      []string
+	State     ProcessState
+	// ExitCode and Signal are set once State is exited. Signal names the
+	// signal that terminated the process (for example "TERM"), if any.
+	ExitCode int
+	Signal   string
+	// Error describes a failure to track the process, for example when its session was stopped.
+	Error     string
+	StartedAt time.Time
+	ExitedAt  time.Time
+}
+
+// ProcessLogs holds the retained output of a background process.
+type ProcessLogs struct {
+	Stdout string
+	Stderr string
+	// StdoutDropped and StderrDropped count bytes discarded because of LogLimitBytes.
+	StdoutDropped int64
+	StderrDropped int64
+}
+
+// FileInfo describes one file or directory inside a session sandbox.
+type FileInfo struct {
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// WriteFileRequest writes one file inside a session, replacing existing content.
+// The parent directory must exist; see MkdirAll.
+type WriteFileRequest struct {
+	SessionID string
+	Path      string
+	Data      []byte
+	// Mode sets permission bits for new files. Zero means 0644.
+	Mode fs.FileMode
+}
+
+// RemoveRequest deletes a file or directory inside a session.
+type RemoveRequest struct {
+	SessionID string
+	Path      string
+	// Recursive removes directories with their contents and ignores missing paths.
+	Recursive bool
+}
+
+// SessionPoolOptions configures a SessionPool. All pooled sessions share the
+// project, provider and session defaults given here.
+type SessionPoolOptions struct {
+	ProjectRoot      string
+	ProviderOverride Provider
+	Cwd              string
+	Env              map[string]string
+	// MinSize is the number of warm idle sessions the pool keeps ready.
+	MinSize int
+	// MaxSize caps idle plus acquired sessions. Zero means MinSize, or 1 if MinSize is zero.
+	MaxSize int
+	// MaxUses replaces a session after it was released this many times. Zero means unlimited.
+	MaxUses int
+	// HealthCheck is the command run in a released session before it is reused.
+	// Empty means "true". A non-zero exit, timeout or error replaces the session.
+	HealthCheck string
+	// HealthCheckTimeoutSeconds bounds the health check. Zero means 10 seconds.
+	HealthCheckTimeoutSeconds int
+	// OnEvent receives `pool.*` events.
+	OnEvent EventHandler
+}
+
+// PoolStats is a point-in-time view of a SessionPool.
+type PoolStats struct {
+	Idle     int
+	InUse    int
+	Starting int
+	// Waiting counts Acquire calls blocked because the pool is at MaxSize.
+	Waiting int
+	// Created, Acquired and Replaced are cumulative counters.
+	Created  int64
+	Acquired int64
+	// Replaced counts sessions discarded because of MaxUses, a failed health
+	// check or Discard.
+	Replaced int64
+}